@@ -0,0 +1,197 @@
+package gobwas
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gobwas/ws"
+)
+
+var (
+	ErrUnauthorized = errors.New("unauthorized") // Rejects the upgrade with 401
+	ErrForbidden    = errors.New("forbidden")    // Rejects the upgrade with 403
+)
+
+// bearerProtocol is the Sec-WebSocket-Protocol offered by browsers, which can't set headers,
+// followed by the token: new WebSocket(url, ["bearer", token]).
+const bearerProtocol = "bearer"
+
+// DefaultTokenQueryParam is the query parameter the token is read from by default: /ws?access_token=...
+const DefaultTokenQueryParam = "access_token"
+
+// UpgradeRequest is what the server saw of the HTTP upgrade request.
+type UpgradeRequest struct {
+	URI        string
+	Host       string
+	Header     http.Header
+	Protocols  []string // Offered in Sec-WebSocket-Protocol
+	RemoteAddr string
+}
+
+// BearerToken returns the token of the request, looked up in order in the Authorization header,
+// after the "bearer" Sec-WebSocket-Protocol and in the query parameter.
+func (r *UpgradeRequest) BearerToken(queryParam string) string {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+
+	for i, protocol := range r.Protocols {
+		if protocol == bearerProtocol && i+1 < len(r.Protocols) {
+			return r.Protocols[i+1]
+		}
+	}
+
+	if queryParam != "" {
+		if uri, err := url.ParseRequestURI(r.URI); err == nil {
+			return uri.Query().Get(queryParam)
+		}
+	}
+
+	return ""
+}
+
+// Principal is the authenticated client of a connection.
+type Principal struct {
+	Subject string
+	Claims  map[string]any
+}
+
+/**
+ * Authenticator decides whether an upgrade request may become a connection, before the upgrade.
+ * Returning an error wrapping ErrForbidden rejects it with 403, any other error with 401.
+ * The principal is set on the Connection and on the ctx given to the handler.
+ */
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *UpgradeRequest) (*Principal, error)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal.
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal of the connection the ctx was given for.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+/*
+ * upgrade performs the WebSocket handshake, checking the origin and authenticating the request
+ * before answering, so rejected clients get a plain HTTP error instead of a connection.
+ *
+ * Returns:
+ *   - ws.Handshake: The negotiated handshake.
+ *   - *UpgradeRequest: The request as seen by the server.
+ *   - *Principal: The authenticated client, nil without an authenticator.
+ *   - error: The handshake or authentication error.
+ */
+func (s *WebSocketServer) upgrade(ctx context.Context, conn, safeConn net.Conn) (ws.Handshake, *UpgradeRequest, *Principal, error) {
+	req := &UpgradeRequest{Header: make(http.Header), RemoteAddr: conn.RemoteAddr().String()}
+
+	var (
+		principal *Principal
+		authErr   error
+	)
+
+	upgrader := ws.Upgrader{
+		OnRequest: func(uri []byte) error {
+			req.URI = string(uri)
+			return nil
+		},
+		OnHost: func(host []byte) error {
+			req.Host = string(host)
+			return nil
+		},
+		OnHeader: func(key, value []byte) error {
+			req.Header.Add(string(key), string(value))
+			return nil
+		},
+		ProtocolCustom: func(value []byte) (string, bool) {
+			offered := strings.Split(string(value), ",")
+			for i, protocol := range offered {
+				offered[i] = strings.TrimSpace(protocol)
+			}
+			req.Protocols = append(req.Protocols, offered...)
+
+			// The client expects the protocol it authenticated with to be selected, and only
+			// a protocol it offered may be: a token from the Authorization header doesn't count
+			if s.Authenticator != nil && slices.Contains(offered, bearerProtocol) {
+				return bearerProtocol, true
+			}
+			return "", true
+		},
+		OnBeforeUpgrade: func() (ws.HandshakeHeader, error) {
+			if !s.allowedOrigin(req.Header.Get("Origin")) {
+				authErr = ErrForbidden
+				return nil, reject(http.StatusForbidden)
+			}
+
+			if s.Authenticator == nil {
+				return nil, nil
+			}
+
+			if principal, authErr = s.Authenticator.Authenticate(ctx, req); authErr != nil {
+				if errors.Is(authErr, ErrForbidden) {
+					return nil, reject(http.StatusForbidden)
+				}
+				return nil, reject(http.StatusUnauthorized)
+			}
+
+			return nil, nil
+		},
+	}
+
+	if s.Config.Compression {
+		upgrader.Negotiate = newDeflateExtension().Negotiate
+	}
+
+	hs, err := upgrader.Upgrade(safeConn)
+	if err != nil {
+		if authErr != nil {
+			// The client only gets the status, the cause is for the logs
+			return hs, req, nil, authErr
+		}
+		return hs, req, nil, err
+	}
+
+	return hs, req, principal, nil
+}
+
+// allowedOrigin reports whether connections from origin are allowed.
+// Any origin is allowed when AllowedOrigins is empty, and so are clients sending none, e.g. servers.
+func (s *WebSocketServer) allowedOrigin(origin string) bool {
+	if origin == "" || len(s.Config.AllowedOrigins) == 0 {
+		return true
+	}
+
+	for _, allowed := range s.Config.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reject answers the upgrade request with status, without telling why.
+func reject(status int) error {
+	options := []ws.RejectOption{
+		ws.RejectionStatus(status),
+		ws.RejectionReason(http.StatusText(status)),
+	}
+	if status == http.StatusUnauthorized {
+		options = append(options, ws.RejectionHeader(ws.HandshakeHeaderHTTP(http.Header{
+			"WWW-Authenticate": []string{"Bearer"},
+		})))
+	}
+
+	return ws.RejectConnectionError(options...)
+}
@@ -0,0 +1,133 @@
+package gobwas
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// stubAuthenticator accepts any request carrying a token.
+type stubAuthenticator struct{}
+
+func (stubAuthenticator) Authenticate(_ context.Context, req *UpgradeRequest) (*Principal, error) {
+	if token := req.BearerToken(""); token != "" {
+		return &Principal{Subject: token}, nil
+	}
+	return nil, ErrUnauthorized
+}
+
+// upgradeWith upgrades a request with the given header lines and returns the response to the client.
+func upgradeWith(t *testing.T, s *WebSocketServer, headers ...string) (*http.Response, *Principal) {
+	t.Helper()
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	type result struct {
+		principal *Principal
+		err       error
+	}
+	upgraded := make(chan result, 1)
+	go func() {
+		_, _, principal, err := s.upgrade(context.Background(), server, server)
+		upgraded <- result{principal, err}
+	}()
+
+	request := "GET /ws HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		strings.Join(headers, "\r\n") + "\r\n\r\n"
+	if _, err := client.Write([]byte(request)); err != nil {
+		t.Fatalf("write request: %v", err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+
+	r := <-upgraded
+	if resp.StatusCode == http.StatusSwitchingProtocols && r.err != nil {
+		t.Fatalf("upgrade: %v", r.err)
+	}
+
+	return resp, r.principal
+}
+
+func TestUpgradeSelectsBearerProtocolOnlyIfOffered(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  []string
+		protocol string // Selected protocol, empty if none
+	}{
+		{"bearer protocol", []string{"Sec-WebSocket-Protocol: bearer, t0k3n"}, "bearer"},
+		{"authorization before protocols", []string{"Authorization: Bearer t0k3n", "Sec-WebSocket-Protocol: chat"}, ""},
+		{"authorization after protocols", []string{"Sec-WebSocket-Protocol: chat", "Authorization: Bearer t0k3n"}, ""},
+		{"authorization and bearer protocol", []string{"Authorization: Bearer t0k3n", "Sec-WebSocket-Protocol: chat, bearer, t0k3n"}, "bearer"},
+	}
+
+	s := &WebSocketServer{Config: &WebSocketConfig{}, Authenticator: stubAuthenticator{}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, principal := upgradeWith(t, s, test.headers...)
+
+			if resp.StatusCode != http.StatusSwitchingProtocols {
+				t.Fatalf("status = %d, want 101", resp.StatusCode)
+			}
+			if protocol := resp.Header.Get("Sec-WebSocket-Protocol"); protocol != test.protocol {
+				t.Errorf("protocol = %q, want %q", protocol, test.protocol)
+			}
+			if principal == nil || principal.Subject != "t0k3n" {
+				t.Errorf("principal = %+v, want t0k3n", principal)
+			}
+		})
+	}
+}
+
+func TestUpgradeRejectsMissingToken(t *testing.T) {
+	s := &WebSocketServer{Config: &WebSocketConfig{}, Authenticator: stubAuthenticator{}}
+
+	resp, _ := upgradeWith(t, s, "Sec-WebSocket-Protocol: chat")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestUpgradeChecksOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string // Origin header, none if empty
+		status  int
+	}{
+		{"allowed origin", []string{"https://shop.example.com"}, "https://shop.example.com", http.StatusSwitchingProtocols},
+		{"origin in another case", []string{"https://shop.example.com"}, "https://SHOP.example.com", http.StatusSwitchingProtocols},
+		{"origin outside the list", []string{"https://shop.example.com"}, "https://evil.example.com", http.StatusForbidden},
+		{"client sending no origin", []string{"https://shop.example.com"}, "", http.StatusSwitchingProtocols},
+		{"any origin", []string{"*"}, "https://evil.example.com", http.StatusSwitchingProtocols},
+		{"no list", nil, "https://evil.example.com", http.StatusSwitchingProtocols},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &WebSocketServer{Config: &WebSocketConfig{AllowedOrigins: test.allowed}}
+
+			var headers []string
+			if test.origin != "" {
+				headers = append(headers, "Origin: "+test.origin)
+			}
+
+			if resp, _ := upgradeWith(t, s, headers...); resp.StatusCode != test.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, test.status)
+			}
+		})
+	}
+}
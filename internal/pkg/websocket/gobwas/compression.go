@@ -0,0 +1,101 @@
+package gobwas
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"sync"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
+)
+
+// compressThreshold is the size below which messages are sent uncompressed, deflate would not pay off.
+const compressThreshold = 256
+
+/**
+ * Compression implements permessage-deflate (RFC 7692), negotiated when WebSocketConfig.Compression is set.
+ *
+ * Both sides are asked to compress every message on its own (server_no_context_takeover and
+ * client_no_context_takeover), so connections hold no compression state between messages:
+ * the deflate and inflate state, hundreds of KB each, is pooled and shared by all connections.
+ */
+func newDeflateExtension() *wsflate.Extension {
+	return &wsflate.Extension{
+		Parameters: wsflate.Parameters{
+			ServerNoContextTakeover: true,
+			ClientNoContextTakeover: true,
+		},
+	}
+}
+
+// negotiatedDeflate reports whether the handshake accepted permessage-deflate.
+func negotiatedDeflate(hs ws.Handshake) bool {
+	for _, extension := range hs.Extensions {
+		if bytes.Equal(extension.Name, wsflate.ExtensionNameBytes) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// inflater adapts flate's reader to the Reset wsflate expects, so it is reused rather than rebuilt.
+type inflater struct {
+	io.ReadCloser
+}
+
+func (i inflater) Reset(r io.Reader) {
+	i.ReadCloser.(flate.Resetter).Reset(r, nil)
+}
+
+var inflaters = sync.Pool{
+	New: func() any {
+		return wsflate.NewReader(nil, func(r io.Reader) wsflate.Decompressor {
+			return inflater{flate.NewReader(r)}
+		})
+	},
+}
+
+var deflaters = sync.Pool{
+	New: func() any {
+		return wsflate.NewWriter(nil, func(w io.Writer) wsflate.Compressor {
+			fw, _ := flate.NewWriter(w, flate.BestSpeed)
+			return fw
+		})
+	},
+}
+
+// acquireInflater returns a pooled reader decompressing src; release it with releaseInflater.
+func acquireInflater(src io.Reader) *wsflate.Reader {
+	r := inflaters.Get().(*wsflate.Reader)
+	r.Reset(src)
+	return r
+}
+
+func releaseInflater(r *wsflate.Reader) {
+	r.Reset(nil)
+	inflaters.Put(r)
+}
+
+// writeCompressed writes msg as a single compressed frame.
+func writeCompressed(w io.Writer, op ws.OpCode, msg []byte) error {
+	var buf bytes.Buffer
+
+	fw := deflaters.Get().(*wsflate.Writer)
+	fw.Reset(&buf)
+	_, err := fw.Write(msg)
+	if err == nil {
+		err = fw.Flush()
+	}
+	fw.Reset(nil)
+	deflaters.Put(fw)
+	if err != nil {
+		return err
+	}
+
+	frame := ws.NewFrame(op, true, buf.Bytes())
+	frame.Header.Rsv = ws.Rsv(true, false, false)
+
+	return ws.WriteFrame(w, frame)
+}
@@ -3,27 +3,124 @@ package gobwas
 import (
 	"io"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
 )
 
+/**
+ * Connection is an upgraded WebSocket connection.
+ *
+ * Writes hold the Mutex, so the server answering pings and the application pushing messages
+ * from other goroutines never interleave their frames. ConnID is assigned by the Hub on connect.
+ * Request and Principal hold the upgrade request and, when the server authenticates, its client.
+ */
 type Connection struct {
-	Hub    WebSocketHandler
-	Conn   io.ReadWriteCloser
-	Mutex  *sync.RWMutex
-	ConnID string
-	Closed bool
+	Hub       WebSocketHandler
+	Conn      io.ReadWriteCloser
+	Mutex     *sync.RWMutex
+	ConnID    string
+	Request   *UpgradeRequest
+	Principal *Principal
+
+	close      func()       // Closes the connection on the server, set once it is polled
+	closed     atomic.Bool  // Set once, read without waiting for a write in progress
+	compress   bool         // permessage-deflate was negotiated
+	lastSeen   atomic.Int64 // Unix nanoseconds of the last frame from the client
+	lastActive atomic.Int64 // Unix nanoseconds of the last message from the client
+	pingSent   atomic.Int64 // Unix nanoseconds of the unanswered ping, 0 if none
 }
 
 func NewConnection(hub WebSocketHandler, conn io.ReadWriteCloser) *Connection {
-	return &Connection{
-		Hub:    hub,
-		Conn:   conn,
-		Closed: false,
+	c := &Connection{
+		Hub:   hub,
+		Conn:  conn,
+		Mutex: &sync.RWMutex{},
 	}
+	c.touch()
+	c.lastActive.Store(c.lastSeen.Load())
+
+	return c
+}
+
+// WriteText writes a text message.
+func (c *Connection) WriteText(msg []byte) error {
+	return c.WriteMessage(ws.OpText, msg)
+}
+
+// WriteBinary writes a binary message.
+func (c *Connection) WriteBinary(msg []byte) error {
+	return c.WriteMessage(ws.OpBinary, msg)
 }
 
 func (c *Connection) WritePong(msg []byte) error {
-	return wsutil.WriteServerMessage(c.Conn, ws.OpPong, msg)
+	return c.WriteMessage(ws.OpPong, msg)
+}
+
+// WriteMessage writes a single frame, safe for concurrent use.
+// It returns ErrConnectionClosed once the connection is closed.
+func (c *Connection) WriteMessage(op ws.OpCode, msg []byte) error {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+
+	if c.closed.Load() {
+		return ErrConnectionClosed
+	}
+
+	if c.compress && op.IsData() && len(msg) >= compressThreshold {
+		return writeCompressed(c.Conn, op, msg)
+	}
+
+	return wsutil.WriteServerMessage(c.Conn, op, msg)
+}
+
+// IsClosed reports whether the connection is closed.
+func (c *Connection) IsClosed() bool {
+	return c.closed.Load()
+}
+
+// Close closes the connection from the server side; the handler's OnClose is called as for a client close.
+func (c *Connection) Close() {
+	if c.close != nil {
+		c.close()
+		return
+	}
+
+	c.markClosed()
+	c.Conn.Close()
+}
+
+// touch records a frame from the client, which also answers any ping.
+func (c *Connection) touch() {
+	c.lastSeen.Store(time.Now().UnixNano())
+	c.pingSent.Store(0)
+}
+
+// active records a message from the client, as opposed to control frames.
+func (c *Connection) active() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+func (c *Connection) lastSeenAt() time.Time {
+	return time.Unix(0, c.lastSeen.Load())
+}
+
+func (c *Connection) lastActiveAt() time.Time {
+	return time.Unix(0, c.lastActive.Load())
+}
+
+// pingSentAt returns when the unanswered ping was sent, the zero time if there is none.
+func (c *Connection) pingSentAt() time.Time {
+	if sent := c.pingSent.Load(); sent != 0 {
+		return time.Unix(0, sent)
+	}
+	return time.Time{}
+}
+
+// markClosed flags the connection closed and reports whether it was open.
+// A write in progress isn't waited for: closing the socket makes it fail.
+func (c *Connection) markClosed() bool {
+	return c.closed.CompareAndSwap(false, true)
 }
@@ -3,3 +3,10 @@ package gobwas
 import "errors"
 
 var ErrScheduleTimeout = errors.New("schedule timeout")
+
+var (
+	ErrConnectionClosed   = errors.New("connection closed")
+	ErrConnectionNotFound = errors.New("connection not found")
+	ErrMessageTooBig      = errors.New("message too big")
+	ErrSlowConnection     = errors.New("connection too slow, closed")
+)
@@ -0,0 +1,163 @@
+package gobwas
+
+import (
+	"context"
+	"errors"
+	"math"
+	"pkg/logger"
+	"pkg/workerpool"
+	"time"
+
+	"github.com/gobwas/ws"
+)
+
+// Bounds of the heartbeat tick, a fraction of the shortest configured timeout.
+const (
+	minHeartbeatTick = 10 * time.Millisecond
+	maxHeartbeatTick = time.Second
+)
+
+/**
+ * heartbeat detects dead and idle connections without a goroutine per connection:
+ *
+ * 	- a connection quiet for PingInterval is pinged, and closed if nothing comes back within PongTimeout
+ * 	- a connection sending no message for IdleTimeout is closed, even if it answers pings
+ *
+ * Any frame from the client counts as a sign of life, pongs included, only messages as activity. Connections are checked by a
+ * timer wheel at their next deadline; pings and closes go through the hub's per-connection write queue, so they never
+ * interleave with pushed messages. The wheel only hands them to the write pool if a worker is free right away:
+ * when the pool is saturated, the ping or close is retried on the next tick instead of holding up the other connections.
+ */
+type heartbeat struct {
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	idleTimeout  time.Duration
+	wheel        *timerWheel
+}
+
+// newHeartbeat returns nil when neither pings nor the idle timeout are configured.
+func newHeartbeat(conf *WebSocketConfig) *heartbeat {
+	if conf.PingInterval <= 0 && conf.IdleTimeout <= 0 {
+		return nil
+	}
+
+	h := &heartbeat{
+		pingInterval: max(conf.PingInterval, 0),
+		pongTimeout:  conf.PongTimeout,
+		idleTimeout:  max(conf.IdleTimeout, 0),
+	}
+	if h.pingInterval > 0 && h.pongTimeout <= 0 {
+		h.pongTimeout = h.pingInterval
+	}
+
+	shortest, longest := time.Duration(math.MaxInt64), time.Duration(0)
+	for _, d := range []time.Duration{h.pingInterval, h.pongTimeout, h.idleTimeout} {
+		if d > 0 {
+			shortest, longest = min(shortest, d), max(longest, d)
+		}
+	}
+
+	tick := min(max(shortest/10, minHeartbeatTick), maxHeartbeatTick)
+	h.wheel = newTimerWheel(tick, longest)
+
+	return h
+}
+
+// watch starts checking the connection.
+func (h *heartbeat) watch(conn *Connection) {
+	h.reschedule(conn, h.next(conn, time.Now()))
+}
+
+// reschedule checks the connection again after the given duration. A connection closing meanwhile
+// may have been forgotten before it was scheduled, so it is dropped again.
+func (h *heartbeat) reschedule(conn *Connection, after time.Duration) {
+	h.wheel.schedule(conn, after)
+	if conn.IsClosed() {
+		h.wheel.cancel(conn)
+	}
+}
+
+// forget stops checking the connection.
+func (h *heartbeat) forget(conn *Connection) {
+	h.wheel.cancel(conn)
+}
+
+// next returns how long until the next deadline of the connection.
+func (h *heartbeat) next(conn *Connection, now time.Time) time.Duration {
+	lastSeen := conn.lastSeenAt()
+	next := time.Duration(math.MaxInt64)
+
+	if h.idleTimeout > 0 {
+		next = conn.lastActiveAt().Add(h.idleTimeout).Sub(now)
+	}
+	if h.pingInterval > 0 {
+		if sent := conn.pingSentAt(); !sent.IsZero() {
+			next = min(next, sent.Add(h.pongTimeout).Sub(now))
+		} else {
+			next = min(next, lastSeen.Add(h.pingInterval).Sub(now))
+		}
+	}
+
+	return next
+}
+
+// check pings or closes the connection if one of its deadlines passed, then waits for the next one.
+// A ping or close the write pool has no room for is retried on the next tick.
+func (s *WebSocketServer) check(ctx context.Context, conn *Connection, log logger.Zapper) {
+	if conn.IsClosed() {
+		return
+	}
+
+	h, now := s.heartbeat, time.Now()
+	lastSeen := conn.lastSeenAt()
+
+	if h.idleTimeout > 0 && now.Sub(conn.lastActiveAt()) >= h.idleTimeout {
+		if s.reap(conn, ws.NewCloseFrameBody(ws.StatusGoingAway, "idle timeout")) {
+			log.Infof(ctx, "closing idle connection %s", conn.ConnID)
+			return
+		}
+	} else if h.pingInterval > 0 {
+		if sent := conn.pingSentAt(); !sent.IsZero() {
+			if now.Sub(sent) >= h.pongTimeout && s.reap(conn, nil) {
+				log.Infof(ctx, "closing connection %s: no pong in %s", conn.ConnID, h.pongTimeout)
+				return
+			}
+		} else if now.Sub(lastSeen) >= h.pingInterval && s.ping(conn) {
+			conn.pingSent.Store(now.UnixNano())
+		}
+	}
+
+	h.reschedule(conn, h.next(conn, now))
+}
+
+// ping asks the client for a pong. It reports false if the write pool is busy.
+func (s *WebSocketServer) ping(conn *Connection) bool {
+	return handOff(conn, s.Hub.tryWrite(conn, ws.OpPing, nil))
+}
+
+// reap closes the connection, sending the close frame first if there is one. It reports false if the write pool is busy.
+// The peer of a dead connection gets none, the write would only wait for the IOTimeout.
+func (s *WebSocketServer) reap(conn *Connection, closeFrame []byte) bool {
+	err := s.Hub.enqueue(conn, s.Hub.writes.TrySchedule, func() {
+		if closeFrame != nil {
+			conn.WriteMessage(ws.OpClose, closeFrame)
+		}
+		conn.Close()
+	})
+
+	return handOff(conn, err)
+}
+
+// handOff reports whether the wheel handed a write over to the write pool, i.e. it wasn't refused for lack
+// of a free worker. A write refused for any other reason closes the connection, apart from the wheel:
+// the close runs the handler's OnClose.
+func handOff(conn *Connection, err error) bool {
+	if errors.Is(err, workerpool.ErrQueueFull) {
+		return false
+	}
+	if err != nil {
+		go conn.Close()
+	}
+
+	return true
+}
@@ -0,0 +1,219 @@
+package gobwas
+
+import (
+	"context"
+	"net"
+	"pkg/logger"
+	"pkg/workerpool/external"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/mailru/easygo/netpoll"
+)
+
+// testLogger sends the server logs to the test.
+type testLogger struct {
+	logger.Zapper
+	t *testing.T
+}
+
+func (l testLogger) Infof(_ context.Context, format string, args ...interface{}) {
+	l.t.Logf(format, args...)
+}
+
+func (l testLogger) Errorf(_ context.Context, format string, args ...interface{}) {
+	l.t.Logf(format, args...)
+}
+
+func TestHeartbeatDoesNotWaitForBusyWritePool(t *testing.T) {
+	writePool, err := external.NewAnts(1, 0)
+	if err != nil {
+		t.Fatalf("NewAnts: %v", err)
+	}
+
+	conf := &WebSocketConfig{PingInterval: time.Minute}
+	s := &WebSocketServer{Config: conf, Hub: NewHub(writePool, 0), heartbeat: newHeartbeat(conf)}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := NewConnection(nil, server)
+	s.Hub.register(conn)
+	conn.lastSeen.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+
+	// Occupy the only write worker
+	release := make(chan token)
+	if err := writePool.Schedule(func() { <-release }); err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+
+	checked := make(chan token)
+	go func() {
+		s.check(context.Background(), conn, testLogger{t: t})
+		close(checked)
+	}()
+
+	select {
+	case <-checked:
+	case <-time.After(time.Second):
+		t.Fatal("check waited for the write pool")
+	}
+
+	if !conn.pingSentAt().IsZero() {
+		t.Fatal("ping marked sent while it couldn't be written")
+	}
+	if due := s.heartbeat.wheel.advance(); len(due) != 1 {
+		t.Fatalf("%d connections due on the next tick, want the one to ping", len(due))
+	}
+
+	// Once a worker is free, the ping goes out
+	close(release)
+	for deadline := time.Now().Add(time.Second); conn.pingSentAt().IsZero(); {
+		if time.Now().After(deadline) {
+			t.Fatal("ping never sent")
+		}
+		time.Sleep(5 * time.Millisecond)
+		s.check(context.Background(), conn, testLogger{t: t})
+	}
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	frame, err := ws.ReadFrame(client)
+	if err != nil {
+		t.Fatalf("read ping: %v", err)
+	}
+	if frame.Header.OpCode != ws.OpPing {
+		t.Errorf("opcode = %v, want ping", frame.Header.OpCode)
+	}
+}
+
+func TestHeartbeatDropsConnectionClosedBeforeWatch(t *testing.T) {
+	h := newHeartbeat(&WebSocketConfig{PingInterval: time.Minute})
+
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := NewConnection(nil, server)
+	conn.Close()
+
+	// The close found nothing to forget, the connection must not stay on the wheel
+	h.watch(conn)
+
+	h.wheel.mutex.Lock()
+	defer h.wheel.mutex.Unlock()
+	if len(h.wheel.slotOf) != 0 {
+		t.Errorf("%d connections on the wheel, want none", len(h.wheel.slotOf))
+	}
+}
+
+// closeRecorder is a handler reporting the connections it is told are closed.
+type closeRecorder struct {
+	WebSocketHandlerImpl
+	closed chan *Connection
+}
+
+func (r *closeRecorder) OnClose(_ context.Context, conn *Connection) {
+	r.closed <- conn
+}
+
+// polledPair returns a server with a heartbeat on conf and a connection closed through handleClose,
+// as the connections it accepts are, along with the client side.
+func polledPair(t *testing.T, conf *WebSocketConfig) (*WebSocketServer, *Connection, *closeRecorder, net.Conn) {
+	t.Helper()
+
+	poller, err := netpoll.New(nil)
+	if err != nil {
+		t.Fatalf("netpoll: %v", err)
+	}
+	writePool, err := external.NewAnts(1, 0)
+	if err != nil {
+		t.Fatalf("NewAnts: %v", err)
+	}
+
+	server, client := tcpPair(t)
+	desc := netpoll.Must(netpoll.HandleRead(server))
+
+	handler := &closeRecorder{closed: make(chan *Connection, 1)}
+	s := &WebSocketServer{Handler: handler, Config: conf, Poller: poller, Hub: NewHub(writePool, 0), heartbeat: newHeartbeat(conf)}
+
+	conn := NewConnection(handler, &deadliner{server, time.Second})
+	conn.close = func() { handleClose(context.Background(), s, desc, conn, server) }
+	s.Hub.register(conn)
+
+	return s, conn, handler, client
+}
+
+func TestHeartbeatReapsConnections(t *testing.T) {
+	tests := []struct {
+		name   string
+		conf   WebSocketConfig
+		setup  func(conn *Connection, now time.Time)
+		status ws.StatusCode // Close status sent to the client, 0 if none
+	}{
+		{"no pong", WebSocketConfig{PingInterval: time.Minute, PongTimeout: time.Second}, func(conn *Connection, now time.Time) {
+			conn.lastSeen.Store(now.Add(-2 * time.Minute).UnixNano())
+			conn.pingSent.Store(now.Add(-2 * time.Second).UnixNano())
+		}, 0},
+		{"idle", WebSocketConfig{PingInterval: time.Minute, IdleTimeout: time.Minute}, func(conn *Connection, now time.Time) {
+			// Answering pings doesn't keep an idle connection open
+			conn.lastActive.Store(now.Add(-2 * time.Minute).UnixNano())
+		}, ws.StatusGoingAway},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, conn, handler, client := polledPair(t, &test.conf)
+			test.setup(conn, time.Now())
+
+			s.check(context.Background(), conn, testLogger{t: t})
+
+			select {
+			case closed := <-handler.closed:
+				if closed != conn {
+					t.Fatal("OnClose called for another connection")
+				}
+			case <-time.After(time.Second):
+				t.Fatal("connection not closed")
+			}
+
+			if _, ok := s.Hub.Get(conn.ConnID); ok {
+				t.Error("closed connection still in the hub")
+			}
+
+			client.SetReadDeadline(time.Now().Add(time.Second))
+			frame, err := ws.ReadFrame(client)
+			switch {
+			case test.status == 0 && err == nil:
+				t.Errorf("got a %v frame, want the connection closed without one", frame.Header.OpCode)
+			case test.status == 0:
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					t.Errorf("read: %v, want the connection closed", err)
+				}
+			case test.status != 0 && err != nil:
+				t.Fatalf("read close frame: %v", err)
+			case test.status != 0:
+				if status, _ := ws.ParseCloseFrameData(frame.Payload); frame.Header.OpCode != ws.OpClose || status != test.status {
+					t.Errorf("got %v with status %d, want close with %d", frame.Header.OpCode, status, test.status)
+				}
+			}
+		})
+	}
+}
+
+func TestHeartbeatKeepsLiveConnection(t *testing.T) {
+	conf := &WebSocketConfig{PingInterval: time.Minute, PongTimeout: time.Second, IdleTimeout: time.Hour}
+	s, conn, handler, _ := polledPair(t, conf)
+
+	// Pinged a while ago and answered since: touch cleared pingSent
+	conn.lastSeen.Store(time.Now().Add(-time.Second).UnixNano())
+	conn.lastActive.Store(time.Now().Add(-time.Minute).UnixNano())
+
+	s.check(context.Background(), conn, testLogger{t: t})
+
+	select {
+	case <-handler.closed:
+		t.Fatal("live connection closed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if !conn.pingSentAt().IsZero() {
+		t.Error("pinged before PingInterval")
+	}
+}
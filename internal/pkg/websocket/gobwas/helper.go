@@ -2,10 +2,15 @@ package gobwas
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"pkg/logger"
 	"time"
 
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
 	"github.com/mailru/easygo/netpoll"
 )
 
@@ -17,9 +22,21 @@ func isConnectionClosed(ev netpoll.Event) bool {
 	return ev&(netpoll.EventReadHup|netpoll.EventHup) != 0
 }
 
+// handleClose releases the connection once, however many of the close event, a read error,
+// a failed write or the heartbeat get to it.
 func handleClose(ctx context.Context, s *WebSocketServer, desc *netpoll.Desc, wsConn *Connection, conn net.Conn) {
+	if !wsConn.markClosed() {
+		return
+	}
+
+	s.Hub.unregister(wsConn)
+	if s.heartbeat != nil {
+		s.heartbeat.forget(wsConn)
+	}
 	s.Poller.Stop(desc)
 	s.Handler.OnClose(ctx, wsConn)
+	// The descriptor holds a duplicate of the socket, which stays open until both are closed
+	desc.Close()
 	closeConnection(conn)
 }
 
@@ -49,6 +66,25 @@ func (d *deadliner) Read(p []byte) (int, error) {
 	return d.Conn.Read(p)
 }
 
+// boundedReader reads from a deadliner, every read also ending by a deadline shared by all of them,
+// so a client trickling bytes within the timeout of each read can't stretch the whole read.
+type boundedReader struct {
+	*deadliner
+	deadline time.Time
+}
+
+func (r boundedReader) Read(p []byte) (int, error) {
+	deadline := time.Now().Add(r.t)
+	if r.deadline.Before(deadline) {
+		deadline = r.deadline
+	}
+
+	if err := r.Conn.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+	return r.Conn.Read(p)
+}
+
 func shouldRetryAfterCooldown(err error) bool {
 	if err == ErrScheduleTimeout {
 		return true
@@ -66,3 +102,60 @@ func cooldownAndRetry(ctx context.Context, err error, log logger.Zapper) {
 	log.Infof(ctx, "accept error: %v; retrying in %s", err, delay)
 	time.Sleep(delay)
 }
+
+// handleControl answers a control frame: pings get a pong, a close gets its close frame echoed back.
+func handleControl(conn *Connection, hdr ws.Header, payload io.Reader) error {
+	msg, err := io.ReadAll(payload)
+	if err != nil {
+		return fmt.Errorf("read control frame error: %w", err)
+	}
+
+	switch hdr.OpCode {
+	case ws.OpClose:
+		conn.WriteMessage(ws.OpClose, msg)
+		return fmt.Errorf("connection closed by client")
+	case ws.OpPing:
+		return conn.WritePong(msg)
+	}
+
+	// Pongs only prove the client is alive, which reading them recorded
+	return nil
+}
+
+// readLimited reads r to the end, failing with ErrMessageTooBig past limit bytes unless limit is 0.
+func readLimited(r io.Reader, limit int) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+
+	msg, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err == nil && len(msg) > limit {
+		return nil, ErrMessageTooBig
+	}
+
+	return msg, err
+}
+
+// failConnection tells the client why its connection is about to be closed, when it broke a rule,
+// and returns the read error.
+func failConnection(conn *Connection, err error) error {
+	var (
+		status   ws.StatusCode
+		protocol ws.ProtocolError
+	)
+
+	switch {
+	case errors.Is(err, ErrMessageTooBig), errors.Is(err, wsutil.ErrFrameTooLarge):
+		status = ws.StatusMessageTooBig
+	case errors.Is(err, wsutil.ErrInvalidUTF8):
+		status = ws.StatusInvalidFramePayloadData
+	case errors.As(err, &protocol):
+		status = ws.StatusProtocolError
+	}
+
+	if status != 0 {
+		conn.WriteMessage(ws.OpClose, ws.NewCloseFrameBody(status, err.Error()))
+	}
+
+	return fmt.Errorf("read message error: %w", err)
+}
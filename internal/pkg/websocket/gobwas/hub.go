@@ -0,0 +1,267 @@
+package gobwas
+
+import (
+	"encoding/json"
+	"log"
+	"pkg/workerpool"
+	"pkg/workerpool/keyed"
+	"sync"
+
+	"github.com/gobwas/ws"
+	"github.com/google/uuid"
+)
+
+type token = struct{}
+
+/**
+ * Hub keeps track of the live connections of a server and pushes messages to them.
+ *
+ * 	server.Hub.Broadcast(priceChanged)
+ * 	server.Hub.Send(connID, stockChanged)
+ *
+ * Pushed messages are written on the write pool, keyed by connection: the messages of a connection are
+ * written in the order they were sent, and a slow client only holds up its own messages. A connection
+ * failing a write, or with maxPending writes queued because it doesn't keep up, is closed.
+ *
+ * Handlers push from the workers of the message pool, so the write pool must be a different one:
+ * a handler waiting for a slot of its own pool could wait forever.
+ *
+ * Connections can also subscribe to topics, see Envelope for the protocol.
+ */
+type Hub struct {
+	mutex  sync.RWMutex
+	conns  map[string]*Connection
+	topics map[string]map[*Connection]token // Subscribers of each topic
+	subs   map[*Connection]map[string]token // Topics of each connection, to clean up on close
+
+	writes     *keyed.Executor[*Connection] // Serializes pushed writes per connection
+	maxPending int                          // Writes queued for a connection before it is closed as too slow
+}
+
+// DefaultMaxPendingWrites is the number of writes queued for a connection before it is closed as too slow.
+const DefaultMaxPendingWrites = 256
+
+// NewHub creates a hub writing pushed messages on pool, closing connections with maxPending
+// writes queued (DefaultMaxPendingWrites if maxPending <= 0).
+func NewHub(pool workerpool.Pool, maxPending int) *Hub {
+	if maxPending <= 0 {
+		maxPending = DefaultMaxPendingWrites
+	}
+
+	return &Hub{
+		conns:      make(map[string]*Connection),
+		topics:     make(map[string]map[*Connection]token),
+		subs:       make(map[*Connection]map[string]token),
+		writes:     keyed.New[*Connection](pool),
+		maxPending: maxPending,
+	}
+}
+
+// Get returns the live connection with the given ID.
+func (h *Hub) Get(connID string) (*Connection, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	conn, ok := h.conns[connID]
+	return conn, ok
+}
+
+// Len returns the number of live connections.
+func (h *Hub) Len() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return len(h.conns)
+}
+
+// Send pushes a text message to a connection.
+// It returns ErrConnectionNotFound if the connection is gone.
+func (h *Hub) Send(connID string, msg []byte) error {
+	conn, ok := h.Get(connID)
+	if !ok {
+		return ErrConnectionNotFound
+	}
+
+	return h.write(conn, ws.OpText, msg)
+}
+
+// Broadcast pushes a text message to every live connection and returns how many it went out to.
+func (h *Hub) Broadcast(msg []byte) int {
+	h.mutex.RLock()
+	conns := make([]*Connection, 0, len(h.conns))
+	for _, conn := range h.conns {
+		conns = append(conns, conn)
+	}
+	h.mutex.RUnlock()
+
+	sent := 0
+	for _, conn := range conns {
+		if h.write(conn, ws.OpText, msg) == nil {
+			sent++
+		}
+	}
+
+	return sent
+}
+
+// Subscribe adds a live connection to the subscribers of topic.
+func (h *Hub) Subscribe(conn *Connection, topic string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.conns[conn.ConnID]; !ok {
+		return ErrConnectionNotFound
+	}
+
+	if h.topics[topic] == nil {
+		h.topics[topic] = make(map[*Connection]token)
+	}
+	h.topics[topic][conn] = token{}
+
+	if h.subs[conn] == nil {
+		h.subs[conn] = make(map[string]token)
+	}
+	h.subs[conn][topic] = token{}
+
+	return nil
+}
+
+// Unsubscribe removes a connection from the subscribers of topic.
+func (h *Hub) Unsubscribe(conn *Connection, topic string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.unsubscribe(conn, topic)
+}
+
+// Subscribers returns the number of connections subscribed to topic.
+func (h *Hub) Subscribers(topic string) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return len(h.topics[topic])
+}
+
+// Publish sends payload, marshalled to JSON, to the subscribers of topic and returns how many it went out to.
+func (h *Hub) Publish(topic string, payload any) (int, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	msg, err := json.Marshal(Envelope{Type: TypeMessage, Topic: topic, Data: data})
+	if err != nil {
+		return 0, err
+	}
+
+	h.mutex.RLock()
+	conns := make([]*Connection, 0, len(h.topics[topic]))
+	for conn := range h.topics[topic] {
+		conns = append(conns, conn)
+	}
+	h.mutex.RUnlock()
+
+	sent := 0
+	for _, conn := range conns {
+		if h.write(conn, ws.OpText, msg) == nil {
+			sent++
+		}
+	}
+
+	return sent, nil
+}
+
+// reply pushes a protocol message to a connection.
+func (h *Hub) reply(conn *Connection, kind, topic string, data any) error {
+	envelope := Envelope{Type: kind, Topic: topic}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		envelope.Data = raw
+	}
+
+	msg, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	return h.write(conn, ws.OpText, msg)
+}
+
+// write schedules the write of a frame to conn.
+// It closes the connection and returns ErrSlowConnection if the client isn't keeping up.
+func (h *Hub) write(conn *Connection, op ws.OpCode, msg []byte) error {
+	return h.enqueue(conn, h.writes.Schedule, h.frame(conn, op, msg))
+}
+
+// tryWrite is write without waiting for a write worker: it returns the pool's error if none is free.
+func (h *Hub) tryWrite(conn *Connection, op ws.OpCode, msg []byte) error {
+	return h.enqueue(conn, h.writes.TrySchedule, h.frame(conn, op, msg))
+}
+
+// enqueue hands task to schedule behind the writes of conn, unless the client isn't keeping up.
+// It returns ErrConnectionClosed for a connection closing but not unregistered yet.
+func (h *Hub) enqueue(conn *Connection, schedule func(*Connection, func()) error, task func()) error {
+	if conn.IsClosed() {
+		return ErrConnectionClosed
+	}
+
+	if h.writes.Pending(conn) >= h.maxPending {
+		log.Printf("gobwas: %s has %d writes queued, closing slow connection", conn.ConnID, h.maxPending)
+		// Closing runs the handler's OnClose, don't make the pushing caller wait for it
+		go conn.Close()
+		return ErrSlowConnection
+	}
+
+	return schedule(conn, task)
+}
+
+// frame returns the task writing a frame to conn, which closes the connection if the write fails.
+func (h *Hub) frame(conn *Connection, op ws.OpCode, msg []byte) func() {
+	return func() {
+		if err := conn.WriteMessage(op, msg); err != nil && err != ErrConnectionClosed {
+			log.Printf("gobwas: write to %s failed, closing: %v", conn.ConnID, err)
+			conn.Close()
+		}
+	}
+}
+
+// register assigns the connection an ID and tracks it.
+func (h *Hub) register(conn *Connection) {
+	conn.ConnID = uuid.NewString()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.conns[conn.ConnID] = conn
+}
+
+// unregister stops tracking the connection and drops its subscriptions.
+func (h *Hub) unregister(conn *Connection) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.conns, conn.ConnID)
+	for topic := range h.subs[conn] {
+		h.unsubscribe(conn, topic)
+	}
+}
+
+// unsubscribe must be called with the mutex held.
+func (h *Hub) unsubscribe(conn *Connection, topic string) {
+	if subscribers, ok := h.topics[topic]; ok {
+		delete(subscribers, conn)
+		if len(subscribers) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+
+	if topics, ok := h.subs[conn]; ok {
+		delete(topics, topic)
+		if len(topics) == 0 {
+			delete(h.subs, conn)
+		}
+	}
+}
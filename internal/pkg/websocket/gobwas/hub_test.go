@@ -0,0 +1,198 @@
+package gobwas
+
+import (
+	"errors"
+	"net"
+	"pkg/workerpool/external"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws/wsutil"
+)
+
+// pipeConnection returns a registered connection whose client never reads, so its writes block.
+func pipeConnection(t *testing.T, hub *Hub) (*Connection, chan token) {
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+
+	conn := NewConnection(nil, server)
+	closed := make(chan token)
+	conn.close = func() {
+		server.Close()
+		if conn.markClosed() {
+			hub.unregister(conn)
+			close(closed)
+		}
+	}
+	hub.register(conn)
+
+	return conn, closed
+}
+
+func TestHubClosesSlowConnection(t *testing.T) {
+	pool, err := external.NewAnts(1, 0)
+	if err != nil {
+		t.Fatalf("NewAnts: %v", err)
+	}
+	hub := NewHub(pool, 3)
+	conn, closed := pipeConnection(t, hub)
+
+	for i := range 3 {
+		if err := hub.Send(conn.ConnID, []byte("tick")); err != nil {
+			t.Fatalf("Send %d: %v", i, err)
+		}
+	}
+
+	if err := hub.Send(conn.ConnID, []byte("tick")); !errors.Is(err, ErrSlowConnection) {
+		t.Fatalf("Send over the bound: err = %v, want ErrSlowConnection", err)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("slow connection was not closed")
+	}
+
+	if _, ok := hub.Get(conn.ConnID); ok {
+		t.Error("slow connection still registered")
+	}
+}
+
+// readingConnection returns a registered connection whose client reads every message into received.
+func readingConnection(t *testing.T, hub *Hub) (*Connection, <-chan string) {
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+
+	conn := NewConnection(nil, server)
+	hub.register(conn)
+
+	received := make(chan string, 16)
+	go func() {
+		for {
+			msg, err := wsutil.ReadServerText(client)
+			if err != nil {
+				return
+			}
+			received <- string(msg)
+		}
+	}()
+
+	return conn, received
+}
+
+// receive waits for the next message read by a readingConnection's client.
+func receive(t *testing.T, received <-chan string) string {
+	t.Helper()
+
+	select {
+	case msg := <-received:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return ""
+	}
+}
+
+func TestHubBroadcastCountsDeliveredConnections(t *testing.T) {
+	pool, err := external.NewAnts(4, 16)
+	if err != nil {
+		t.Fatalf("NewAnts: %v", err)
+	}
+	hub := NewHub(pool, 1)
+
+	first, firstReceived := readingConnection(t, hub)
+	second, secondReceived := readingConnection(t, hub)
+
+	// A client that doesn't read, with as many writes queued as allowed
+	slow, slowClosed := pipeConnection(t, hub)
+	if err := hub.Send(slow.ConnID, []byte("stuck")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	// A connection closing, not unregistered yet
+	closing, _ := readingConnection(t, hub)
+	closing.markClosed()
+
+	if sent := hub.Broadcast([]byte("hello")); sent != 2 {
+		t.Fatalf("Broadcast went out to %d connections, want 2", sent)
+	}
+
+	for _, received := range []<-chan string{firstReceived, secondReceived} {
+		if msg := receive(t, received); msg != "hello" {
+			t.Errorf("received %q, want hello", msg)
+		}
+	}
+
+	select {
+	case <-slowClosed:
+	case <-time.After(time.Second):
+		t.Fatal("slow connection was not closed")
+	}
+
+	if n := hub.Len(); n != 3 {
+		t.Errorf("Len = %d, want 3 with the slow connection gone", n)
+	}
+	for _, conn := range []*Connection{first, second} {
+		if _, ok := hub.Get(conn.ConnID); !ok {
+			t.Errorf("%s dropped, want it still registered", conn.ConnID)
+		}
+	}
+}
+
+func TestHubSendToUnknownConnection(t *testing.T) {
+	pool, err := external.NewAnts(1, 0)
+	if err != nil {
+		t.Fatalf("NewAnts: %v", err)
+	}
+	hub := NewHub(pool, 0)
+
+	if err := hub.Send("missing", []byte("hello")); !errors.Is(err, ErrConnectionNotFound) {
+		t.Fatalf("Send to an unknown ID: err = %v, want ErrConnectionNotFound", err)
+	}
+
+	conn, _ := readingConnection(t, hub)
+	hub.unregister(conn)
+
+	if err := hub.Send(conn.ConnID, []byte("hello")); !errors.Is(err, ErrConnectionNotFound) {
+		t.Fatalf("Send to an unregistered connection: err = %v, want ErrConnectionNotFound", err)
+	}
+}
+
+func TestHubUnregisterDropsConnection(t *testing.T) {
+	pool, err := external.NewAnts(1, 0)
+	if err != nil {
+		t.Fatalf("NewAnts: %v", err)
+	}
+	hub := NewHub(pool, 0)
+
+	conn, _ := readingConnection(t, hub)
+	other, _ := readingConnection(t, hub)
+
+	for _, topic := range []string{"prices", "stock"} {
+		if err := hub.Subscribe(conn, topic); err != nil {
+			t.Fatalf("Subscribe %s: %v", topic, err)
+		}
+	}
+	hub.Subscribe(other, "prices")
+
+	hub.unregister(conn)
+
+	if _, ok := hub.Get(conn.ConnID); ok || hub.Len() != 1 {
+		t.Fatalf("connection still registered, Len = %d", hub.Len())
+	}
+	if n, m := hub.Subscribers("prices"), hub.Subscribers("stock"); n != 1 || m != 0 {
+		t.Errorf("subscribers = %d prices and %d stock, want 1 and 0", n, m)
+	}
+
+	hub.mutex.RLock()
+	_, subscribed := hub.subs[conn]
+	_, stock := hub.topics["stock"]
+	hub.mutex.RUnlock()
+	if subscribed || stock {
+		t.Errorf("subscriptions of the connection left behind: subs %v, stock topic %v", subscribed, stock)
+	}
+
+	if err := hub.Subscribe(conn, "prices"); !errors.Is(err, ErrConnectionNotFound) {
+		t.Errorf("Subscribe after unregister: err = %v, want ErrConnectionNotFound", err)
+	}
+}
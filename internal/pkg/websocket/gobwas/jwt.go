@@ -0,0 +1,374 @@
+package gobwas
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// AuthConfig configures the JWT authentication of the upgrade requests.
+// HS256/384/512 tokens are checked against Secret, RS256/384/512 and ES256/384/512 tokens
+// against the public keys of the JWKS file. Tokens must expire unless AllowNoExpiry is set.
+type AuthConfig struct {
+	Secret        string        `mapstructure:"secret"`        // HMAC key
+	JWKSFile      string        `mapstructure:"jwksFile"`      // Local JWKS holding the public keys
+	Issuer        string        `mapstructure:"issuer"`        // Required "iss" claim, if set
+	Audience      string        `mapstructure:"audience"`      // Required in the "aud" claim, if set
+	Leeway        time.Duration `mapstructure:"leeway"`        // Clock skew tolerated on "exp" and "nbf"
+	QueryParam    string        `mapstructure:"queryParam"`    // Query parameter holding the token (default access_token)
+	AllowNoExpiry bool          `mapstructure:"allowNoExpiry"` // Accept tokens without an "exp" claim
+}
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// JWTAuthenticator authenticates upgrade requests with a bearer JWT; the "sub" claim is the principal.
+type JWTAuthenticator struct {
+	verifier   *JWTVerifier
+	queryParam string
+}
+
+// NewJWTAuthenticator creates an authenticator checking tokens as configured.
+func NewJWTAuthenticator(conf *AuthConfig) (*JWTAuthenticator, error) {
+	verifier, err := NewJWTVerifier(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	queryParam := conf.QueryParam
+	if queryParam == "" {
+		queryParam = DefaultTokenQueryParam
+	}
+
+	return &JWTAuthenticator{verifier: verifier, queryParam: queryParam}, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(_ context.Context, req *UpgradeRequest) (*Principal, error) {
+	token := req.BearerToken(a.queryParam)
+	if token == "" {
+		return nil, fmt.Errorf("%w: missing token", ErrUnauthorized)
+	}
+
+	claims, err := a.verifier.Verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+
+	subject, _ := claims["sub"].(string)
+	return &Principal{Subject: subject, Claims: claims}, nil
+}
+
+/**
+ * JWTVerifier checks the signature and the registered claims of compact JWS tokens.
+ *
+ * The algorithm of a token must match its key: HMAC tokens are only checked against the secret
+ * and signed tokens only against public keys of the matching type, so a public key can never
+ * be used as an HMAC secret, and ES tokens only against keys on the curve of their algorithm.
+ * "none" is always rejected.
+ */
+type JWTVerifier struct {
+	secret        []byte
+	keys          map[string]jwk // Public keys by "kid"
+	anonymous     []jwk          // Public keys without a "kid", only used by tokens naming no key
+	issuer        string
+	audience      string
+	leeway        time.Duration
+	allowNoExpiry bool
+	now           func() time.Time
+}
+
+// algorithms are the supported signing algorithms and their hash.
+var algorithms = map[string]crypto.Hash{
+	"HS256": crypto.SHA256, "HS384": crypto.SHA384, "HS512": crypto.SHA512,
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// curves are the curves of the ES algorithms.
+var curves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521(),
+}
+
+// jwk is a public key of the JWKS.
+type jwk struct {
+	alg string // Algorithm the key is restricted to, if any
+	key crypto.PublicKey
+}
+
+// NewJWTVerifier creates a verifier, loading the JWKS file if one is configured.
+func NewJWTVerifier(conf *AuthConfig) (*JWTVerifier, error) {
+	v := &JWTVerifier{
+		secret:        []byte(conf.Secret),
+		keys:          make(map[string]jwk),
+		issuer:        conf.Issuer,
+		audience:      conf.Audience,
+		leeway:        conf.Leeway,
+		allowNoExpiry: conf.AllowNoExpiry,
+		now:           time.Now,
+	}
+
+	if conf.JWKSFile != "" {
+		if err := v.loadJWKS(conf.JWKSFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(v.secret) == 0 && len(v.keys) == 0 && len(v.anonymous) == 0 {
+		return nil, errors.New("gobwas: auth needs a secret or a JWKS file")
+	}
+
+	return v, nil
+}
+
+// Verify checks the token and returns its claims.
+func (v *JWTVerifier) Verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+
+	if err := v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+
+	return claims, v.verifyClaims(claims)
+}
+
+func (v *JWTVerifier) verifySignature(alg, kid, signed string, signature []byte) error {
+	hash, ok := algorithms[alg]
+	if !ok {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+	}
+
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	if strings.HasPrefix(alg, "HS") {
+		if len(v.secret) == 0 {
+			return fmt.Errorf("%w: no secret for %s", ErrInvalidToken, alg)
+		}
+		mac := hmac.New(hash.New, v.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		return nil
+	}
+
+	key, err := v.key(alg, kid)
+	if err != nil {
+		return err
+	}
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") || rsa.VerifyPKCS1v15(pub, hash, digest, signature) != nil {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if pub.Curve != curves[alg] || len(signature) != 2*size {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported key for %s", ErrInvalidToken, alg)
+	}
+
+	return nil
+}
+
+// key returns the public key of kid, or the only key usable for alg when the token names none.
+func (v *JWTVerifier) key(alg, kid string) (crypto.PublicKey, error) {
+	if kid != "" {
+		k, ok := v.keys[kid]
+		if !ok || (k.alg != "" && k.alg != alg) {
+			return nil, fmt.Errorf("%w: unknown key %q for %s", ErrInvalidToken, kid, alg)
+		}
+		return k.key, nil
+	}
+
+	var (
+		found  crypto.PublicKey
+		usable int
+	)
+	use := func(k jwk) {
+		if k.alg == "" || k.alg == alg {
+			found = k.key
+			usable++
+		}
+	}
+	for _, k := range v.keys {
+		use(k)
+	}
+	for _, k := range v.anonymous {
+		use(k)
+	}
+
+	switch usable {
+	case 0:
+		return nil, fmt.Errorf("%w: no key for %s", ErrInvalidToken, alg)
+	case 1:
+		return found, nil
+	default:
+		return nil, fmt.Errorf("%w: no kid and several keys", ErrInvalidToken)
+	}
+}
+
+func (v *JWTVerifier) verifyClaims(claims map[string]any) error {
+	now := v.now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok && !v.allowNoExpiry {
+		return fmt.Errorf("%w: no expiry", ErrInvalidToken)
+	}
+	if ok && now.After(time.Unix(int64(exp), 0).Add(v.leeway)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.leeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+
+	if v.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.issuer {
+			return fmt.Errorf("%w: issuer %q", ErrInvalidToken, iss)
+		}
+	}
+
+	if v.audience != "" && !hasAudience(claims["aud"], v.audience) {
+		return fmt.Errorf("%w: audience", ErrInvalidToken)
+	}
+
+	return nil
+}
+
+// hasAudience reports whether the "aud" claim, a string or an array of strings, holds audience.
+func hasAudience(aud any, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// loadJWKS reads the RSA and EC public keys of a JWKS file; other keys are skipped.
+// Two keys with the same "kid" are rejected, as a token naming it couldn't tell them apart.
+func (v *JWTVerifier) loadJWKS(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("gobwas: read JWKS: %w", err)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("gobwas: parse JWKS: %w", err)
+	}
+
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		switch k.Kty {
+		case "RSA":
+			n, nErr := base64.RawURLEncoding.DecodeString(k.N)
+			e, eErr := base64.RawURLEncoding.DecodeString(k.E)
+			if nErr != nil || eErr != nil || len(e) == 0 || len(e) > 4 {
+				return fmt.Errorf("gobwas: JWKS key %q: bad RSA key", k.Kid)
+			}
+			key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+		case "EC":
+			curve, ok := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}[k.Crv]
+			x, xErr := base64.RawURLEncoding.DecodeString(k.X)
+			y, yErr := base64.RawURLEncoding.DecodeString(k.Y)
+			if !ok || xErr != nil || yErr != nil {
+				return fmt.Errorf("gobwas: JWKS key %q: bad EC key", k.Kid)
+			}
+			pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			if !curve.IsOnCurve(pub.X, pub.Y) {
+				return fmt.Errorf("gobwas: JWKS key %q: point not on curve", k.Kid)
+			}
+			key = pub
+
+		default:
+			continue
+		}
+
+		if k.Kid == "" {
+			v.anonymous = append(v.anonymous, jwk{alg: k.Alg, key: key})
+			continue
+		}
+		if _, ok := v.keys[k.Kid]; ok {
+			return fmt.Errorf("gobwas: JWKS key %q: duplicate kid", k.Kid)
+		}
+
+		v.keys[k.Kid] = jwk{alg: k.Alg, key: key}
+	}
+
+	return nil
+}
+
+func decodeSegment(segment string, into any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, into)
+}
@@ -0,0 +1,271 @@
+package gobwas
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testSecret = "s3cr3t"
+
+// testKeys are the private keys of the JWKS served to the verifier under test.
+type testKeys struct {
+	rsa   *rsa.PrivateKey
+	ec256 *ecdsa.PrivateKey
+	ec384 *ecdsa.PrivateKey
+}
+
+// newTestVerifier returns a verifier with the secret and a JWKS holding "rs", "ec256" and "ec384",
+// whose clock is stopped at now.
+func newTestVerifier(t *testing.T, now time.Time, conf AuthConfig) (*JWTVerifier, *testKeys) {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa: %v", err)
+	}
+	ec256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ec384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	ecJWK := func(kid, crv string, key *ecdsa.PrivateKey) map[string]string {
+		return map[string]string{"kty": "EC", "kid": kid, "crv": crv, "x": b64(key.X.Bytes()), "y": b64(key.Y.Bytes())}
+	}
+
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rs", "alg": "RS256", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		ecJWK("ec256", "P-256", ec256),
+		ecJWK("ec384", "P-384", ec384),
+	}})
+
+	conf.Secret = testSecret
+	conf.JWKSFile = writeJWKS(t, jwks)
+
+	v, err := NewJWTVerifier(&conf)
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	v.now = func() time.Time { return now }
+
+	return v, &testKeys{rsa: rsaKey, ec256: ec256, ec384: ec384}
+}
+
+// writeJWKS writes a JWKS file and returns its path.
+func writeJWKS(t *testing.T, jwks []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatalf("write JWKS: %v", err)
+	}
+	return path
+}
+
+// signedPart returns the header and claims segments of a token.
+func signedPart(alg, kid string, claims map[string]any) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	return base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+}
+
+func withSignature(signed string, signature []byte) string {
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func signHMAC(alg string, key []byte, claims map[string]any) string {
+	signed := signedPart(alg, "", claims)
+	mac := hmac.New(algorithms[alg].New, key)
+	mac.Write([]byte(signed))
+	return withSignature(signed, mac.Sum(nil))
+}
+
+func signRSA(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	signed := signedPart("RS256", kid, claims)
+	digest := digestOf("RS256", signed)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return withSignature(signed, signature)
+}
+
+// signEC signs with key as alg, encoding r and s on size bytes each.
+func signEC(t *testing.T, alg string, key *ecdsa.PrivateKey, kid string, size int, claims map[string]any) string {
+	signed := signedPart(alg, kid, claims)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digestOf(alg, signed))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	signature := make([]byte, 2*size)
+	r.FillBytes(signature[:size])
+	s.FillBytes(signature[size:])
+	return withSignature(signed, signature)
+}
+
+func digestOf(alg, signed string) []byte {
+	h := algorithms[alg].New()
+	h.Write([]byte(signed))
+	return h.Sum(nil)
+}
+
+func TestJWTVerifier(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	v, keys := newTestVerifier(t, now, AuthConfig{Leeway: 30 * time.Second})
+
+	valid := func() map[string]any {
+		return map[string]any{"sub": "user-1", "exp": float64(now.Add(time.Minute).Unix())}
+	}
+	with := func(key string, value any) map[string]any {
+		claims := valid()
+		claims[key] = value
+		return claims
+	}
+	without := func(key string) map[string]any {
+		claims := valid()
+		delete(claims, key)
+		return claims
+	}
+
+	tampered := signHMAC("HS256", []byte(testSecret), valid())
+	tampered = signedPart("HS256", "", with("sub", "admin")) + tampered[len(signedPart("HS256", "", valid())):]
+
+	tests := []struct {
+		name  string
+		token string
+		err   error // nil if the token is valid
+	}{
+		{"HS256", signHMAC("HS256", []byte(testSecret), valid()), nil},
+		{"HS512", signHMAC("HS512", []byte(testSecret), valid()), nil},
+		{"RS256", signRSA(t, keys.rsa, "rs", valid()), nil},
+		{"ES256", signEC(t, "ES256", keys.ec256, "ec256", 32, valid()), nil},
+		{"ES384", signEC(t, "ES384", keys.ec384, "ec384", 48, valid()), nil},
+
+		{"malformed", "not.a-token", ErrInvalidToken},
+		{"alg none", signedPart("none", "", valid()) + ".", ErrInvalidToken},
+		{"unknown alg", withSignature(signedPart("PS256", "rs", valid()), []byte("sig")), ErrInvalidToken},
+		{"bad HMAC signature", signHMAC("HS256", []byte("other"), valid()), ErrInvalidToken},
+		{"tampered claims", tampered, ErrInvalidToken},
+		{"bad RSA signature", withSignature(signedPart("RS256", "rs", valid()), make([]byte, 256)), ErrInvalidToken},
+
+		// A public key must never be usable as an HMAC secret
+		{"HS256 keyed with the RSA key", signHMAC("HS256", keys.rsa.N.Bytes(), valid()), ErrInvalidToken},
+		{"RS256 on an EC key", signRSA(t, keys.rsa, "ec256", valid()), ErrInvalidToken},
+		{"ES256 on the RSA key", signEC(t, "ES256", keys.ec256, "rs", 32, valid()), ErrInvalidToken},
+
+		{"ES256 short signature", withSignature(signedPart("ES256", "ec256", valid()), make([]byte, 63)), ErrInvalidToken},
+		{"ES256 long signature", signEC(t, "ES256", keys.ec256, "ec256", 33, valid()), ErrInvalidToken},
+		{"ES384 on a P-256 key", signEC(t, "ES384", keys.ec256, "ec256", 32, valid()), ErrInvalidToken},
+		{"ES256 on a P-384 key", signEC(t, "ES256", keys.ec384, "ec384", 48, valid()), ErrInvalidToken},
+
+		{"unknown kid", signRSA(t, keys.rsa, "missing", valid()), ErrInvalidToken},
+		{"kid of another key", signEC(t, "ES256", keys.ec256, "ec384", 32, valid()), ErrInvalidToken},
+		{"ES without kid and several EC keys", signEC(t, "ES256", keys.ec256, "", 32, valid()), ErrInvalidToken},
+
+		{"expired", signHMAC("HS256", []byte(testSecret), with("exp", float64(now.Add(-time.Minute).Unix()))), ErrTokenExpired},
+		{"expired within leeway", signHMAC("HS256", []byte(testSecret), with("exp", float64(now.Add(-10*time.Second).Unix()))), nil},
+		{"no exp", signHMAC("HS256", []byte(testSecret), without("exp")), ErrInvalidToken},
+		{"not valid yet", signHMAC("HS256", []byte(testSecret), with("nbf", float64(now.Add(time.Minute).Unix()))), ErrInvalidToken},
+		{"nbf within leeway", signHMAC("HS256", []byte(testSecret), with("nbf", float64(now.Add(10*time.Second).Unix()))), nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := v.Verify(test.token)
+
+			if test.err == nil {
+				if err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				if claims["sub"] != "user-1" {
+					t.Errorf("sub = %v, want user-1", claims["sub"])
+				}
+				return
+			}
+
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Verify: err = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierAllowNoExpiry(t *testing.T) {
+	v, _ := newTestVerifier(t, time.Now(), AuthConfig{AllowNoExpiry: true})
+
+	if _, err := v.Verify(signHMAC("HS256", []byte(testSecret), map[string]any{"sub": "user-1"})); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+}
+
+func TestJWTVerifierKeysWithoutKid(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa: %v", err)
+	}
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	rsaJWK := map[string]string{"kty": "RSA", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())}
+	ecJWK := map[string]string{"kty": "EC", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())}
+	claims := map[string]any{"sub": "user-1", "exp": float64(time.Now().Add(time.Minute).Unix())}
+
+	// Restricted to their algorithm, both kid-less keys are kept and each verifies its own tokens
+	rsaJWK["alg"], ecJWK["alg"] = "RS256", "ES256"
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{rsaJWK, ecJWK}})
+
+	v, err := NewJWTVerifier(&AuthConfig{JWKSFile: writeJWKS(t, jwks)})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	if _, err := v.Verify(signRSA(t, rsaKey, "", claims)); err != nil {
+		t.Errorf("RS256 without kid: %v", err)
+	}
+	if _, err := v.Verify(signEC(t, "ES256", ecKey, "", 32, claims)); err != nil {
+		t.Errorf("ES256 without kid: %v", err)
+	}
+
+	// Unrestricted, a token naming no key can't tell them apart
+	delete(rsaJWK, "alg")
+	delete(ecJWK, "alg")
+	jwks, _ = json.Marshal(map[string]any{"keys": []map[string]string{rsaJWK, ecJWK}})
+
+	v, err = NewJWTVerifier(&AuthConfig{JWKSFile: writeJWKS(t, jwks)})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	if _, err := v.Verify(signRSA(t, rsaKey, "", claims)); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("RS256 without kid and several keys: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestJWTVerifierRejectsDuplicateKid(t *testing.T) {
+	first, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	second, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "EC", "kid": "k1", "crv": "P-256", "x": b64(first.X.Bytes()), "y": b64(first.Y.Bytes())},
+		{"kty": "EC", "kid": "k1", "crv": "P-256", "x": b64(second.X.Bytes()), "y": b64(second.Y.Bytes())},
+	}})
+
+	if _, err := NewJWTVerifier(&AuthConfig{JWKSFile: writeJWKS(t, jwks)}); err == nil {
+		t.Fatal("NewJWTVerifier accepted two keys with the same kid")
+	}
+}
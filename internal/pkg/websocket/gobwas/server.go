@@ -3,14 +3,21 @@ package gobwas
 import (
 	"context"
 	"fmt"
+	"io"
+	"log"
 	"net"
 	"net/http"
 	"pkg/logger"
+	"pkg/workerpool"
+	"pkg/workerpool/external"
+	"pkg/workerpool/keyed"
 	"time"
+	"unicode/utf8"
 
 	"github.com/failsafe-go/failsafe-go"
 	"github.com/failsafe-go/failsafe-go/retrypolicy"
 	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
 	"github.com/gobwas/ws/wsutil"
 	"github.com/mailru/easygo/netpoll"
 	"github.com/panjf2000/ants/v2"
@@ -41,20 +48,60 @@ import (
 
 // WebSocketConfig holds configuration for the WebSocket server
 type WebSocketConfig struct {
-	Host       string        `mapstructure:"host" validate:"required"`
-	Port       int           `mapstructure:"port" validate:"required"`
-	Workers    int           `mapstructure:"workers" validate:"required"`
-	QueueSize  int           `mapstructure:"queueSize" validate:"required"`
-	IOTimeout  time.Duration `mapstructure:"ioTimeout" validate:"required"`
-	DebugPprof string        `mapstructure:"debugPprof"`
-	MaxMsgSize int           `mapstructure:"maxMsgSize"`
+	Host             string        `mapstructure:"host" validate:"required"`
+	Port             int           `mapstructure:"port" validate:"required"`
+	Workers          int           `mapstructure:"workers" validate:"required"`
+	QueueSize        int           `mapstructure:"queueSize" validate:"required"`
+	AcceptWorkers    int           `mapstructure:"acceptWorkers"`
+	AcceptQueueSize  int           `mapstructure:"acceptQueueSize"`
+	WriteWorkers     int           `mapstructure:"writeWorkers"`     // Workers writing pushed messages (default Workers)
+	WriteQueueSize   int           `mapstructure:"writeQueueSize"`   // Pushes waiting for a write worker (default QueueSize)
+	MaxPendingWrites int           `mapstructure:"maxPendingWrites"` // Writes queued per connection before it is closed as too slow (default 256)
+	IOTimeout        time.Duration `mapstructure:"ioTimeout" validate:"required"`
+	MessageTimeout   time.Duration `mapstructure:"messageTimeout"` // Time a message has to arrive in full once it started (default IOTimeout)
+	DebugPprof       string        `mapstructure:"debugPprof"`
+	MaxMsgSize       int           `mapstructure:"maxMsgSize"`     // Largest message in bytes, decompressed, no limit if 0
+	MaxFrameSize     int           `mapstructure:"maxFrameSize"`   // Largest frame in bytes (default MaxMsgSize)
+	Compression      bool          `mapstructure:"compression"`    // Negotiate permessage-deflate with the clients that offer it
+	PingInterval     time.Duration `mapstructure:"pingInterval"`   // Ping clients quiet for that long, never if 0
+	PongTimeout      time.Duration `mapstructure:"pongTimeout"`    // Close clients not answering a ping in time (default PingInterval)
+	IdleTimeout      time.Duration `mapstructure:"idleTimeout"`    // Close clients sending nothing for that long, never if 0
+	AllowedOrigins   []string      `mapstructure:"allowedOrigins"` // Origins of browser clients, any if empty
+	Auth             *AuthConfig   `mapstructure:"auth"`           // Authenticates upgrades with a JWT if set
 }
 
+/**
+ * WebSocketServer runs accepts and message reads on separate worker pools,
+ * so a flood of messages on established connections cannot starve new connections.
+ *
+ *   - AcceptPool: accepts TCP connections and performs the WebSocket upgrade (AcceptWorkers, AcceptQueueSize)
+ *   - MessagePool: reads and handles messages of established connections (Workers, QueueSize)
+ *   - WritePool: writes the messages pushed through the Hub (WriteWorkers, WriteQueueSize)
+ *
+ * Reads of the same connection go through a keyed executor on the MessagePool, so the frames of a
+ * connection are handled one at a time and in order, while different connections are handled in parallel.
+ *
+ * The Hub tracks the live connections, so the application can push messages to them. Pushes are written
+ * on their own pool, so handlers pushing from the MessagePool never wait for a slot of their own pool.
+ *
+ * Upgrade requests are checked against AllowedOrigins and, if an Authenticator is set, authenticated
+ * before the upgrade; rejected clients get a 401 or 403 instead of a connection.
+ *
+ * Half-open and idle connections are closed by the heartbeat (see PingInterval and IdleTimeout),
+ * which calls OnClose as for a client close.
+ */
 type WebSocketServer struct {
-	Handler WebSocketHandler
-	Poller  netpoll.Poller
-	Pool    *ants.Pool
-	Config  *WebSocketConfig
+	Handler       WebSocketHandler
+	Poller        netpoll.Poller
+	AcceptPool    workerpool.Pool
+	MessagePool   workerpool.Pool
+	WritePool     workerpool.Pool
+	Config        *WebSocketConfig
+	Hub           *Hub
+	Authenticator Authenticator // JWTAuthenticator when Config.Auth is set
+
+	reads     *keyed.Executor[*Connection] // Serializes reads per connection on the MessagePool
+	heartbeat *heartbeat                   // Nil when disabled
 }
 
 func NewWebSocketServer(conf *WebSocketConfig, handler WebSocketHandler) *WebSocketServer {
@@ -63,20 +110,65 @@ func NewWebSocketServer(conf *WebSocketConfig, handler WebSocketHandler) *WebSoc
 		return nil
 	}
 
-	// Create an ants worker pool
-	pool, err := ants.NewPool(conf.Workers,
-		ants.WithPreAlloc(true),
-		ants.WithMaxBlockingTasks(conf.QueueSize),
-	)
+	// Accepts are short-lived, a fraction of the message workers is enough by default
+	acceptWorkers := conf.AcceptWorkers
+	if acceptWorkers <= 0 {
+		acceptWorkers = max(conf.Workers/10, 1)
+	}
+	acceptQueueSize := conf.AcceptQueueSize
+	if acceptQueueSize <= 0 {
+		acceptQueueSize = conf.QueueSize
+	}
+
+	var authenticator Authenticator
+	if conf.Auth != nil {
+		jwtAuth, err := NewJWTAuthenticator(conf.Auth)
+		if err != nil {
+			log.Printf("gobwas: %v", err)
+			return nil
+		}
+		authenticator = jwtAuth
+	}
+
+	// Create the ants worker pools
+	acceptPool, err := external.NewAnts(acceptWorkers, acceptQueueSize, ants.WithPreAlloc(true))
 	if err != nil {
 		return nil
 	}
 
+	messagePool, err := external.NewAnts(conf.Workers, conf.QueueSize, ants.WithPreAlloc(true))
+	if err != nil {
+		acceptPool.Shutdown(context.Background())
+		return nil
+	}
+
+	writeWorkers := conf.WriteWorkers
+	if writeWorkers <= 0 {
+		writeWorkers = conf.Workers
+	}
+	writeQueueSize := conf.WriteQueueSize
+	if writeQueueSize <= 0 {
+		writeQueueSize = conf.QueueSize
+	}
+
+	writePool, err := external.NewAnts(writeWorkers, writeQueueSize)
+	if err != nil {
+		acceptPool.Shutdown(context.Background())
+		messagePool.Shutdown(context.Background())
+		return nil
+	}
+
 	return &WebSocketServer{
-		Handler: handler,
-		Poller:  poller,
-		Config:  conf,
-		Pool:    pool,
+		Handler:       handler,
+		Poller:        poller,
+		Config:        conf,
+		AcceptPool:    acceptPool,
+		MessagePool:   messagePool,
+		WritePool:     writePool,
+		Hub:           NewHub(writePool, conf.MaxPendingWrites),
+		Authenticator: authenticator,
+		reads:         keyed.New[*Connection](messagePool),
+		heartbeat:     newHeartbeat(conf),
 	}
 }
 
@@ -112,6 +204,10 @@ func (s *WebSocketServer) Start(ctx context.Context, log logger.Zapper) error {
 		ln, netpoll.EventRead|netpoll.EventOneShot,
 	))
 
+	if s.heartbeat != nil {
+		go s.heartbeat.wheel.run(ctx, func(conn *Connection) { s.check(ctx, conn, log) })
+	}
+
 	accept := make(chan error, 1)
 	s.setupConnAcceptor(ctx, ln, acceptDesc, accept, log)
 
@@ -123,8 +219,12 @@ func (s *WebSocketServer) Start(ctx context.Context, log logger.Zapper) error {
 		} else {
 			log.Info(ctx, "WebSocket listener closed gracefully")
 		}
-		// Release the pool resources
-		s.Pool.Release()
+		// Let in-flight reads finish, then release the pool resources
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.Config.IOTimeout)
+		defer cancel()
+		s.AcceptPool.Shutdown(shutdownCtx)
+		s.MessagePool.Shutdown(shutdownCtx)
+		s.WritePool.Shutdown(shutdownCtx)
 	}()
 
 	return nil
@@ -190,7 +290,7 @@ func acceptConnection(ctx context.Context, s *WebSocketServer, ln net.Listener,
 
 		func() (interface{}, error) {
 
-			return nil, s.Pool.Submit(func() {
+			return nil, s.AcceptPool.Schedule(func() {
 
 				conn, err := ln.Accept()
 
@@ -216,9 +316,10 @@ func acceptConnection(ctx context.Context, s *WebSocketServer, ln net.Listener,
 }
 
 /*
- * handleConnection handles an incoming WebSocket connection. It upgrades the connection to a WebSocket,
- * logs the connection establishment, and invokes the handler's OnConnect method. If the connection is
- * accepted, it starts the connection poller to listen for incoming messages.
+ * handleConnection handles an incoming WebSocket connection. It authenticates and upgrades the connection
+ * to a WebSocket, logs the connection establishment, and invokes the handler's OnConnect method with the
+ * principal on the ctx. If the connection is accepted, it starts the connection poller to listen for
+ * incoming messages.
  *
  * Parameters:
  *   - ctx: The context to control the server's lifecycle.
@@ -228,7 +329,7 @@ func acceptConnection(ctx context.Context, s *WebSocketServer, ln net.Listener,
 func (s *WebSocketServer) handleConnection(ctx context.Context, conn net.Conn, log logger.Zapper) {
 	safeConn := &deadliner{conn, s.Config.IOTimeout}
 
-	hs, err := ws.Upgrade(safeConn)
+	hs, req, principal, err := s.upgrade(ctx, conn, safeConn)
 	if err != nil {
 		log.Errorf(ctx, "%s: upgrade error: %v", conn.RemoteAddr().String(), err)
 		closeConnection(conn)
@@ -237,14 +338,37 @@ func (s *WebSocketServer) handleConnection(ctx context.Context, conn net.Conn, l
 
 	log.Infof(ctx, "%s: established websocket connection: %+v", conn.RemoteAddr().String(), hs)
 
+	// Every handler call of this connection sees its principal
+	if principal != nil {
+		ctx = WithPrincipal(ctx, principal)
+	}
+
 	wsConn := NewConnection(s.Handler, safeConn)
+	wsConn.Request, wsConn.Principal = req, principal
+	wsConn.compress = negotiatedDeflate(hs)
+	desc := netpoll.Must(netpoll.HandleReadOnce(conn))
+	wsConn.close = func() { handleClose(ctx, s, desc, wsConn, conn) }
+
+	// Register first, so the handler can already push to the connection
+	s.Hub.register(wsConn)
 	if err := s.Handler.OnConnect(ctx, wsConn); err != nil {
 		log.Errorf(ctx, "handler rejected connection: %v", err)
+		s.Hub.unregister(wsConn)
+		wsConn.markClosed()
+		desc.Close()
 		closeConnection(conn)
 		return
 	}
 
-	desc := netpoll.Must(netpoll.HandleRead(conn))
+	// A failed push may have closed it already
+	if wsConn.IsClosed() {
+		return
+	}
+
+	// Watch before polling, so a close coming from the poller always finds the connection to forget
+	if s.heartbeat != nil {
+		s.heartbeat.watch(wsConn)
+	}
 	s.startConnectionPoller(ctx, desc, wsConn, conn, log)
 }
 
@@ -253,6 +377,10 @@ func (s *WebSocketServer) handleConnection(ctx context.Context, conn net.Conn, l
  * and schedules message reading tasks to be handled by the worker pool. If the connection is closed, it handles
  * the cleanup process.
  *
+ * The connection is polled one event at a time: after each read the descriptor is resumed, and as it is
+ * level-triggered, it fires again right away while data is waiting. A message arriving in several segments
+ * is therefore read once, instead of queuing a read per segment that would wait for data already consumed.
+ *
  * Parameters:
  *   - ctx: The context to control the server's lifecycle.
  *   - desc: The netpoll descriptor for the connection.
@@ -268,11 +396,22 @@ func (s *WebSocketServer) startConnectionPoller(ctx context.Context, desc *netpo
 			return
 		}
 
-		// Use ants pool for message handling
-		err := s.Pool.Submit(func() {
+		// Use the message pool, so reads never compete with accepts,
+		// keyed by connection, so its messages are handled in order
+		err := s.reads.Schedule(wsConn, func() {
 			if err := s.readMessage(ctx, wsConn); err != nil {
 				log.Errorf(ctx, "error reading message: %v", err)
 				handleClose(ctx, s, desc, wsConn, conn)
+				return
+			}
+
+			// The handler or the heartbeat may have closed it meanwhile
+			if wsConn.IsClosed() {
+				return
+			}
+			if err := s.Poller.Resume(desc); err != nil {
+				log.Errorf(ctx, "failed to resume polling: %v", err)
+				handleClose(ctx, s, desc, wsConn, conn)
 			}
 		})
 
@@ -284,8 +423,14 @@ func (s *WebSocketServer) startConnectionPoller(ctx context.Context, desc *netpo
 }
 
 /*
- * readMessage reads a message from the WebSocket connection. It handles different WebSocket opcodes
- * such as close, ping, and pong, and delegates message handling to the WebSocketHandler.
+ * readMessage reads a control frame or a whole data message from the WebSocket connection. Control frames
+ * (close, ping and pong) are handled here, so a lone pong never blocks the worker waiting for a message.
+ * Data messages are reassembled from their fragments, decompressed if needed, and handed to the topics and
+ * then to the WebSocketHandler. The fragments are read in the same worker, so the whole call has to be done
+ * within MessageTimeout: a client trickling a message holds a worker for that long at most.
+ *
+ * Messages over MaxMsgSize and frames over MaxFrameSize close the connection with 1009, before they are
+ * buffered; protocol violations close it with 1002 and invalid UTF-8 text with 1007.
  *
  * Parameters:
  *   - ctx: The context to control the server's lifecycle.
@@ -295,20 +440,66 @@ func (s *WebSocketServer) startConnectionPoller(ctx context.Context, desc *netpo
  *   - error: An error if reading the message fails or if the connection is closed by the client.
  */
 func (s *WebSocketServer) readMessage(ctx context.Context, conn *Connection) error {
-	msg, opCode, err := wsutil.ReadClientData(conn.Conn)
+	maxFrameSize := s.Config.MaxFrameSize
+	if maxFrameSize <= 0 {
+		maxFrameSize = s.Config.MaxMsgSize
+	}
 
+	messageTimeout := s.Config.MessageTimeout
+	if messageTimeout <= 0 {
+		messageTimeout = s.Config.IOTimeout
+	}
+
+	var source io.Reader = conn.Conn
+	if d, ok := conn.Conn.(*deadliner); ok && messageTimeout > 0 {
+		source = boundedReader{d, time.Now().Add(messageTimeout)}
+	}
+
+	var deflate wsflate.MessageState
+	rd := wsutil.Reader{
+		Source:       source,
+		State:        ws.StateServerSide,
+		MaxFrameSize: int64(max(maxFrameSize, 0)),
+		// Control frames between the fragments of a message
+		OnIntermediate: func(hdr ws.Header, payload io.Reader) error {
+			return handleControl(conn, hdr, payload)
+		},
+	}
+	if conn.compress {
+		rd.State |= ws.StateExtended
+		rd.Extensions = []wsutil.RecvExtension{&deflate}
+	}
+
+	hdr, err := rd.NextFrame()
 	if err != nil {
-		return fmt.Errorf("read message error: %w", err)
+		return failConnection(conn, err)
 	}
+	conn.touch()
 
-	switch opCode {
-	case ws.OpClose:
-		return fmt.Errorf("connection closed by client")
-	case ws.OpPing:
-		return conn.WritePong(msg)
-	case ws.OpPong:
-		return nil
+	if hdr.OpCode.IsControl() {
+		return handleControl(conn, hdr, &rd)
+	}
+
+	// Continuation frames are read through rd until the final one
+	var payload io.Reader = &rd
+	if deflate.IsCompressed() {
+		inflater := acquireInflater(&rd)
+		defer releaseInflater(inflater)
+		payload = inflater
+	}
+
+	msg, err := readLimited(payload, s.Config.MaxMsgSize)
+	if err != nil {
+		return failConnection(conn, err)
+	}
+	if hdr.OpCode == ws.OpText && !utf8.Valid(msg) {
+		return failConnection(conn, wsutil.ErrInvalidUTF8)
+	}
+	conn.active()
+
+	if handled, err := s.handleTopicMessage(ctx, conn, hdr.OpCode, msg); handled {
+		return err
 	}
 
-	return s.Handler.OnMessage(ctx, conn, opCode, msg)
+	return s.Handler.OnMessage(ctx, conn, hdr.OpCode, msg)
 }
@@ -0,0 +1,363 @@
+package gobwas
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"pkg/workerpool/external"
+	"pkg/workerpool/keyed"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/mailru/easygo/netpoll"
+)
+
+// recorder is a handler keeping the messages it gets.
+type recorder struct {
+	WebSocketHandlerImpl
+	messages chan []byte
+}
+
+func (r *recorder) OnMessage(_ context.Context, _ *Connection, _ ws.OpCode, data []byte) error {
+	r.messages <- data
+	return nil
+}
+
+// tcpPair returns both ends of a loopback TCP connection, closed at the end of the test.
+func tcpPair(t *testing.T) (server, client net.Conn) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	client, err = net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	server, err = ln.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	t.Cleanup(func() { client.Close(); server.Close() })
+
+	return server, client
+}
+
+// readPair returns a server reading the server side of a loopback TCP connection, and the client side.
+func readPair(t *testing.T, conf *WebSocketConfig, compress bool) (*WebSocketServer, *Connection, *recorder, net.Conn) {
+	t.Helper()
+
+	server, client := tcpPair(t)
+
+	if conf.IOTimeout == 0 {
+		conf.IOTimeout = time.Second
+	}
+
+	handler := &recorder{messages: make(chan []byte, 1)}
+	s := &WebSocketServer{Handler: handler, Config: conf}
+
+	conn := NewConnection(handler, &deadliner{server, conf.IOTimeout})
+	conn.compress = compress
+
+	return s, conn, handler, client
+}
+
+// writeFrames sends frames from the client, masked as clients must. Payloads are copied, masking is in place.
+func writeFrames(t *testing.T, client net.Conn, frames ...ws.Frame) {
+	t.Helper()
+
+	for _, frame := range frames {
+		frame.Payload = bytes.Clone(frame.Payload)
+		if err := ws.WriteFrame(client, ws.MaskFrameInPlace(frame)); err != nil {
+			t.Fatalf("write frame: %v", err)
+		}
+	}
+}
+
+// compressed returns payload deflated as permessage-deflate sends it, without the trailing empty block.
+func compressed(t *testing.T, payload []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := wsflate.NewWriter(&buf, func(w io.Writer) wsflate.Compressor {
+		fw, _ := flate.NewWriter(w, flate.BestSpeed)
+		return fw
+	})
+	if _, err := w.Write(payload); err != nil {
+		t.Fatalf("deflate: %v", err)
+	}
+	// Flush only: Close would end the stream with a final block the reader doesn't expect
+	if err := w.Flush(); err != nil {
+		t.Fatalf("deflate: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// withRsv1 marks the first frame of a compressed message.
+func withRsv1(frame ws.Frame) ws.Frame {
+	frame.Header.Rsv = ws.Rsv(true, false, false)
+	return frame
+}
+
+// readUntilMessage calls readMessage until the handler gets a message.
+func readUntilMessage(t *testing.T, s *WebSocketServer, conn *Connection, handler *recorder) []byte {
+	t.Helper()
+
+	for range 10 {
+		if err := s.readMessage(context.Background(), conn); err != nil {
+			t.Fatalf("readMessage: %v", err)
+		}
+
+		select {
+		case msg := <-handler.messages:
+			return msg
+		default:
+		}
+	}
+
+	t.Fatal("no message after 10 reads")
+	return nil
+}
+
+// readClose reads frames on the client until the close frame and returns its status.
+func readClose(t *testing.T, client net.Conn) ws.StatusCode {
+	t.Helper()
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		frame, err := ws.ReadFrame(client)
+		if err != nil {
+			t.Fatalf("read close: %v", err)
+		}
+		if frame.Header.OpCode == ws.OpClose {
+			status, _ := ws.ParseCloseFrameData(frame.Payload)
+			return status
+		}
+	}
+}
+
+func TestReadMessageRoundTrip(t *testing.T) {
+	large := []byte(strings.Repeat("price changed ", 100))
+	deflated := compressed(t, large)
+	third := len(deflated) / 3
+
+	tests := []struct {
+		name     string
+		compress bool
+		frames   []ws.Frame
+		want     []byte
+	}{
+		{"single frame", false, []ws.Frame{
+			ws.NewTextFrame([]byte("hello")),
+		}, []byte("hello")},
+
+		{"fragmented", false, []ws.Frame{
+			ws.NewFrame(ws.OpText, false, []byte("hel")),
+			ws.NewFrame(ws.OpContinuation, false, []byte("lo ")),
+			ws.NewFrame(ws.OpContinuation, true, []byte("world")),
+		}, []byte("hello world")},
+
+		{"compressed", true, []ws.Frame{
+			withRsv1(ws.NewFrame(ws.OpText, true, deflated)),
+		}, large},
+
+		{"compressed and fragmented", true, []ws.Frame{
+			withRsv1(ws.NewFrame(ws.OpText, false, deflated[:third])),
+			ws.NewFrame(ws.OpContinuation, false, deflated[third:2*third]),
+			ws.NewFrame(ws.OpContinuation, true, deflated[2*third:]),
+		}, large},
+
+		{"uncompressed on a compressed connection", true, []ws.Frame{
+			ws.NewTextFrame([]byte("hello")),
+		}, []byte("hello")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, conn, handler, client := readPair(t, &WebSocketConfig{MaxMsgSize: 4096}, test.compress)
+
+			writeFrames(t, client, test.frames...)
+
+			if msg := readUntilMessage(t, s, conn, handler); !bytes.Equal(msg, test.want) {
+				t.Errorf("message = %q, want %q", msg, test.want)
+			}
+		})
+	}
+}
+
+func TestReadMessageAnswersPingBetweenFragments(t *testing.T) {
+	s, conn, handler, client := readPair(t, &WebSocketConfig{}, false)
+
+	writeFrames(t, client,
+		ws.NewFrame(ws.OpText, false, []byte("hel")),
+		ws.NewPingFrame([]byte("are you there")),
+		ws.NewFrame(ws.OpContinuation, true, []byte("lo")),
+	)
+	readUntilMessage(t, s, conn, handler)
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	frame, err := ws.ReadFrame(client)
+	if err != nil {
+		t.Fatalf("read pong: %v", err)
+	}
+	if frame.Header.OpCode != ws.OpPong || string(frame.Payload) != "are you there" {
+		t.Errorf("got %v %q, want the pong", frame.Header.OpCode, frame.Payload)
+	}
+}
+
+func TestReadMessageRejectsOversize(t *testing.T) {
+	bomb := compressed(t, make([]byte, 64*1024))
+
+	tests := []struct {
+		name     string
+		conf     WebSocketConfig
+		compress bool
+		frames   []ws.Frame
+	}{
+		{"frame", WebSocketConfig{MaxMsgSize: 1024, MaxFrameSize: 16}, false, []ws.Frame{
+			ws.NewTextFrame(make([]byte, 17)),
+		}},
+		{"fragments", WebSocketConfig{MaxMsgSize: 16}, false, []ws.Frame{
+			ws.NewFrame(ws.OpBinary, false, make([]byte, 10)),
+			ws.NewFrame(ws.OpContinuation, true, make([]byte, 10)),
+		}},
+		{"decompressed", WebSocketConfig{MaxMsgSize: 1024}, true, []ws.Frame{
+			withRsv1(ws.NewFrame(ws.OpBinary, true, bomb)),
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, conn, handler, client := readPair(t, &test.conf, test.compress)
+
+			writeFrames(t, client, test.frames...)
+
+			err := s.readMessage(context.Background(), conn)
+			if !errors.Is(err, ErrMessageTooBig) && !errors.Is(err, wsutil.ErrFrameTooLarge) {
+				t.Fatalf("readMessage: err = %v, want too big", err)
+			}
+			if status := readClose(t, client); status != ws.StatusMessageTooBig {
+				t.Errorf("close status = %d, want 1009", status)
+			}
+
+			select {
+			case msg := <-handler.messages:
+				t.Errorf("handler got %d bytes of an oversize message", len(msg))
+			default:
+			}
+		})
+	}
+}
+
+func TestReadMessageBoundsTrickledMessage(t *testing.T) {
+	s, conn, _, client := readPair(t, &WebSocketConfig{IOTimeout: time.Second, MessageTimeout: 100 * time.Millisecond}, false)
+
+	// Each fragment comes well within the IOTimeout, the whole message never ends
+	stop := make(chan token)
+	defer close(stop)
+	go func() {
+		ws.WriteFrame(client, ws.MaskFrameInPlace(ws.NewFrame(ws.OpText, false, []byte("a"))))
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(20 * time.Millisecond):
+				ws.WriteFrame(client, ws.MaskFrameInPlace(ws.NewFrame(ws.OpContinuation, false, []byte("a"))))
+			}
+		}
+	}()
+
+	start := time.Now()
+	err := s.readMessage(context.Background(), conn)
+
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("readMessage: err = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("readMessage held the worker %s, want about the MessageTimeout", elapsed)
+	}
+}
+
+// pollRecorder is a recorder also reporting when the connection is closed.
+type pollRecorder struct {
+	recorder
+	closed chan token
+}
+
+func (r *pollRecorder) OnClose(context.Context, *Connection) {
+	close(r.closed)
+}
+
+func TestPollerReadsSegmentedMessageOnce(t *testing.T) {
+	conf := &WebSocketConfig{IOTimeout: 100 * time.Millisecond, MessageTimeout: 200 * time.Millisecond}
+
+	poller, err := netpoll.New(nil)
+	if err != nil {
+		t.Fatalf("netpoll: %v", err)
+	}
+	pool, err := external.NewAnts(2, 0)
+	if err != nil {
+		t.Fatalf("NewAnts: %v", err)
+	}
+
+	server, client := tcpPair(t)
+	desc := netpoll.Must(netpoll.HandleReadOnce(server))
+
+	handler := &pollRecorder{recorder{messages: make(chan []byte, 4)}, make(chan token)}
+	s := &WebSocketServer{Handler: handler, Config: conf, Poller: poller, Hub: NewHub(pool, 0), reads: keyed.New[*Connection](pool)}
+	conn := NewConnection(handler, &deadliner{server, conf.IOTimeout})
+	s.startConnectionPoller(context.Background(), desc, conn, server, testLogger{t: t})
+
+	receive := func(want string) {
+		t.Helper()
+		select {
+		case msg := <-handler.messages:
+			if string(msg) != want {
+				t.Fatalf("message = %q, want %q", msg, want)
+			}
+		case <-handler.closed:
+			t.Fatalf("connection closed waiting for %q", want)
+		case <-time.After(time.Second):
+			t.Fatalf("no message, want %q", want)
+		}
+	}
+
+	// A fragmented message, written a few bytes at a time so every segment raises an event
+	var buf bytes.Buffer
+	for _, frame := range []ws.Frame{
+		ws.NewFrame(ws.OpText, false, []byte("hello ")),
+		ws.NewFrame(ws.OpContinuation, true, []byte("world")),
+	} {
+		ws.WriteFrame(&buf, ws.MaskFrameInPlace(frame))
+	}
+	for segment := range slices.Chunk(buf.Bytes(), 3) {
+		if _, err := client.Write(segment); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	receive("hello world")
+
+	// A read queued per segment would wait for data already consumed, time out and close the connection
+	select {
+	case <-handler.closed:
+		t.Fatal("connection closed after a segmented message")
+	case <-time.After(3 * conf.MessageTimeout):
+	}
+
+	writeFrames(t, client, ws.NewTextFrame([]byte("again")))
+	receive("again")
+}
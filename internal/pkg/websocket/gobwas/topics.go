@@ -0,0 +1,93 @@
+package gobwas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/gobwas/ws"
+)
+
+/**
+ * Topics let clients subscribe to channels such as "product:42" or "orders:7" and receive
+ * whatever the server publishes to them. Every frame of the protocol is a JSON text message:
+ *
+ * 	client → server  {"type": "subscribe", "topic": "product:42"}
+ * 	                 {"type": "unsubscribe", "topic": "product:42"}
+ * 	server → client  {"type": "subscribed", "topic": "product:42"}
+ * 	                 {"type": "unsubscribed", "topic": "product:42"}
+ * 	                 {"type": "message", "topic": "product:42", "data": {"price": 10}}
+ * 	                 {"type": "error", "topic": "orders:7", "data": "not allowed"}
+ *
+ * Other messages reach the handler's OnMessage untouched. Subscriptions end with the connection.
+ */
+type Envelope struct {
+	Type  string          `json:"type"`
+	Topic string          `json:"topic,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// Envelope types.
+const (
+	TypeSubscribe    = "subscribe"
+	TypeUnsubscribe  = "unsubscribe"
+	TypeSubscribed   = "subscribed"
+	TypeUnsubscribed = "unsubscribed"
+	TypeMessage      = "message"
+	TypeError        = "error"
+)
+
+var ErrInvalidTopic = errors.New("invalid topic")
+
+// TopicAuthorizer can be implemented by a WebSocketHandler to decide who subscribes to what,
+// e.g. only the user itself to "orders:{userId}". Without it every subscription is allowed.
+type TopicAuthorizer interface {
+	AuthorizeSubscribe(ctx context.Context, conn *Connection, topic string) error
+}
+
+// Publish sends payload, marshalled to JSON, to the subscribers of topic and returns how many it went out to.
+func (s *WebSocketServer) Publish(topic string, payload any) (int, error) {
+	return s.Hub.Publish(topic, payload)
+}
+
+// handleTopicMessage handles subscribe and unsubscribe messages.
+// It reports false for any other message, which is left to the handler.
+// It runs on a message worker, so replies go through the Hub and are written on the write pool.
+func (s *WebSocketServer) handleTopicMessage(ctx context.Context, conn *Connection, opCode ws.OpCode, msg []byte) (bool, error) {
+	if opCode != ws.OpText {
+		return false, nil
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal(msg, &envelope); err != nil {
+		return false, nil
+	}
+
+	switch envelope.Type {
+	case TypeSubscribe:
+		if err := s.subscribe(ctx, conn, envelope.Topic); err != nil {
+			return true, s.Hub.reply(conn, TypeError, envelope.Topic, err.Error())
+		}
+		return true, s.Hub.reply(conn, TypeSubscribed, envelope.Topic, nil)
+
+	case TypeUnsubscribe:
+		s.Hub.Unsubscribe(conn, envelope.Topic)
+		return true, s.Hub.reply(conn, TypeUnsubscribed, envelope.Topic, nil)
+	}
+
+	return false, nil
+}
+
+func (s *WebSocketServer) subscribe(ctx context.Context, conn *Connection, topic string) error {
+	if topic == "" {
+		return ErrInvalidTopic
+	}
+
+	if authorizer, ok := s.Handler.(TopicAuthorizer); ok {
+		if err := authorizer.AuthorizeSubscribe(ctx, conn, topic); err != nil {
+			return err
+		}
+	}
+
+	return s.Hub.Subscribe(conn, topic)
+}
@@ -0,0 +1,204 @@
+package gobwas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"pkg/workerpool/external"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+func TestSubscribeRepliesFromBusyMessagePool(t *testing.T) {
+	messagePool, err := external.NewAnts(1, 1)
+	if err != nil {
+		t.Fatalf("NewAnts: %v", err)
+	}
+	writePool, err := external.NewAnts(1, 1)
+	if err != nil {
+		t.Fatalf("NewAnts: %v", err)
+	}
+
+	s := &WebSocketServer{
+		Handler:     NewWebSocketHander(),
+		MessagePool: messagePool,
+		WritePool:   writePool,
+		Hub:         NewHub(writePool, 0),
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := NewConnection(s.Handler, server)
+	s.Hub.register(conn)
+
+	// The subscription is handled by the only message worker, as readMessage would
+	handled := make(chan error, 1)
+	err = s.MessagePool.Schedule(func() {
+		_, err := s.handleTopicMessage(context.Background(), conn, ws.OpText, []byte(`{"type":"subscribe","topic":"product:42"}`))
+		handled <- err
+	})
+	if err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+
+	select {
+	case err := <-handled:
+		if err != nil {
+			t.Fatalf("handleTopicMessage: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscribe reply waited on the message pool")
+	}
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	msg, err := wsutil.ReadServerText(client)
+	if err != nil {
+		t.Fatalf("read reply: %v", err)
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal(msg, &envelope); err != nil {
+		t.Fatalf("reply %q: %v", msg, err)
+	}
+	if envelope.Type != TypeSubscribed || envelope.Topic != "product:42" {
+		t.Errorf("reply = %+v, want subscribed to product:42", envelope)
+	}
+	if n := s.Hub.Subscribers("product:42"); n != 1 {
+		t.Errorf("Subscribers = %d, want 1", n)
+	}
+}
+
+// readEnvelope waits for the next message read by a readingConnection's client and decodes it.
+func readEnvelope(t *testing.T, received <-chan string) Envelope {
+	t.Helper()
+
+	msg := receive(t, received)
+
+	var envelope Envelope
+	if err := json.Unmarshal([]byte(msg), &envelope); err != nil {
+		t.Fatalf("message %q: %v", msg, err)
+	}
+	return envelope
+}
+
+func TestPublishReachesOnlySubscribers(t *testing.T) {
+	pool, err := external.NewAnts(2, 8)
+	if err != nil {
+		t.Fatalf("NewAnts: %v", err)
+	}
+	hub := NewHub(pool, 0)
+
+	first, firstReceived := readingConnection(t, hub)
+	second, secondReceived := readingConnection(t, hub)
+	other, otherReceived := readingConnection(t, hub)
+	hub.Subscribe(first, "product:42")
+	hub.Subscribe(second, "product:42")
+	hub.Subscribe(other, "product:7")
+
+	sent, err := hub.Publish("product:42", map[string]int{"price": 10})
+	if err != nil || sent != 2 {
+		t.Fatalf("Publish = %d, %v; want 2, nil", sent, err)
+	}
+
+	for _, received := range []<-chan string{firstReceived, secondReceived} {
+		envelope := readEnvelope(t, received)
+		if envelope.Type != TypeMessage || envelope.Topic != "product:42" || string(envelope.Data) != `{"price":10}` {
+			t.Errorf("message = %+v (data %s), want the price on product:42", envelope, envelope.Data)
+		}
+	}
+
+	select {
+	case msg := <-otherReceived:
+		t.Errorf("subscriber of another topic received %q", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if sent, err := hub.Publish("product:1", "nobody"); err != nil || sent != 0 {
+		t.Errorf("Publish without subscribers = %d, %v; want 0, nil", sent, err)
+	}
+}
+
+// denyingHandler only lets connections subscribe to public topics.
+type denyingHandler struct {
+	WebSocketHandlerImpl
+}
+
+var errNotAllowed = errors.New("not allowed")
+
+func (*denyingHandler) AuthorizeSubscribe(_ context.Context, _ *Connection, topic string) error {
+	if !strings.HasPrefix(topic, "public:") {
+		return errNotAllowed
+	}
+	return nil
+}
+
+func TestTopicAuthorizerRejectionRepliesError(t *testing.T) {
+	pool, err := external.NewAnts(1, 8)
+	if err != nil {
+		t.Fatalf("NewAnts: %v", err)
+	}
+	s := &WebSocketServer{Handler: &denyingHandler{}, Hub: NewHub(pool, 0)}
+	conn, received := readingConnection(t, s.Hub)
+
+	tests := []struct {
+		msg   string
+		reply Envelope
+	}{
+		{`{"type":"subscribe","topic":"orders:7"}`, Envelope{Type: TypeError, Topic: "orders:7", Data: json.RawMessage(`"not allowed"`)}},
+		{`{"type":"subscribe","topic":""}`, Envelope{Type: TypeError, Data: json.RawMessage(`"invalid topic"`)}},
+		{`{"type":"subscribe","topic":"public:news"}`, Envelope{Type: TypeSubscribed, Topic: "public:news"}},
+	}
+
+	for _, test := range tests {
+		handled, err := s.handleTopicMessage(context.Background(), conn, ws.OpText, []byte(test.msg))
+		if !handled || err != nil {
+			t.Fatalf("handleTopicMessage(%s) = %v, %v; want handled", test.msg, handled, err)
+		}
+
+		reply := readEnvelope(t, received)
+		if reply.Type != test.reply.Type || reply.Topic != test.reply.Topic || string(reply.Data) != string(test.reply.Data) {
+			t.Errorf("reply to %s = %+v (data %s), want %+v (data %s)", test.msg, reply, reply.Data, test.reply, test.reply.Data)
+		}
+	}
+
+	if n := s.Hub.Subscribers("orders:7"); n != 0 {
+		t.Errorf("Subscribers(orders:7) = %d after a rejection, want 0", n)
+	}
+	if n := s.Hub.Subscribers("public:news"); n != 1 {
+		t.Errorf("Subscribers(public:news) = %d, want 1", n)
+	}
+}
+
+func TestClosedConnectionLeavesTopics(t *testing.T) {
+	s, conn, handler, _ := polledPair(t, &WebSocketConfig{})
+
+	for _, topic := range []string{"product:42", "product:7"} {
+		if err := s.Hub.Subscribe(conn, topic); err != nil {
+			t.Fatalf("Subscribe %s: %v", topic, err)
+		}
+	}
+
+	conn.Close()
+	select {
+	case <-handler.closed:
+	case <-time.After(time.Second):
+		t.Fatal("OnClose not called")
+	}
+
+	for _, topic := range []string{"product:42", "product:7"} {
+		if n := s.Hub.Subscribers(topic); n != 0 {
+			t.Errorf("Subscribers(%s) = %d after close, want 0", topic, n)
+		}
+	}
+
+	s.Hub.mutex.RLock()
+	defer s.Hub.mutex.RUnlock()
+	if len(s.Hub.subs) != 0 || len(s.Hub.topics) != 0 {
+		t.Errorf("subs = %v, topics = %v after close, want both empty", s.Hub.subs, s.Hub.topics)
+	}
+}
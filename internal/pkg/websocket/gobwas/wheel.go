@@ -0,0 +1,105 @@
+package gobwas
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/**
+ * timerWheel fires per-connection timeouts from a single goroutine, whatever the number of connections.
+ *
+ * Time is cut in ticks and every slot of the wheel holds the connections due at that tick.
+ * Scheduling and cancelling are O(1); a timeout fires up to one tick late. The wheel has enough
+ * slots for the longest timeout it is given, so connections never go around it more than once.
+ */
+type timerWheel struct {
+	tick time.Duration
+
+	mutex  sync.Mutex
+	slots  []map[*Connection]token
+	slotOf map[*Connection]int // Slot of each scheduled connection
+	pos    int                 // Slot of the current tick
+}
+
+// newTimerWheel creates a wheel firing every tick, able to hold timeouts up to longest.
+func newTimerWheel(tick, longest time.Duration) *timerWheel {
+	slots := make([]map[*Connection]token, int(longest/tick)+2)
+	for i := range slots {
+		slots[i] = make(map[*Connection]token)
+	}
+
+	return &timerWheel{
+		tick:   tick,
+		slots:  slots,
+		slotOf: make(map[*Connection]int),
+	}
+}
+
+// schedule fires conn after the given duration, replacing its previous timeout.
+func (w *timerWheel) schedule(conn *Connection, after time.Duration) {
+	ticks := int((after + w.tick - 1) / w.tick)
+	ticks = min(max(ticks, 1), len(w.slots)-1)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.remove(conn)
+	slot := (w.pos + ticks) % len(w.slots)
+	w.slots[slot][conn] = token{}
+	w.slotOf[conn] = slot
+}
+
+// cancel drops the timeout of conn.
+func (w *timerWheel) cancel(conn *Connection) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.remove(conn)
+}
+
+// remove must be called with the mutex held.
+func (w *timerWheel) remove(conn *Connection) {
+	if slot, ok := w.slotOf[conn]; ok {
+		delete(w.slots[slot], conn)
+		delete(w.slotOf, conn)
+	}
+}
+
+// advance moves to the next tick and returns the connections due.
+func (w *timerWheel) advance() []*Connection {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.pos = (w.pos + 1) % len(w.slots)
+	slot := w.slots[w.pos]
+	if len(slot) == 0 {
+		return nil
+	}
+
+	due := make([]*Connection, 0, len(slot))
+	for conn := range slot {
+		due = append(due, conn)
+		delete(w.slotOf, conn)
+	}
+	w.slots[w.pos] = make(map[*Connection]token)
+
+	return due
+}
+
+// run fires the due connections every tick until ctx is done.
+func (w *timerWheel) run(ctx context.Context, fire func(*Connection)) {
+	ticker := time.NewTicker(w.tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, conn := range w.advance() {
+				fire(conn)
+			}
+		}
+	}
+}
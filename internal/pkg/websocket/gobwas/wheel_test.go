@@ -0,0 +1,66 @@
+package gobwas
+
+import (
+	"testing"
+	"time"
+)
+
+// advanceBy moves the wheel ticks forward, as the ticker of run would, and returns the connections due on the last one.
+func advanceBy(w *timerWheel, ticks int) []*Connection {
+	var due []*Connection
+	for range ticks {
+		due = w.advance()
+	}
+	return due
+}
+
+func TestTimerWheelFiresOnDeadline(t *testing.T) {
+	w := newTimerWheel(10*time.Millisecond, 100*time.Millisecond)
+	conn := &Connection{}
+
+	// Rounded up to the next tick
+	w.schedule(conn, 25*time.Millisecond)
+
+	if due := advanceBy(w, 2); len(due) != 0 {
+		t.Fatalf("fired after 2 ticks, want 3")
+	}
+	if due := w.advance(); len(due) != 1 || due[0] != conn {
+		t.Fatalf("due = %v after 3 ticks, want the connection", due)
+	}
+	if due := advanceBy(w, len(w.slots)); len(due) != 0 {
+		t.Fatalf("fired again a full turn later")
+	}
+}
+
+func TestTimerWheelReschedulesAndCancels(t *testing.T) {
+	w := newTimerWheel(10*time.Millisecond, 100*time.Millisecond)
+	moved, cancelled := &Connection{}, &Connection{}
+
+	w.schedule(moved, 20*time.Millisecond)
+	w.schedule(cancelled, 20*time.Millisecond)
+	w.schedule(moved, 50*time.Millisecond)
+	w.cancel(cancelled)
+
+	if due := advanceBy(w, 4); len(due) != 0 {
+		t.Fatalf("due = %v before the new deadline", due)
+	}
+	if due := w.advance(); len(due) != 1 || due[0] != moved {
+		t.Fatalf("due = %v after 5 ticks, want the rescheduled connection", due)
+	}
+}
+
+func TestTimerWheelClampsTimeouts(t *testing.T) {
+	w := newTimerWheel(10*time.Millisecond, 100*time.Millisecond)
+	late, past := &Connection{}, &Connection{}
+
+	// A deadline already passed fires on the next tick, one beyond the wheel on its last slot
+	w.schedule(past, -time.Second)
+	w.schedule(late, time.Hour)
+
+	if due := w.advance(); len(due) != 1 || due[0] != past {
+		t.Fatalf("due = %v on the next tick, want the passed deadline", due)
+	}
+	if due := advanceBy(w, len(w.slots)-2); len(due) != 1 || due[0] != late {
+		t.Fatalf("due = %v on the last slot, want the clamped timeout", due)
+	}
+}
@@ -0,0 +1,296 @@
+package batch
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Executor runs batch handlers, e.g. a fixed or adaptive worker pool.
+type Executor interface {
+	Schedule(task func()) error
+}
+
+// Handler processes one batch of items added under the same key, in the order they were added.
+type Handler[K comparable, T any] func(ctx context.Context, key K, items []T) error
+
+// ErrorHandler is called with the batches that failed or could not be scheduled.
+type ErrorHandler[K comparable, T any] func(ctx context.Context, key K, items []T, err error)
+
+// Option configures optional behaviour of the batcher.
+type Option[K comparable, T any] func(*Batcher[K, T])
+
+// WithErrorHandler replaces the default error handler, which logs the failure.
+func WithErrorHandler[K comparable, T any](onError ErrorHandler[K, T]) Option[K, T] {
+	return func(b *Batcher[K, T]) {
+		b.onError = onError
+	}
+}
+
+// keyState holds the batches of one key.
+type keyState[T any] struct {
+	items      []T         // Batch being filled
+	generation uint64      // Incremented whenever a batch is cut, invalidates older timers
+	timer      *time.Timer // Flushes the batch being filled after maxWait
+	ready      [][]T       // Cut batches not handled yet, the head is being handled while claimed
+	claimed    bool        // Set while a drain loop is handling the batches of this key
+}
+
+/**
+ * Batcher groups items by key and hands them to a handler in batches.
+ *
+ * A batch is flushed once it holds maxItems items or maxWait after its first item was added,
+ * whichever comes first. Batches of different keys are handled concurrently on the executor;
+ * batches of the same key are handled one at a time, in the order they were cut, so items of a key
+ * are always processed in the order they were added.
+ *
+ * Every batch cut while no drain loop is handling its key is handed to the executor with a loop of its own;
+ * the first loop of the key to start handles all its batches. A loop the executor discards without running
+ * it, e.g. under the DropOldest policy, therefore only delays its batch until the key's next loop, which
+ * Flush and Close hand over for every key left with batches. Batches whose loop is refused are reported
+ * to the error handler.
+ *
+ * 	batcher := batch.New(pool, 100, 50*time.Millisecond,
+ * 		func(ctx context.Context, sku string, updates []StockUpdate) error {
+ * 			return saveStock(ctx, sku, updates)
+ * 		})
+ *
+ * 	batcher.Add(update.SKU, update)
+ */
+type Batcher[K comparable, T any] struct {
+	executor Executor
+	handler  Handler[K, T]
+	onError  ErrorHandler[K, T]
+	maxItems int
+	maxWait  time.Duration
+
+	mutex   sync.Mutex
+	keys    map[K]*keyState[T]
+	pending sync.WaitGroup // Cut batches not handled yet
+	closed  bool
+	ctx     context.Context    // Context handed to the handler, cancelled by Close once its deadline passes
+	cancel  context.CancelFunc // Cancels ctx
+}
+
+// New creates a batcher flushing batches of at most maxItems items, at most maxWait after
+// their first item. A maxWait <= 0 only flushes full batches (and on Flush or Close).
+func New[K comparable, T any](executor Executor, maxItems int, maxWait time.Duration, handler Handler[K, T], opts ...Option[K, T]) *Batcher[K, T] {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b := &Batcher[K, T]{
+		executor: executor,
+		handler:  handler,
+		maxItems: max(maxItems, 1),
+		maxWait:  maxWait,
+		keys:     make(map[K]*keyState[T]),
+		ctx:      ctx,
+		cancel:   cancel,
+		onError: func(_ context.Context, key K, items []T, err error) {
+			log.Printf("batch: %d items of key %v failed: %v", len(items), key, err)
+		},
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// Add appends an item to the batch of key, flushing the batch if it is full.
+// Returns ErrBatcherClosed once Close has been called.
+func (b *Batcher[K, T]) Add(key K, item T) error {
+	b.mutex.Lock()
+
+	if b.closed {
+		b.mutex.Unlock()
+		return ErrBatcherClosed
+	}
+
+	state, ok := b.keys[key]
+	if !ok {
+		state = &keyState[T]{}
+		b.keys[key] = state
+	}
+
+	state.items = append(state.items, item)
+
+	if len(state.items) == 1 && b.maxWait > 0 && len(state.items) < b.maxItems {
+		generation := state.generation
+		state.timer = time.AfterFunc(b.maxWait, func() { b.flushExpired(key, generation) })
+	}
+
+	dispatch := len(state.items) >= b.maxItems && b.cut(state)
+
+	b.mutex.Unlock()
+
+	if dispatch {
+		b.dispatch(key)
+	}
+
+	return nil
+}
+
+// Flush cuts every partially filled batch and waits until all batches have been handled or ctx is done.
+// Keys whose batches no drain loop is handling get a new one, in case the executor discarded theirs.
+func (b *Batcher[K, T]) Flush(ctx context.Context) error {
+	b.mutex.Lock()
+
+	var dispatch []K
+	for key, state := range b.keys {
+		if len(state.items) > 0 {
+			b.cut(state)
+		}
+		if len(state.ready) > 0 && !state.claimed {
+			dispatch = append(dispatch, key)
+		}
+	}
+
+	b.mutex.Unlock()
+
+	for _, key := range dispatch {
+		b.dispatch(key)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		b.pending.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting items and flushes what is left, waiting until ctx is done.
+// If ctx ends first, the handler's context is cancelled and ctx.Err() is returned.
+func (b *Batcher[K, T]) Close(ctx context.Context) error {
+	b.mutex.Lock()
+	b.closed = true
+	b.mutex.Unlock()
+
+	err := b.Flush(ctx)
+	b.cancel()
+	return err
+}
+
+// flushExpired cuts the batch of key if it is still the one the timer was started for.
+func (b *Batcher[K, T]) flushExpired(key K, generation uint64) {
+	b.mutex.Lock()
+
+	state, ok := b.keys[key]
+	if !ok || state.generation != generation || len(state.items) == 0 {
+		b.mutex.Unlock()
+		return
+	}
+
+	dispatch := b.cut(state)
+	b.mutex.Unlock()
+
+	if dispatch {
+		b.dispatch(key)
+	}
+}
+
+// cut closes the batch being filled and queues it. It reports whether a drain loop has to be
+// handed to the executor, i.e. no loop is handling the key. Must be called with the mutex held.
+func (b *Batcher[K, T]) cut(state *keyState[T]) bool {
+	state.ready = append(state.ready, state.items)
+	state.items = nil
+	state.generation++
+	if state.timer != nil {
+		state.timer.Stop()
+		state.timer = nil
+	}
+
+	b.pending.Add(1)
+	return !state.claimed
+}
+
+// dispatch hands a drain loop for key to the executor. Workers never schedule on the executor
+// themselves, so a full executor that blocks Schedule can't deadlock the batcher.
+// If the executor refuses the loop, the batches no loop has claimed meanwhile fail.
+func (b *Batcher[K, T]) dispatch(key K) {
+	err := b.executor.Schedule(func() { b.drain(key) })
+	if err == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	state, ok := b.keys[key]
+	if !ok || state.claimed {
+		b.mutex.Unlock()
+		return
+	}
+
+	failed := state.ready
+	state.ready = nil
+	if len(state.items) == 0 {
+		delete(b.keys, key)
+	}
+	b.mutex.Unlock()
+
+	for _, items := range failed {
+		b.onError(b.ctx, key, items, err)
+		b.pending.Done()
+	}
+}
+
+// drain claims key and handles its batches until none are left.
+// It returns right away if another loop has claimed the key or its batches have been handled.
+func (b *Batcher[K, T]) drain(key K) {
+	b.mutex.Lock()
+	state, ok := b.keys[key]
+	if !ok || state.claimed || len(state.ready) == 0 {
+		b.mutex.Unlock()
+		return
+	}
+	state.claimed = true
+	items := state.ready[0]
+	b.mutex.Unlock()
+
+	for items != nil {
+		if err := b.handle(key, items); err != nil {
+			b.onError(b.ctx, key, items, err)
+		}
+		items = b.next(key, state)
+	}
+}
+
+// handle runs the handler, turning a panic into an error so the key isn't left claimed forever.
+func (b *Batcher[K, T]) handle(key K, items []T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r}
+		}
+	}()
+
+	return b.handler(b.ctx, key, items)
+}
+
+// next marks the batch at the head of the key's queue as handled and returns the following one,
+// or releases the key and returns nil if there is none.
+func (b *Batcher[K, T]) next(key K, state *keyState[T]) []T {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.pending.Done()
+
+	state.ready[0] = nil
+	state.ready = state.ready[1:]
+	if len(state.ready) > 0 {
+		return state.ready[0]
+	}
+
+	state.claimed = false
+	if len(state.items) == 0 {
+		delete(b.keys, key)
+	}
+
+	return nil
+}
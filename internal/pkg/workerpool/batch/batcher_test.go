@@ -0,0 +1,226 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	fixed "pkg/workerpool/custom/fixed"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatcherFlushesFullBatchesInOrder(t *testing.T) {
+	pool := fixed.NewPool(4, 4, 4)
+	defer pool.Close()
+
+	var (
+		mutex   sync.Mutex
+		batches = make(map[string][][]int)
+	)
+
+	batcher := New(pool, 3, time.Hour, func(_ context.Context, key string, items []int) error {
+		mutex.Lock()
+		batches[key] = append(batches[key], items)
+		mutex.Unlock()
+		return nil
+	})
+
+	for i := range 7 {
+		batcher.Add("a", i)
+	}
+	batcher.Add("b", 0)
+
+	if err := batcher.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	want := [][]int{{0, 1, 2}, {3, 4, 5}, {6}}
+	if got := batches["a"]; !slices.EqualFunc(got, want, slices.Equal) {
+		t.Fatalf("batches of a = %v, want %v", got, want)
+	}
+	if got := batches["b"]; len(got) != 1 || !slices.Equal(got[0], []int{0}) {
+		t.Fatalf("batches of b = %v, want [[0]]", got)
+	}
+
+	if err := batcher.Add("a", 8); !errors.Is(err, ErrBatcherClosed) {
+		t.Fatalf("Add after Close: err = %v, want ErrBatcherClosed", err)
+	}
+}
+
+func TestBatcherFlushesAfterMaxWait(t *testing.T) {
+	pool := fixed.NewPool(1, 1, 1)
+	defer pool.Close()
+
+	flushed := make(chan []int, 1)
+	batcher := New(pool, 100, 10*time.Millisecond, func(_ context.Context, _ string, items []int) error {
+		flushed <- items
+		return nil
+	})
+	defer batcher.Close(context.Background())
+
+	batcher.Add("a", 1)
+	batcher.Add("a", 2)
+
+	select {
+	case items := <-flushed:
+		if !slices.Equal(items, []int{1, 2}) {
+			t.Fatalf("flushed %v, want [1 2]", items)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("partial batch was not flushed after maxWait")
+	}
+}
+
+func TestBatcherDoesNotDeadlockOnFullExecutor(t *testing.T) {
+	// A single worker with a blocking queue of one: a worker scheduling the next batch itself would hang
+	pool := fixed.NewPool(1, 1, 1)
+	defer pool.Close()
+
+	var (
+		mutex   sync.Mutex
+		handled = make(map[string][]int)
+	)
+
+	batcher := New(pool, 1, 0, func(_ context.Context, key string, items []int) error {
+		time.Sleep(time.Millisecond)
+		mutex.Lock()
+		handled[key] = append(handled[key], items...)
+		mutex.Unlock()
+		return nil
+	})
+
+	var waitGroup sync.WaitGroup
+	for _, key := range []string{"a", "b", "c"} {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for i := range 10 {
+				batcher.Add(key, i)
+			}
+		}()
+	}
+	waitGroup.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := batcher.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		if got := handled[key]; !slices.Equal(got, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}) {
+			t.Errorf("items of %s = %v, want 0..9 in order", key, got)
+		}
+	}
+}
+
+func TestBatcherReportsFailedBatches(t *testing.T) {
+	pool := fixed.NewPool(1, 1, 1)
+	defer pool.Close()
+
+	failed := make(chan error, 2)
+	batcher := New(pool, 1, 0,
+		func(_ context.Context, _ string, items []int) error {
+			if items[0] == 0 {
+				panic("boom")
+			}
+			return errors.New("failed")
+		},
+		WithErrorHandler(func(_ context.Context, _ string, _ []int, err error) { failed <- err }),
+	)
+
+	batcher.Add("a", 0)
+	batcher.Add("a", 1)
+	if err := batcher.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	var panicErr *PanicError
+	if err := <-failed; !errors.As(err, &panicErr) {
+		t.Fatalf("first error = %v, want a *PanicError", err)
+	}
+	if err := <-failed; err == nil || err.Error() != "failed" {
+		t.Fatalf("second error = %v, want the handler's error", err)
+	}
+}
+
+// droppingExecutor silently discards the first drain loops, as a pool under the DropOldest policy may,
+// and runs the following ones.
+type droppingExecutor struct {
+	mutex sync.Mutex
+	drop  int
+}
+
+func (e *droppingExecutor) Schedule(task func()) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.drop > 0 {
+		e.drop--
+		return nil
+	}
+	go task()
+	return nil
+}
+
+func TestBatcherRecoversDiscardedDrain(t *testing.T) {
+	var (
+		mutex   sync.Mutex
+		handled []int
+	)
+
+	batcher := New(&droppingExecutor{drop: 2}, 1, 0, func(_ context.Context, _ string, items []int) error {
+		mutex.Lock()
+		handled = append(handled, items...)
+		mutex.Unlock()
+		return nil
+	})
+
+	// The loops of both batches are lost
+	batcher.Add("a", 1)
+	batcher.Add("a", 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := batcher.Close(ctx); err != nil {
+		t.Fatalf("Close: %v, want the batches handled by a new loop", err)
+	}
+
+	if !slices.Equal(handled, []int{1, 2}) {
+		t.Errorf("handled %v, want [1 2]", handled)
+	}
+}
+
+func TestBatcherReportsRefusedDrain(t *testing.T) {
+	pool := fixed.NewPool(1, 1, 1)
+	pool.Close()
+
+	var failed []int
+	batcher := New(pool, 1, 0,
+		func(context.Context, string, []int) error {
+			t.Error("refused batch handled")
+			return nil
+		},
+		WithErrorHandler(func(_ context.Context, _ string, items []int, err error) {
+			if !errors.Is(err, fixed.ErrPoolClosed) {
+				t.Errorf("error = %v, want ErrPoolClosed", err)
+			}
+			failed = append(failed, items...)
+		}),
+	)
+
+	batcher.Add("a", 1)
+	batcher.Add("a", 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := batcher.Close(ctx); err != nil {
+		t.Fatalf("Close: %v, want refused batches counted as done", err)
+	}
+
+	if !slices.Equal(failed, []int{1, 2}) {
+		t.Errorf("failed %v, want [1 2]", failed)
+	}
+}
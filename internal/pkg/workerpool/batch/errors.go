@@ -0,0 +1,17 @@
+package batch
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrBatcherClosed = errors.New("batcher closed")
+
+// PanicError is reported to the error handler when the batch handler panics.
+type PanicError struct {
+	Value any
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("batch handler panicked: %v", e.Value)
+}
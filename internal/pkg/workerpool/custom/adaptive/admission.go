@@ -0,0 +1,177 @@
+package workerpool
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ResourceUsage is the share of the container's (or host's) limits currently in use.
+// 1 means the limit is reached.
+type ResourceUsage struct {
+	CPU    float64 // CPU time used over the last sampling interval, relative to the CPU quota
+	Memory float64 // Working set memory, relative to the memory limit
+}
+
+// ResourceSampler measures resource usage. CPU usage is measured between consecutive calls.
+type ResourceSampler interface {
+	Sample() (ResourceUsage, error)
+}
+
+// AdmissionPolicy holds back the adaptive pool when the container is close to its limits.
+// Zero values are replaced with the defaults noted on each field.
+//
+// While under pressure:
+//   - the pool doesn't scale above minWorkers, tasks queue up for the running workers instead
+//   - ScheduleLowPriority blocks until usage drops back below the thresholds
+type AdmissionPolicy struct {
+	MaxCPU    float64         // CPU usage above which the pool is under pressure (default 0.85)
+	MaxMemory float64         // Memory usage above which the pool is under pressure (default 0.90)
+	Interval  time.Duration   // How often usage is sampled (default 1s)
+	Sampler   ResourceSampler // Source of measurements (default NewSystemSampler)
+}
+
+// withDefaults returns a copy of the policy with zero fields set to their default values.
+func (a *AdmissionPolicy) withDefaults() *AdmissionPolicy {
+	policy := *a
+	a = &policy
+
+	if a.MaxCPU <= 0 {
+		a.MaxCPU = 0.85
+	}
+	if a.MaxMemory <= 0 {
+		a.MaxMemory = 0.90
+	}
+	if a.Interval <= 0 {
+		a.Interval = time.Second
+	}
+	if a.Sampler == nil {
+		a.Sampler = NewSystemSampler()
+	}
+
+	return a
+}
+
+// WithAdmissionPolicy makes the pool's scaling and low-priority admission depend on resource usage.
+func WithAdmissionPolicy(policy *AdmissionPolicy) Option {
+	return func(p *Pool) {
+		p.resources = &resourceGuard{policy: policy.withDefaults()}
+	}
+}
+
+// resourceGuard tracks whether the container is under resource pressure.
+type resourceGuard struct {
+	policy   *AdmissionPolicy
+	pressure atomic.Bool
+	usage    atomic.Pointer[ResourceUsage] // Latest sample, nil until the first one succeeds
+	mutex    sync.Mutex
+	relief   chan token // Closed and replaced when pressure ends
+	logOnce  sync.Once
+}
+
+// underPressure reports whether resource usage was above the thresholds at the last sample.
+// A nil guard is never under pressure.
+func (g *resourceGuard) underPressure() bool {
+	return g != nil && g.pressure.Load()
+}
+
+// reliefSignal returns a channel closed once the current pressure ends.
+func (g *resourceGuard) reliefSignal() <-chan token {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.relief
+}
+
+// sample measures usage once and updates the pressure state.
+// It reports whether the pressure just ended.
+func (g *resourceGuard) sample() bool {
+	usage, err := g.policy.Sampler.Sample()
+	if err != nil {
+		// Without measurements the pool behaves as if no policy was set
+		g.logOnce.Do(func() { log.Printf("workerpool: resource sampling unavailable: %v", err) })
+		usage = ResourceUsage{}
+	} else {
+		g.usage.Store(&usage)
+	}
+
+	pressure := usage.CPU >= g.policy.MaxCPU || usage.Memory >= g.policy.MaxMemory
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.pressure.Swap(pressure) && !pressure {
+		close(g.relief)
+		g.relief = make(chan token)
+		return true
+	}
+
+	return false
+}
+
+// monitorResources samples resource usage until the pool's context is cancelled.
+func (p *Pool) monitorResources() {
+	g := p.resources
+	g.relief = make(chan token)
+	g.sample()
+
+	go func() {
+		ticker := time.NewTicker(g.policy.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if g.sample() {
+					// Scale up for the tasks that queued up while the pool was held back
+					for i := p.QueueDepth(); i > 0 && p.tryStartWorker(); i-- {
+					}
+				}
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// ResourceUsage returns the latest resource measurement and whether the pool is under pressure.
+// The usage is zero if the pool has no admission policy or nothing could be measured yet.
+func (p *Pool) ResourceUsage() (ResourceUsage, bool) {
+	if p.resources == nil {
+		return ResourceUsage{}, false
+	}
+
+	var usage ResourceUsage
+	if latest := p.resources.usage.Load(); latest != nil {
+		usage = *latest
+	}
+
+	return usage, p.resources.underPressure()
+}
+
+// ScheduleLowPriority adds a task that can wait for resources to free up.
+// While the container is under pressure, it blocks until the pressure ends before queuing the task.
+// Without an admission policy it behaves like Schedule.
+// Returns ErrPoolClosed if the pool is shutting down.
+func (p *Pool) ScheduleLowPriority(task task) error {
+	if p.resources == nil {
+		return p.Schedule(task)
+	}
+
+	for {
+		// Take the signal before checking, so a relief in between isn't missed
+		relief := p.resources.reliefSignal()
+		if !p.resources.underPressure() {
+			break
+		}
+
+		select {
+		case <-relief:
+		case <-p.closing:
+			return p.rejected(ErrPoolClosed)
+		}
+	}
+
+	return p.Schedule(task)
+}
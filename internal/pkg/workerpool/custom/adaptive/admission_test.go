@@ -0,0 +1,164 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSampler reports the usage set by the test, or err if set.
+type fakeSampler struct {
+	usage atomic.Pointer[ResourceUsage]
+	err   error
+}
+
+func newFakeSampler(usage ResourceUsage) *fakeSampler {
+	s := &fakeSampler{}
+	s.set(usage)
+	return s
+}
+
+func (s *fakeSampler) set(usage ResourceUsage) {
+	s.usage.Store(&usage)
+}
+
+func (s *fakeSampler) Sample() (ResourceUsage, error) {
+	return *s.usage.Load(), s.err
+}
+
+// newGuardedPool returns a pool of 1 to 4 workers sampling the given sampler every few milliseconds.
+func newGuardedPool(t *testing.T, sampler ResourceSampler) *Pool {
+	t.Helper()
+
+	pool := NewPoolWithAutoScale(4, 1, 10, time.Minute, WithAdmissionPolicy(&AdmissionPolicy{
+		Sampler:  sampler,
+		Interval: 5 * time.Millisecond,
+	}))
+	t.Cleanup(pool.Close)
+
+	return pool
+}
+
+// eventually fails the test if condition doesn't hold within a second.
+func eventually(t *testing.T, condition func() bool, format string, args ...any) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPressureHoldsPoolAtMinimum(t *testing.T) {
+	sampler := newFakeSampler(ResourceUsage{Memory: 0.95})
+	pool := newGuardedPool(t, sampler)
+
+	if usage, pressure := pool.ResourceUsage(); !pressure || usage.Memory != 0.95 {
+		t.Fatalf("ResourceUsage = %+v, %v, want memory 0.95 under pressure", usage, pressure)
+	}
+
+	release := make(chan token)
+	var started atomic.Int32
+	for range 4 {
+		if err := pool.Schedule(func() {
+			started.Add(1)
+			<-release
+		}); err != nil {
+			t.Fatalf("Schedule: %v", err)
+		}
+	}
+
+	// Under pressure the tasks queue up for the minimum worker instead of scaling the pool
+	eventually(t, func() bool { return started.Load() == 1 }, "started = %d, want 1", started.Load())
+	if active, depth := pool.ActiveWorkerCount(), pool.QueueDepth(); active != 1 || depth != 3 {
+		t.Fatalf("active = %d, queued = %d under pressure, want 1 and 3", active, depth)
+	}
+
+	// Once the pressure ends the pool scales up for the queued tasks
+	sampler.set(ResourceUsage{})
+	eventually(t, func() bool { return started.Load() == 4 }, "started = %d after relief, want 4", started.Load())
+
+	if active := pool.ActiveWorkerCount(); active != 4 {
+		t.Fatalf("active = %d after relief, want 4", active)
+	}
+
+	close(release)
+}
+
+func TestScheduleLowPriorityWaitsForRelief(t *testing.T) {
+	sampler := newFakeSampler(ResourceUsage{CPU: 0.9})
+	pool := newGuardedPool(t, sampler)
+
+	ran := make(chan token)
+	scheduled := make(chan error, 1)
+	go func() {
+		scheduled <- pool.ScheduleLowPriority(func() { close(ran) })
+	}()
+
+	select {
+	case err := <-scheduled:
+		t.Fatalf("ScheduleLowPriority returned %v under pressure", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sampler.set(ResourceUsage{CPU: 0.5})
+
+	select {
+	case err := <-scheduled:
+		if err != nil {
+			t.Fatalf("ScheduleLowPriority: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ScheduleLowPriority still blocked after relief")
+	}
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("low priority task didn't run")
+	}
+}
+
+func TestScheduleLowPriorityReturnsOnShutdown(t *testing.T) {
+	pool := newGuardedPool(t, newFakeSampler(ResourceUsage{Memory: 1}))
+
+	scheduled := make(chan error, 1)
+	go func() {
+		scheduled <- pool.ScheduleLowPriority(func() { t.Error("task ran after shutdown") })
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if _, err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	select {
+	case err := <-scheduled:
+		if !errors.Is(err, ErrPoolClosed) {
+			t.Fatalf("ScheduleLowPriority: err = %v, want ErrPoolClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ScheduleLowPriority still blocked after shutdown")
+	}
+}
+
+func TestFailingSamplerDisablesPressure(t *testing.T) {
+	sampler := newFakeSampler(ResourceUsage{Memory: 1})
+	sampler.err = errors.New("no cgroup")
+	pool := newGuardedPool(t, sampler)
+
+	if usage, pressure := pool.ResourceUsage(); pressure || usage != (ResourceUsage{}) {
+		t.Fatalf("ResourceUsage = %+v, %v, want no usage and no pressure", usage, pressure)
+	}
+
+	done := make(chan token)
+	if err := pool.ScheduleLowPriority(func() { close(done) }); err != nil {
+		t.Fatalf("ScheduleLowPriority: %v", err)
+	}
+	<-done
+}
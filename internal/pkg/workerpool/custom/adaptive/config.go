@@ -0,0 +1,40 @@
+package workerpool
+
+import (
+	"log"
+	"pkg/workerpool"
+	"time"
+)
+
+// PoolConfig holds configuration for the adaptive worker pool
+type PoolConfig struct {
+	MaxWorkers      int           `mapstructure:"maxWorkers" validate:"required"`
+	MinWorkers      int           `mapstructure:"minWorkers"`
+	QueueSize       int           `mapstructure:"queueSize" validate:"required"`
+	IdleTimeout     time.Duration `mapstructure:"idleTimeout" validate:"required"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdownTimeout"`
+	OverflowPolicy  string        `mapstructure:"overflowPolicy" validate:"omitempty,oneof=block reject drop-oldest caller-runs"`
+}
+
+// NewPoolFromConfig creates an adaptive pool sized according to conf.
+// An unknown overflow policy falls back to workerpool.Block; opts are applied after the configuration.
+func NewPoolFromConfig(conf *PoolConfig, opts ...Option) *Pool {
+	if policy, err := workerpool.ParseOverflowPolicy(conf.OverflowPolicy); err != nil {
+		log.Printf("workerpool: %v, falling back to %s", err, workerpool.Block)
+	} else {
+		opts = append([]Option{WithOverflowPolicy(policy)}, opts...)
+	}
+
+	return NewPoolWithAutoScale(conf.MaxWorkers, conf.MinWorkers, conf.QueueSize, conf.IdleTimeout, opts...)
+}
+
+// Reconfigure applies the worker limits and idle timeout of conf to a running pool,
+// e.g. after a configuration reload. The queue size and overflow policy cannot be changed without recreating the pool.
+func (p *Pool) Reconfigure(conf *PoolConfig) error {
+	if err := p.Resize(conf.MinWorkers, conf.MaxWorkers); err != nil {
+		return err
+	}
+
+	p.SetIdleTimeout(conf.IdleTimeout)
+	return nil
+}
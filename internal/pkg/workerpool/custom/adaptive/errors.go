@@ -0,0 +1,14 @@
+package workerpool
+
+import (
+	"errors"
+	"pkg/workerpool"
+)
+
+var (
+	ErrPoolClosed           = workerpool.ErrPoolClosed
+	ErrScheduleTimeout      = workerpool.ErrScheduleTimeout
+	ErrQueueFull            = workerpool.ErrQueueFull
+	ErrInvalidPoolSize      = errors.New("invalid pool size")
+	ErrResourcesUnsupported = errors.New("resource sampling not supported on this platform")
+)
@@ -1,7 +1,11 @@
 package workerpool
 
 import (
-	"errors"
+	"context"
+	"log"
+	"pkg/workerpool"
+	"pkg/workerpool/telemetry"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -9,15 +13,29 @@ import (
 
 // Pool implements an adaptive worker pool pattern for goroutine reuse.
 // It dynamically scales between minimum and maximum worker counts based on load.
+// Both bounds and the idle timeout can be changed while the pool is running.
 type Pool struct {
-	maxWorkers    int        // Maximum number of workers allowed
-	minWorkers    int        // Minimum number of workers to maintain
-	queue         chan task  // Queue for pending tasks
-	semaphore     chan token // Semaphore to control worker count
+	maxWorkers    int       // Maximum number of workers allowed, guarded by mutex
+	minWorkers    int       // Minimum number of workers to maintain, guarded by mutex
+	queue         chan task // Queue for pending tasks
 	waitGroup     sync.WaitGroup
-	activeWorkers int32         // Current number of active workers (atomic)
-	idleTimeout   time.Duration // How long workers stay idle before terminating
-	mutex         sync.Mutex    // For coordinating worker count operations
+	activeWorkers int32              // Current number of active workers, changed under mutex and read atomically
+	idleTimeout   int64              // How long workers stay idle before terminating, a time.Duration (atomic)
+	mutex         sync.Mutex         // For coordinating worker count operations
+	resized       atomic.Value       // chan token closed whenever the limits or idle timeout change
+	ctx           context.Context    // Context handed to context-aware tasks, cancelled on Close
+	cancel        context.CancelFunc // Cancels ctx
+	onTimeout     TimeoutHandler     // Called when a task exceeds its budget, may be nil
+	admission     sync.RWMutex       // Held by Schedule calls, lets Shutdown wait for them to finish
+	closing       chan token         // Closed when the pool stops admitting tasks
+	drain         chan token         // Closed once no more tasks can be queued, workers exit when the queue is empty
+	abort         chan token         // Closed when the shutdown deadline passes, workers stop picking up tasks
+	closeOnce     sync.Once
+	abortOnce     sync.Once
+	metrics       *telemetry.Metrics // Exported pool metrics, nil when disabled
+	resources     *resourceGuard     // Resource-aware admission, nil when disabled
+
+	overflow workerpool.Overflow // What Schedule does when the queue is full at the worker limit
 }
 
 // Simplified type aliases for better readability
@@ -33,148 +51,328 @@ type (
 //   - minWorkers: Minimum number of workers to maintain (even when idle)
 //   - queueSize: Maximum number of tasks that can wait in the queue
 //   - idleTimeout: How long workers stay idle before terminating (if above minWorkers)
+//   - opts: Optional behaviour such as WithTimeoutHandler
 //
 // The pool will scale between minWorkers and maxWorkers based on load.
-func NewPoolWithAutoScale(maxWorkers, minWorkers, queueSize int, idleTimeout time.Duration) *Pool {
+func NewPoolWithAutoScale(maxWorkers, minWorkers, queueSize int, idleTimeout time.Duration, opts ...Option) *Pool {
 	// Ensure minimum workers doesn't exceed maximum
 	minWorkers = min(minWorkers, maxWorkers)
 
+	ctx, cancel := context.WithCancel(context.Background())
+
 	pool := &Pool{
 		maxWorkers:    maxWorkers,
 		minWorkers:    minWorkers,
 		queue:         make(chan task, queueSize),
-		semaphore:     make(chan token, maxWorkers),
-		idleTimeout:   idleTimeout,
+		idleTimeout:   int64(idleTimeout),
 		activeWorkers: 0,
+		ctx:           ctx,
+		cancel:        cancel,
+		closing:       make(chan token),
+		drain:         make(chan token),
+		abort:         make(chan token),
+	}
+	pool.resized.Store(make(chan token))
+
+	for _, opt := range opts {
+		opt(pool)
+	}
+
+	pool.overflow.Queue = pool.queue
+	pool.overflow.Closing = pool.closing
+	pool.overflow.Running = &pool.waitGroup
+	pool.overflow.RunTask = pool.runTask
+	pool.overflow.Rejected = pool.rejected
+	pool.overflow.Dropped = func() { pool.metrics.Rejected(pool.ctx, telemetry.ReasonDropped) }
+
+	pool.metrics.Observe(pool.QueueDepth, pool.ActiveWorkerCount)
+
+	if pool.resources != nil {
+		pool.monitorResources()
 	}
 
 	// Initialize minimum workers upfront
 	for i := 0; i < minWorkers; i++ {
-		pool.startPermanentWorker()
+		pool.tryStartWorker()
 	}
 
 	return pool
 }
 
+// Resize changes the minimum and maximum worker counts of a running pool.
+// Missing minimum workers are started right away. Surplus workers finish the task
+// they are running and then exit; queued tasks are left untouched.
+// Lowering the minimum retires the idle workers above it that have been idle for the idle timeout
+// right away, and the others once they reach it.
+// minWorkers is capped at maxWorkers, as in NewPoolWithAutoScale.
+// Returns ErrInvalidPoolSize if maxWorkers is not positive or minWorkers is negative.
+func (p *Pool) Resize(minWorkers, maxWorkers int) error {
+	if maxWorkers <= 0 || minWorkers < 0 {
+		return ErrInvalidPoolSize
+	}
+	minWorkers = min(minWorkers, maxWorkers)
+
+	p.mutex.Lock()
+	p.minWorkers = minWorkers
+	p.maxWorkers = maxWorkers
+	missing := minWorkers - int(atomic.LoadInt32(&p.activeWorkers))
+	p.mutex.Unlock()
+
+	for i := 0; i < missing; i++ {
+		p.tryStartWorker()
+	}
+
+	// Wake up idle workers so surplus ones exit without waiting for their idle timeout
+	p.notifyResize()
+	return nil
+}
+
+// SetIdleTimeout changes how long workers above the minimum stay idle before terminating.
+// Idle workers pick up the new timeout right away, counting the time they have already been idle.
+func (p *Pool) SetIdleTimeout(idleTimeout time.Duration) {
+	atomic.StoreInt64(&p.idleTimeout, int64(idleTimeout))
+	p.notifyResize()
+}
+
+// Limits returns the current minimum and maximum worker counts.
+func (p *Pool) Limits() (minWorkers, maxWorkers int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.minWorkers, p.maxWorkers
+}
+
+// IdleTimeout returns how long workers above the minimum stay idle before terminating.
+func (p *Pool) IdleTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.idleTimeout))
+}
+
+// notifyResize wakes up every worker waiting for a task, so they re-evaluate the pool limits.
+func (p *Pool) notifyResize() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	close(p.resized.Load().(chan token))
+	p.resized.Store(make(chan token))
+}
+
 // Schedule adds a task to be executed by the worker pool.
 // It prioritizes starting new workers rather than queuing tasks,
-// until reaching the maximum worker count.
-func (p *Pool) Schedule(task task) {
-	// First try to start a new worker if below max capacity
-	select {
-	case p.semaphore <- token{}:
-		// Worker slot acquired, start a new adaptive worker
-		p.startAdaptiveWorker()
-		// Send task directly to queue
-		p.queue <- task
-		return
-	default:
-		// At max workers, try to queue the task
-		select {
-		case p.queue <- task:
-			// Task queued successfully
-			return
-		default:
-			// Queue is full, block until space is available
-			p.queue <- task
-		}
+// until reaching the maximum worker count. Once the queue is full as well,
+// the overflow policy decides: by default it blocks until the queue has space.
+// Returns ErrPoolClosed if the pool is shutting down and ErrQueueFull if the Reject policy turns the task down.
+func (p *Pool) Schedule(task task) error {
+	return p.overflow.Complete(task, p.schedule(task))
+}
+
+// schedule queues a task under the admission lock, applying the overflow policy without a timeout.
+func (p *Pool) schedule(task task) error {
+	p.admission.RLock()
+	defer p.admission.RUnlock()
+
+	if p.isClosing() {
+		return p.rejected(ErrPoolClosed)
+	}
+
+	if p.offer(task) {
+		return nil
 	}
+
+	return p.overflow.Apply(task, nil)
 }
 
 // ScheduleTimeout attempts to schedule a task with a timeout.
 // It prioritizes starting new workers rather than queuing tasks.
-// Returns ErrScheduleTimeout if the task couldn't be scheduled within the timeout.
+// Returns ErrScheduleTimeout if the Block policy couldn't queue the task within the timeout
+// and ErrPoolClosed if the pool is shutting down. Other policies behave as in Schedule.
 func (p *Pool) ScheduleTimeout(timeout time.Duration, task task) error {
-	// First try to start a new worker if below max capacity
+	return p.overflow.Complete(task, p.scheduleTimeout(timeout, task))
+}
+
+// scheduleTimeout queues a task under the admission lock, giving the Block policy up to timeout.
+func (p *Pool) scheduleTimeout(timeout time.Duration, task task) error {
+	p.admission.RLock()
+	defer p.admission.RUnlock()
+
+	if p.isClosing() {
+		return p.rejected(ErrPoolClosed)
+	}
+
+	if p.offer(task) {
+		return nil
+	}
+
+	return p.overflow.ApplyTimeout(task, timeout)
+}
+
+// offer starts a new worker if below max capacity and queues the task if there is room.
+// It reports whether the task was queued.
+func (p *Pool) offer(task task) bool {
+	p.tryStartWorker()
+
 	select {
-	case p.semaphore <- token{}:
-		// Worker slot acquired, start a new adaptive worker
-		p.startAdaptiveWorker()
-		// Send task directly to queue
-		p.queue <- task
+	case p.queue <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// TrySchedule adds a task only if it can be queued right away, starting a worker if below the maximum.
+// It never blocks and returns ErrQueueFull if the queue is full
+// and ErrPoolClosed if the pool is shutting down.
+func (p *Pool) TrySchedule(task task) error {
+	p.admission.RLock()
+	defer p.admission.RUnlock()
+
+	if p.isClosing() {
+		return p.rejected(ErrPoolClosed)
+	}
+
+	p.tryStartWorker()
+
+	select {
+	case p.queue <- task:
 		return nil
 	default:
-		// At max workers, try to queue the task with timeout
-		select {
-		case p.queue <- task:
-			// Task queued successfully
-			return nil
-		case <-time.After(timeout):
-			return errors.New("ErrScheduleTimeout")
-		}
+		return p.rejected(ErrQueueFull)
 	}
 }
 
-// startPermanentWorker launches a worker that never terminates until pool closure.
-// These form the minimum worker set that's always available.
-func (p *Pool) startPermanentWorker() {
-	p.waitGroup.Add(1)
-	atomic.AddInt32(&p.activeWorkers, 1)
+// isClosing reports whether the pool has stopped admitting tasks.
+func (p *Pool) isClosing() bool {
+	select {
+	case <-p.closing:
+		return true
+	default:
+		return false
+	}
+}
 
-	go func() {
-		defer p.waitGroup.Done()
-		defer atomic.AddInt32(&p.activeWorkers, -1)
-		defer func() { <-p.semaphore }() // Release worker slot when done
+// tryStartWorker starts a new worker if the pool is below its maximum worker count,
+// or below its minimum while an admission policy reports resource pressure.
+// It reports whether a worker was started.
+func (p *Pool) tryStartWorker() bool {
+	p.mutex.Lock()
+	limit := p.maxWorkers
+	if p.resources.underPressure() {
+		// Don't add load to a container close to its limits, only keep the minimum running
+		limit = max(p.minWorkers, 1)
+	}
 
-		// Acquire semaphore slot
-		p.semaphore <- token{}
+	if atomic.LoadInt32(&p.activeWorkers) >= int32(limit) {
+		p.mutex.Unlock()
+		return false
+	}
+	atomic.AddInt32(&p.activeWorkers, 1)
+	p.mutex.Unlock()
 
-		// Process tasks indefinitely until queue is closed
-		for task := range p.queue {
-			task()
-		}
-	}()
+	p.metrics.ScaledUp(p.ctx)
+	p.startWorker()
+	return true
 }
 
-// startAdaptiveWorker launches a worker that can terminate after being idle.
-// These form the dynamic part of the worker pool that scales based on load.
-func (p *Pool) startAdaptiveWorker() {
+// startWorker launches a worker that scales down after being idle.
+// Workers up to minWorkers never terminate until pool shutdown, the others exit once
+// they have been idle for idleTimeout or when the pool shrinks below their count.
+// The idle time is kept across limit changes: once the minimum is lowered, workers that have
+// been idle for longer than the timeout exit right away, the others once they reach it.
+// The caller must have counted the worker in activeWorkers; it is released when the worker exits.
+func (p *Pool) startWorker() {
 	p.waitGroup.Add(1)
-	atomic.AddInt32(&p.activeWorkers, 1)
 
 	go func() {
 		defer p.waitGroup.Done()
-		defer atomic.AddInt32(&p.activeWorkers, -1)
-		defer func() { <-p.semaphore }() // Release worker slot when done
 
+		idleSince := time.Now()
+		waited := false // The previous wait ended without a task
 		for {
-			// Wait for a task or timeout
+			// Stop picking up tasks once the shutdown deadline has passed
 			select {
-			case task, ok := <-p.queue:
-				if !ok {
-					// Queue is closed, terminate worker
-					return
-				}
+			case <-p.abort:
+				p.releaseWorker()
+				return
+			default:
+			}
+
+			// Load the signal before checking the limits, so a change in between isn't missed
+			resized := p.resized.Load().(chan token)
 
-				// Execute the task
-				task()
+			// Past its idle timeout, a worker only stays for the minimum and waits for a task or a limit change
+			expired := waited && p.IdleTimeout() <= time.Since(idleSince)
+			if p.retireWorker(expired) {
+				return
+			}
+			idle := time.NewTimer(p.IdleTimeout() - time.Since(idleSince))
+			if expired {
+				idle.Stop() // Since Go 1.23 a stopped timer never delivers
+			}
 
-			case <-time.After(p.idleTimeout):
-				// Check if we're above minimum worker count
-				if p.canTerminateWorker() {
-					return // Terminate this worker
+			// Wait for a task, a limit change or timeout
+			waited = true
+			select {
+			case task := <-p.queue:
+				idle.Stop()
+				p.runTask(task)
+				idleSince, waited = time.Now(), false
+
+			case <-p.drain:
+				idle.Stop()
+				select {
+				case task := <-p.queue:
+					p.runTask(task)
+					idleSince, waited = time.Now(), false
+				default:
+					p.releaseWorker()
+					return // Queue drained
 				}
+
+			case <-p.abort:
+				idle.Stop()
+				p.releaseWorker()
+				return
+
+			case <-resized:
+				idle.Stop()
+
+			case <-idle.C:
 			}
 		}
 	}()
 }
 
-// canTerminateWorker determines if a worker can terminate based on minimum requirements.
-// Uses lock to ensure accurate counting during rapid scale-down.
-func (p *Pool) canTerminateWorker() bool {
+// retireWorker terminates the calling worker's slot if the pool has more workers than allowed:
+// more than maxWorkers, or more than minWorkers when the worker is idle.
+// Counting and decrementing under the same lock keeps concurrent terminations from
+// scaling the pool below its minimum.
+func (p *Pool) retireWorker(idle bool) bool {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	currentWorkers := atomic.LoadInt32(&p.activeWorkers)
+	limit := p.maxWorkers
+	if idle {
+		limit = p.minWorkers
+	}
 
-	// Only terminate if we're above minimum worker count
-	if currentWorkers > int32(p.minWorkers) {
+	// Only terminate if we're above the limit
+	if atomic.LoadInt32(&p.activeWorkers) > int32(limit) {
+		atomic.AddInt32(&p.activeWorkers, -1)
+		p.metrics.ScaledDown(p.ctx)
 		return true
 	}
 
 	return false
 }
 
+// releaseWorker gives up the calling worker's slot on shutdown.
+func (p *Pool) releaseWorker() {
+	p.mutex.Lock()
+	atomic.AddInt32(&p.activeWorkers, -1)
+	p.mutex.Unlock()
+
+	p.metrics.ScaledDown(p.ctx)
+}
+
 // QueueDepth returns the current number of tasks in the queue
 func (p *Pool) QueueDepth() int {
 	return len(p.queue)
@@ -185,11 +383,93 @@ func (p *Pool) ActiveWorkerCount() int {
 	return int(atomic.LoadInt32(&p.activeWorkers))
 }
 
-// Close gracefully shuts down the pool by closing the queue and waiting for all workers to finish.
-// No new tasks should be scheduled after calling Close.
+// Stats returns a snapshot of the pool's workers and queue.
+func (p *Pool) Stats() workerpool.Stats {
+	_, maxWorkers := p.Limits()
+
+	return workerpool.Stats{
+		ActiveWorkers: p.ActiveWorkerCount(),
+		MaxWorkers:    maxWorkers,
+		QueueDepth:    p.QueueDepth(),
+		QueueSize:     cap(p.queue),
+	}
+}
+
+// runTask executes a task, recovering from a panic so the worker survives it.
+// The panic and its stack trace are logged, as there is no caller to return them to.
+func (p *Pool) runTask(task task) {
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("workerpool: task panicked: %v\n%s", r, debug.Stack())
+			p.metrics.TaskPanicked(p.ctx, start)
+		}
+	}()
+
+	task()
+	p.metrics.TaskDone(p.ctx, start, nil)
+}
+
+// Shutdown stops admitting tasks and waits for queued and running tasks to finish.
+// Schedule calls made afterwards, or still blocked on a full queue, return ErrPoolClosed.
+//
+// If ctx is done before the pool has drained, the context of running context-aware tasks
+// is cancelled, queued tasks are discarded and Shutdown returns their number along with ctx.Err().
+func (p *Pool) Shutdown(ctx context.Context) (int, error) {
+	p.closeOnce.Do(func() {
+		close(p.closing)
+
+		// Wait for Schedule calls that passed the closing check, so nothing is queued after this point
+		p.admission.Lock()
+		p.admission.Unlock()
+
+		close(p.drain)
+
+		// Make sure someone drains the queue, even if every worker has scaled down
+		if len(p.queue) > 0 {
+			p.tryStartWorker()
+		}
+	})
+
+	finished := make(chan token)
+	go func() {
+		p.waitGroup.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		p.cancel()
+		p.metrics.Close()
+		return 0, nil
+	case <-ctx.Done():
+		p.cancel()
+		p.abortOnce.Do(func() { close(p.abort) })
+		dropped := p.discardQueued()
+		p.metrics.Close()
+		return dropped, ctx.Err()
+	}
+}
+
+// discardQueued empties the queue without running the tasks and returns how many were dropped.
+func (p *Pool) discardQueued() int {
+	dropped := 0
+	for {
+		select {
+		case <-p.queue:
+			dropped++
+		default:
+			return dropped
+		}
+	}
+}
+
+// Close shuts down the pool and waits for all workers to finish.
+// The context of context-aware tasks is cancelled first, so running and queued ones can bail out early.
+// Tasks scheduled after Close are rejected with ErrPoolClosed.
 func (p *Pool) Close() {
-	close(p.queue)
-	p.waitGroup.Wait()
+	p.cancel()
+	p.Shutdown(context.Background())
 }
 
 // min returns the smaller of two integers
@@ -0,0 +1,166 @@
+package workerpool
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runOnEveryWorker runs one task on each of n idle workers, so they all start a new idle period.
+func runOnEveryWorker(t *testing.T, pool *Pool, n int) {
+	t.Helper()
+
+	var started sync.WaitGroup
+	started.Add(n)
+	release := make(chan token)
+	for range n {
+		if err := pool.Schedule(func() {
+			started.Done()
+			<-release
+		}); err != nil {
+			t.Fatalf("Schedule: %v", err)
+		}
+	}
+
+	started.Wait()
+	close(release)
+	eventually(t, func() bool { return pool.QueueDepth() == 0 }, "tasks still queued")
+}
+
+func TestResize(t *testing.T) {
+	pool := NewPoolWithAutoScale(4, 1, 0, time.Minute)
+	defer pool.Close()
+
+	for _, limits := range [][2]int{{0, 0}, {-1, 2}} {
+		if err := pool.Resize(limits[0], limits[1]); !errors.Is(err, ErrInvalidPoolSize) {
+			t.Errorf("Resize(%d, %d): err = %v, want ErrInvalidPoolSize", limits[0], limits[1], err)
+		}
+	}
+
+	// Missing minimum workers start right away
+	if err := pool.Resize(3, 4); err != nil {
+		t.Fatalf("Resize: %v", err)
+	}
+	if active := pool.ActiveWorkerCount(); active != 3 {
+		t.Fatalf("active = %d after raising the minimum, want 3", active)
+	}
+
+	// The minimum is capped at the maximum, surplus idle workers exit
+	pool.Resize(5, 2)
+	if minWorkers, maxWorkers := pool.Limits(); minWorkers != 2 || maxWorkers != 2 {
+		t.Fatalf("Limits = %d, %d, want 2, 2", minWorkers, maxWorkers)
+	}
+	eventually(t, func() bool { return pool.ActiveWorkerCount() == 2 }, "active = %d, want 2", pool.ActiveWorkerCount())
+
+	// Busy workers finish their task before exiting
+	release := make(chan token)
+	var running sync.WaitGroup
+	running.Add(2)
+	for range 2 {
+		pool.Schedule(func() {
+			running.Done()
+			<-release
+		})
+	}
+	running.Wait()
+
+	pool.Resize(0, 1)
+	time.Sleep(20 * time.Millisecond)
+	if active := pool.ActiveWorkerCount(); active != 2 {
+		t.Fatalf("active = %d while both workers are busy, want 2", active)
+	}
+
+	close(release)
+	eventually(t, func() bool { return pool.ActiveWorkerCount() == 1 }, "active = %d once the tasks are done, want 1", pool.ActiveWorkerCount())
+}
+
+func TestLoweringMinimumRetiresLongIdleWorkers(t *testing.T) {
+	const idleTimeout = 200 * time.Millisecond
+
+	pool := NewPoolWithAutoScale(4, 4, 0, idleTimeout)
+	defer pool.Close()
+
+	// The workers have been idle past the timeout, kept only by the minimum
+	time.Sleep(idleTimeout + 50*time.Millisecond)
+
+	lowered := time.Now()
+	pool.Resize(1, 4)
+	eventually(t, func() bool { return pool.ActiveWorkerCount() == 1 }, "active = %d, want 1", pool.ActiveWorkerCount())
+
+	if elapsed := time.Since(lowered); elapsed >= idleTimeout {
+		t.Errorf("workers retired after %s, want right away", elapsed)
+	}
+}
+
+func TestLoweringMinimumWaitsForIdleTimeout(t *testing.T) {
+	const idleTimeout = 200 * time.Millisecond
+
+	pool := NewPoolWithAutoScale(2, 2, 0, idleTimeout)
+	defer pool.Close()
+
+	// Both workers were just busy: they only retire once idle for the timeout
+	runOnEveryWorker(t, pool, 2)
+	lowered := time.Now()
+	pool.Resize(0, 2)
+
+	time.Sleep(idleTimeout / 2)
+	if active := pool.ActiveWorkerCount(); active != 2 {
+		t.Fatalf("active = %d before the idle timeout, want 2", active)
+	}
+
+	eventually(t, func() bool { return pool.ActiveWorkerCount() == 0 }, "active = %d after the idle timeout, want 0", pool.ActiveWorkerCount())
+	if elapsed := time.Since(lowered); elapsed < idleTimeout/2 {
+		t.Errorf("workers retired after %s, want about %s", elapsed, idleTimeout)
+	}
+}
+
+func TestSetIdleTimeout(t *testing.T) {
+	pool := NewPoolWithAutoScale(2, 0, 0, time.Hour)
+	defer pool.Close()
+
+	runOnEveryWorker(t, pool, 1)
+	if active := pool.ActiveWorkerCount(); active != 1 {
+		t.Fatalf("active = %d, want 1", active)
+	}
+
+	// The idle worker picks up the shorter timeout without waiting for the hour
+	pool.SetIdleTimeout(20 * time.Millisecond)
+	if timeout := pool.IdleTimeout(); timeout != 20*time.Millisecond {
+		t.Fatalf("IdleTimeout = %s, want 20ms", timeout)
+	}
+	eventually(t, func() bool { return pool.ActiveWorkerCount() == 0 }, "active = %d, want the idle worker gone", pool.ActiveWorkerCount())
+
+	// Minimum workers stay, however short the timeout
+	pool.Resize(1, 2)
+	time.Sleep(50 * time.Millisecond)
+	if active := pool.ActiveWorkerCount(); active != 1 {
+		t.Fatalf("active = %d, want the minimum worker kept", active)
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	pool := NewPoolFromConfig(&PoolConfig{MaxWorkers: 2, MinWorkers: 1, QueueSize: 4, IdleTimeout: time.Minute})
+	defer pool.Close()
+
+	if err := pool.Reconfigure(&PoolConfig{MaxWorkers: 3, MinWorkers: 2, IdleTimeout: 5 * time.Second}); err != nil {
+		t.Fatalf("Reconfigure: %v", err)
+	}
+	if minWorkers, maxWorkers := pool.Limits(); minWorkers != 2 || maxWorkers != 3 {
+		t.Errorf("Limits = %d, %d, want 2, 3", minWorkers, maxWorkers)
+	}
+	if timeout := pool.IdleTimeout(); timeout != 5*time.Second {
+		t.Errorf("IdleTimeout = %s, want 5s", timeout)
+	}
+	if active := pool.ActiveWorkerCount(); active != 2 {
+		t.Errorf("active = %d, want the new minimum of 2", active)
+	}
+
+	// An invalid configuration leaves the pool untouched
+	if err := pool.Reconfigure(&PoolConfig{MaxWorkers: 0, IdleTimeout: time.Second}); !errors.Is(err, ErrInvalidPoolSize) {
+		t.Fatalf("Reconfigure: err = %v, want ErrInvalidPoolSize", err)
+	}
+	if minWorkers, maxWorkers := pool.Limits(); minWorkers != 2 || maxWorkers != 3 || pool.IdleTimeout() != 5*time.Second {
+		t.Errorf("Limits = %d, %d, IdleTimeout = %s after an invalid configuration, want 2, 3, 5s", minWorkers, maxWorkers, pool.IdleTimeout())
+	}
+}
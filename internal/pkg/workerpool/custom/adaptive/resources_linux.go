@@ -0,0 +1,373 @@
+//go:build linux
+
+package workerpool
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// procRoot and cgroupRoot are where procfs and the cgroup filesystem are mounted.
+const (
+	procRoot   = "/proc"
+	cgroupRoot = "/sys/fs/cgroup"
+)
+
+// unlimited is the value above which cgroup v1 reports "no memory limit".
+const unlimited = 1 << 62
+
+/**
+ * systemSampler reads resource usage from the kernel, preferring the limits of the process's own cgroup,
+ * as listed in /proc/self/cgroup:
+ *
+ * 	1. cgroup v2 (memory.current, memory.max, memory.stat, cpu.stat, cpu.max)
+ * 	2. cgroup v1 (memory.usage_in_bytes, memory.limit_in_bytes, cpuacct.usage, cpu.cfs_*)
+ * 	3. procfs    (/proc/meminfo, /proc/stat) when the cgroup files are missing
+ *
+ * Memory and CPU fall back to procfs independently. Under cgroup v2 the limits are the tightest ones
+ * set on the cgroup or its ancestors, so a container inherits its pod's limits.
+ *
+ * Memory usage is the working set: usage minus inactive page cache, as the kernel can reclaim it.
+ */
+type systemSampler struct {
+	memory func() (used, limit float64, err error)
+	cpu    func() (used time.Duration, cores float64, err error)
+
+	lastCPU  time.Duration // CPU time at the previous sample
+	lastTime time.Time     // Time of the previous sample
+}
+
+// NewSystemSampler returns a sampler reading the container's or host's resource usage.
+func NewSystemSampler() ResourceSampler {
+	return newSystemSampler(procRoot, cgroupRoot)
+}
+
+// newSystemSampler resolves the process's cgroup under the given procfs and cgroup mount points.
+func newSystemSampler(proc, mount string) *systemSampler {
+	host := procfs{root: proc}
+	s := &systemSampler{memory: host.memory, cpu: host.cpu}
+
+	// The paths are missing if the file can't be read, every lookup below then uses the mount point
+	paths, _ := readCgroupPaths(filepath.Join(proc, "self", "cgroup"))
+
+	if exists(filepath.Join(mount, "cgroup.controllers")) {
+		if dir := cgroupDir(mount, paths[""], "memory.current"); dir != "" {
+			s.memory = cgroupV2{mount: mount, dir: dir, host: host}.memory
+		}
+		if dir := cgroupDir(mount, paths[""], "cpu.stat"); dir != "" {
+			s.cpu = cgroupV2{mount: mount, dir: dir, host: host}.cpu
+		}
+		return s
+	}
+
+	if dir := cgroupDir(filepath.Join(mount, "memory"), paths["memory"], "memory.usage_in_bytes"); dir != "" {
+		s.memory = cgroupV1{memory: dir, host: host}.memoryUsage
+	}
+	if dir := cgroupDir(filepath.Join(mount, "cpuacct"), paths["cpuacct"], "cpuacct.usage"); dir != "" {
+		cpu := cgroupDir(filepath.Join(mount, "cpu"), paths["cpu"], "cpu.cfs_quota_us")
+		s.cpu = cgroupV1{cpuacct: dir, cpu: cpu}.cpuUsage
+	}
+
+	return s
+}
+
+// Sample measures memory usage now and CPU usage since the previous call.
+// The first call reports no CPU usage.
+func (s *systemSampler) Sample() (ResourceUsage, error) {
+	var usage ResourceUsage
+
+	used, limit, err := s.memory()
+	if err != nil {
+		return usage, err
+	}
+	if limit > 0 {
+		usage.Memory = used / limit
+	}
+
+	cpu, cores, err := s.cpu()
+	if err != nil {
+		return usage, err
+	}
+
+	now := time.Now()
+	if !s.lastTime.IsZero() && cores > 0 {
+		elapsed := now.Sub(s.lastTime)
+		usage.CPU = float64(cpu-s.lastCPU) / (float64(elapsed) * cores)
+	}
+	s.lastCPU, s.lastTime = cpu, now
+
+	return usage, nil
+}
+
+// readCgroupPaths parses /proc/self/cgroup, mapping each controller to the process's cgroup path.
+// Lines look like "4:memory:/kubepods/pod1" (v1) or "0::/kubepods/pod1" (v2, stored under "").
+func readCgroupPaths(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	paths := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[1] == "" {
+			paths[""] = fields[2]
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			paths[controller] = fields[2]
+		}
+	}
+
+	return paths, scanner.Err()
+}
+
+// cgroupDir returns the directory of the process's cgroup under a mount point, checking it holds file.
+// Without a cgroup namespace the mount point may already be the process's cgroup (Docker on cgroup v1),
+// so the mount point itself is tried when the cgroup path doesn't exist under it.
+// Returns "" if neither holds the file.
+func cgroupDir(mount, path, file string) string {
+	for _, dir := range []string{filepath.Join(mount, path), mount} {
+		if exists(filepath.Join(dir, file)) {
+			return dir
+		}
+	}
+
+	return ""
+}
+
+// cgroupV2 reads the unified hierarchy, dir being the process's cgroup under mount.
+type cgroupV2 struct {
+	mount string
+	dir   string
+	host  procfs
+}
+
+func (c cgroupV2) memory() (float64, float64, error) {
+	current, err := readNumber(filepath.Join(c.dir, "memory.current"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	inactive, _ := readStat(filepath.Join(c.dir, "memory.stat"), "inactive_file")
+
+	limit := math.Inf(1)
+	c.ancestors(func(dir string) {
+		if value, err := readNumber(filepath.Join(dir, "memory.max")); err == nil {
+			limit = math.Min(limit, value)
+		}
+	})
+	if math.IsInf(limit, 1) {
+		if limit, err = c.host.total(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return max(current-inactive, 0), limit, nil
+}
+
+func (c cgroupV2) cpu() (time.Duration, float64, error) {
+	usage, err := readStat(filepath.Join(c.dir, "cpu.stat"), "usage_usec")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	cores := float64(runtime.NumCPU())
+	c.ancestors(func(dir string) {
+		fields, err := readFields(filepath.Join(dir, "cpu.max"))
+		if err != nil || len(fields) != 2 || fields[0] == "max" {
+			return
+		}
+		quota, qErr := strconv.ParseFloat(fields[0], 64)
+		period, pErr := strconv.ParseFloat(fields[1], 64)
+		if qErr == nil && pErr == nil && period > 0 {
+			cores = math.Min(cores, quota/period)
+		}
+	})
+
+	return time.Duration(usage) * time.Microsecond, cores, nil
+}
+
+// ancestors calls fn for the cgroup and each of its parents up to the mount point.
+func (c cgroupV2) ancestors(fn func(dir string)) {
+	for dir := c.dir; ; dir = filepath.Dir(dir) {
+		fn(dir)
+		if dir == c.mount || !strings.HasPrefix(dir, c.mount) {
+			return
+		}
+	}
+}
+
+// cgroupV1 reads the per-controller hierarchies, each field being the process's cgroup under that controller.
+type cgroupV1 struct {
+	memory  string
+	cpuacct string
+	cpu     string // Empty if the cpu controller isn't available
+	host    procfs
+}
+
+func (c cgroupV1) memoryUsage() (float64, float64, error) {
+	usage, err := readNumber(filepath.Join(c.memory, "memory.usage_in_bytes"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	inactive, _ := readStat(filepath.Join(c.memory, "memory.stat"), "total_inactive_file")
+
+	limit, err := readNumber(filepath.Join(c.memory, "memory.limit_in_bytes"))
+	if err != nil {
+		return 0, 0, err
+	}
+	if limit >= unlimited {
+		if limit, err = c.host.total(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return max(usage-inactive, 0), limit, nil
+}
+
+func (c cgroupV1) cpuUsage() (time.Duration, float64, error) {
+	usage, err := readNumber(filepath.Join(c.cpuacct, "cpuacct.usage"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	cores := float64(runtime.NumCPU())
+	if c.cpu != "" {
+		quota, qErr := readNumber(filepath.Join(c.cpu, "cpu.cfs_quota_us"))
+		period, pErr := readNumber(filepath.Join(c.cpu, "cpu.cfs_period_us"))
+		if qErr == nil && pErr == nil && quota > 0 && period > 0 {
+			cores = quota / period
+		}
+	}
+
+	return time.Duration(usage), cores, nil
+}
+
+// procfs reads the usage of the whole host, root being where procfs is mounted.
+type procfs struct {
+	root string
+}
+
+func (p procfs) memory() (float64, float64, error) {
+	meminfo := filepath.Join(p.root, "meminfo")
+
+	total, err := readStat(meminfo, "MemTotal:")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	available, err := readStat(meminfo, "MemAvailable:")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return total - available, total, nil
+}
+
+// cpu reports the busy time of the whole host; every core counts.
+func (p procfs) cpu() (time.Duration, float64, error) {
+	fields, err := readFields(filepath.Join(p.root, "stat"))
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, fmt.Errorf("unexpected /proc/stat format")
+	}
+
+	// user nice system idle iowait irq softirq steal, in clock ticks (USER_HZ, 100 on Linux)
+	var busy float64
+	for i, field := range fields[1:min(len(fields), 9)] {
+		ticks, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("parse /proc/stat: %w", err)
+		}
+		if i == 3 || i == 4 { // idle, iowait
+			continue
+		}
+		busy += ticks
+	}
+
+	return time.Duration(busy * float64(10*time.Millisecond)), float64(runtime.NumCPU()), nil
+}
+
+// total returns the total memory of the host in bytes, used when the cgroup sets no limit.
+func (p procfs) total() (float64, error) {
+	total, err := readStat(filepath.Join(p.root, "meminfo"), "MemTotal:")
+	return total * 1024, err
+}
+
+var errNoLimit = errors.New("no limit")
+
+// readNumber reads a file holding a single number, returning errNoLimit for "max".
+func readNumber(path string) (float64, error) {
+	fields, err := readFields(path)
+	if err != nil {
+		return 0, err
+	}
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("%s: empty", path)
+	}
+	if fields[0] == "max" {
+		return 0, errNoLimit
+	}
+
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// readFields returns the whitespace separated fields of the first line of a file.
+func readFields(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return nil, scanner.Err()
+	}
+
+	return strings.Fields(scanner.Text()), nil
+}
+
+// readStat returns the value of the line starting with key in a "key value" file.
+func readStat(path, key string) (float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == key {
+			return strconv.ParseFloat(fields[1], 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, fmt.Errorf("%s: %s not found", path, key)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,210 @@
+//go:build linux
+
+package workerpool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTree creates the files of a fixture directory, keyed by their path relative to root.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// sampleFixture builds a procfs and a cgroup mount from the given files and reads them once.
+func sampleFixture(t *testing.T, proc, cgroup map[string]string) (used, limit float64, cpu time.Duration, cores float64) {
+	t.Helper()
+
+	root := t.TempDir()
+	writeTree(t, filepath.Join(root, "proc"), proc)
+	writeTree(t, filepath.Join(root, "cgroup"), cgroup)
+
+	s := newSystemSampler(filepath.Join(root, "proc"), filepath.Join(root, "cgroup"))
+
+	used, limit, err := s.memory()
+	if err != nil {
+		t.Fatalf("memory: %v", err)
+	}
+	cpu, cores, err = s.cpu()
+	if err != nil {
+		t.Fatalf("cpu: %v", err)
+	}
+
+	return used, limit, cpu, cores
+}
+
+// hostProc is a procfs fixture for a host with 4 GiB of memory, 1 GiB of which is available.
+var hostProc = map[string]string{
+	"meminfo": "MemTotal:       4194304 kB\nMemFree:         524288 kB\nMemAvailable:   1048576 kB\n",
+	"stat":    "cpu  100 0 50 1000 10 0 0 0 0 0\ncpu0 100 0 50 1000 10 0 0 0 0 0\n",
+}
+
+func TestSystemSamplerReadsOwnCgroupV2(t *testing.T) {
+	proc := map[string]string{
+		"self/cgroup": "0::/kubepods/pod1/ctr\n",
+	}
+	for name, content := range hostProc {
+		proc[name] = content
+	}
+
+	cgroup := map[string]string{
+		"cgroup.controllers": "cpu memory\n",
+		// The root's usage is the whole host's, it must not be read
+		"memory.current": "999999999\n",
+		"cpu.stat":       "usage_usec 999999999\n",
+
+		// The pod sets the limits, the container inherits them
+		"kubepods/pod1/memory.max": "1000\n",
+		"kubepods/pod1/cpu.max":    "50000 100000\n",
+
+		"kubepods/pod1/ctr/memory.current": "600\n",
+		"kubepods/pod1/ctr/memory.stat":    "anon 500\ninactive_file 100\n",
+		"kubepods/pod1/ctr/memory.max":     "max\n",
+		"kubepods/pod1/ctr/cpu.stat":       "usage_usec 2000\nuser_usec 1500\n",
+		"kubepods/pod1/ctr/cpu.max":        "max 100000\n",
+	}
+
+	used, limit, cpu, cores := sampleFixture(t, proc, cgroup)
+
+	if used != 500 || limit != 1000 {
+		t.Fatalf("memory = %v of %v, want 500 of 1000", used, limit)
+	}
+	if cpu != 2*time.Millisecond || cores != 0.5 {
+		t.Fatalf("cpu = %v on %v cores, want 2ms on 0.5", cpu, cores)
+	}
+}
+
+func TestSystemSamplerReadsNamespacedCgroupV2(t *testing.T) {
+	// Inside a cgroup namespace the process's cgroup is mounted at the root
+	proc := map[string]string{
+		"self/cgroup": "0::/\n",
+	}
+	cgroup := map[string]string{
+		"cgroup.controllers": "cpu memory\n",
+		"memory.current":     "300\n",
+		"memory.stat":        "inactive_file 0\n",
+		"memory.max":         "1200\n",
+		"cpu.stat":           "usage_usec 1000\n",
+		"cpu.max":            "max 100000\n",
+	}
+
+	used, limit, cpu, _ := sampleFixture(t, proc, cgroup)
+
+	if used != 300 || limit != 1200 {
+		t.Fatalf("memory = %v of %v, want 300 of 1200", used, limit)
+	}
+	if cpu != time.Millisecond {
+		t.Fatalf("cpu = %v, want 1ms", cpu)
+	}
+}
+
+func TestSystemSamplerReadsOwnCgroupV1(t *testing.T) {
+	proc := map[string]string{
+		"self/cgroup": "5:memory:/docker/abc\n4:cpu,cpuacct:/docker/abc\n1:name=systemd:/docker/abc\n",
+	}
+	cgroup := map[string]string{
+		"memory/memory.usage_in_bytes": "999999999\n",
+		"memory/memory.limit_in_bytes": "9223372036854771712\n",
+
+		"memory/docker/abc/memory.usage_in_bytes": "800\n",
+		"memory/docker/abc/memory.stat":           "cache 300\ntotal_inactive_file 200\n",
+		"memory/docker/abc/memory.limit_in_bytes": "2000\n",
+		"cpuacct/docker/abc/cpuacct.usage":        "5000000\n",
+		"cpu/docker/abc/cpu.cfs_quota_us":         "200000\n",
+		"cpu/docker/abc/cpu.cfs_period_us":        "100000\n",
+	}
+
+	used, limit, cpu, cores := sampleFixture(t, proc, cgroup)
+
+	if used != 600 || limit != 2000 {
+		t.Fatalf("memory = %v of %v, want 600 of 2000", used, limit)
+	}
+	if cpu != 5*time.Millisecond || cores != 2 {
+		t.Fatalf("cpu = %v on %v cores, want 5ms on 2", cpu, cores)
+	}
+}
+
+func TestSystemSamplerUsesMountWhenCgroupPathIsHidden(t *testing.T) {
+	// Docker without a cgroup namespace lists the host path but mounts the container's cgroup at the root
+	proc := map[string]string{
+		"self/cgroup": "5:memory:/docker/abc\n4:cpu,cpuacct:/docker/abc\n",
+	}
+	for name, content := range hostProc {
+		proc[name] = content
+	}
+	cgroup := map[string]string{
+		"memory/memory.usage_in_bytes": "700\n",
+		"memory/memory.limit_in_bytes": "9223372036854771712\n",
+		"cpuacct/cpuacct.usage":        "1000000\n",
+		"cpu/cpu.cfs_quota_us":         "-1\n",
+		"cpu/cpu.cfs_period_us":        "100000\n",
+	}
+
+	used, limit, cpu, _ := sampleFixture(t, proc, cgroup)
+
+	// No memory limit: the host's memory applies
+	if used != 700 || limit != 4194304*1024 {
+		t.Fatalf("memory = %v of %v, want 700 of %v", used, limit, 4194304*1024)
+	}
+	if cpu != time.Millisecond {
+		t.Fatalf("cpu = %v, want 1ms", cpu)
+	}
+}
+
+func TestSystemSamplerFallsBackToProcfs(t *testing.T) {
+	tests := []struct {
+		name   string
+		proc   map[string]string
+		cgroup map[string]string
+	}{
+		{
+			name:   "no cgroup filesystem",
+			cgroup: map[string]string{},
+		},
+		{
+			// The root cgroup of the v2 hierarchy has no memory.current nor cpu.stat
+			name:   "process in the v2 root cgroup",
+			proc:   map[string]string{"self/cgroup": "0::/\n"},
+			cgroup: map[string]string{"cgroup.controllers": "cpu memory\n"},
+		},
+		{
+			name:   "unreadable /proc/self/cgroup",
+			cgroup: map[string]string{"cgroup.controllers": "cpu memory\n", "user.slice/memory.current": "1\n"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proc := map[string]string{}
+			for name, content := range hostProc {
+				proc[name] = content
+			}
+			for name, content := range test.proc {
+				proc[name] = content
+			}
+
+			used, limit, cpu, _ := sampleFixture(t, proc, test.cgroup)
+
+			if used != 3145728 || limit != 4194304 {
+				t.Fatalf("memory = %v of %v, want 3145728 of 4194304", used, limit)
+			}
+			// user + system ticks, 10ms each
+			if cpu != 1500*time.Millisecond {
+				t.Fatalf("cpu = %v, want 1.5s", cpu)
+			}
+		})
+	}
+}
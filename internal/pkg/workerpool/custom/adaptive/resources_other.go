@@ -0,0 +1,16 @@
+//go:build !linux
+
+package workerpool
+
+// unsupportedSampler is used where cgroups and procfs aren't available.
+type unsupportedSampler struct{}
+
+// NewSystemSampler returns a sampler reading the container's or host's resource usage.
+// Outside Linux it always fails with ErrResourcesUnsupported, leaving admission unrestricted.
+func NewSystemSampler() ResourceSampler {
+	return unsupportedSampler{}
+}
+
+func (unsupportedSampler) Sample() (ResourceUsage, error) {
+	return ResourceUsage{}, ErrResourcesUnsupported
+}
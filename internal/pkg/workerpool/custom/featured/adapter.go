@@ -0,0 +1,47 @@
+package workerpool
+
+import (
+	"context"
+	"pkg/workerpool"
+	"time"
+)
+
+// plainPool schedules plain func() tasks on a featured pool, see AsPool.
+type plainPool struct {
+	pool *Pool
+}
+
+// AsPool returns a view of the pool implementing workerpool.Pool, for code written against
+// the common interface. Tasks are scheduled with PriorityNormal and never report an error,
+// so they are only retried or dead-lettered if they panic.
+func (p *Pool) AsPool() workerpool.Pool {
+	return plainPool{pool: p}
+}
+
+func (v plainPool) Schedule(task func()) error {
+	return v.pool.Schedule(plain(task))
+}
+
+func (v plainPool) ScheduleTimeout(timeout time.Duration, task func()) error {
+	return v.pool.ScheduleTimeout(timeout, plain(task))
+}
+
+func (v plainPool) TrySchedule(task func()) error {
+	return v.pool.TrySchedule(plain(task))
+}
+
+func (v plainPool) Stats() workerpool.Stats {
+	return v.pool.Stats()
+}
+
+func (v plainPool) Shutdown(ctx context.Context) (int, error) {
+	return v.pool.Shutdown(ctx)
+}
+
+// plain turns a func() into a Task that always succeeds.
+func plain(task func()) Task {
+	return func(context.Context) error {
+		task()
+		return nil
+	}
+}
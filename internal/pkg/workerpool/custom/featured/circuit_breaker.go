@@ -1 +1,286 @@
-package workerpool
\ No newline at end of file
+package workerpool
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CircuitState is the admission state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	StateClosed   CircuitState = iota // All tasks are admitted
+	StateOpen                         // All tasks are rejected
+	StateHalfOpen                     // A growing fraction of tasks is admitted
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// ErrCircuitOpen matches every *CircuitOpenError with errors.Is.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitOpenError is returned when a task is rejected by the circuit breaker.
+// RetryAfter is a hint for callers (e.g. a Retry-After header on a 503 response).
+type CircuitOpenError struct {
+	State      CircuitState
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker %s: task rejected, retry after %s", e.State, e.RetryAfter)
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// halfOpenSteps is the fraction of traffic admitted at each half-open step.
+var halfOpenSteps = []float64{0.25, 0.50, 0.75, 1.00}
+
+// CircuitBreakerConfig holds configuration for the circuit breaker.
+// Zero values are replaced with the defaults noted on each field.
+type CircuitBreakerConfig struct {
+	FailureThreshold float64                     // Failure ratio that opens the breaker (default 0.5)
+	MinRequests      int                         // Outcomes needed before the ratio is evaluated while closed (default 20)
+	Interval         time.Duration               // Period after which closed-state counts are reset (default 10s)
+	OpenTimeout      time.Duration               // Time spent open before probing in half-open (default 5s)
+	StepRequests     int                         // Outcomes evaluated at each half-open step (default 10)
+	IsFailure        func(err error) bool        // Classifies task errors as failures (default err != nil)
+	OnStateChange    func(from, to CircuitState) // Called after every state transition
+}
+
+/**
+ * CircuitBreaker gates task admission based on the observed task failure ratio.
+ *
+ * State machine:
+ *
+ * 	closed ──(failure ratio ≥ threshold)──► open ──(OpenTimeout)──► half-open
+ * 	  ▲                                       ▲                        │
+ * 	  │                                       └──(step failing)────────┤
+ * 	  └──────────────(100% step passing)──────────────────────────────┘
+ *
+ * While half-open, traffic is admitted in steps of 25% → 50% → 75% → 100%.
+ * Each step advances after StepRequests outcomes stay below the failure threshold.
+ */
+type CircuitBreaker struct {
+	config      CircuitBreakerConfig
+	mutex       sync.Mutex
+	state       CircuitState
+	generation  uint64    // Incremented on every transition and half-open step, outcomes of older generations are ignored
+	step        int       // Index into halfOpenSteps while half-open
+	requests    int       // Admission attempts in the current half-open step
+	admitted    int       // Admitted attempts in the current half-open step
+	successes   int       // Successful outcomes in the current window or step
+	failures    int       // Failed outcomes in the current window or step
+	openedAt    time.Time // When the breaker last opened
+	windowStart time.Time // Start of the current closed-state counting window
+}
+
+// NewCircuitBreaker creates a circuit breaker in the closed state.
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 0.5
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 20
+	}
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 5 * time.Second
+	}
+	if config.StepRequests <= 0 {
+		config.StepRequests = 10
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = func(err error) bool { return err != nil }
+	}
+
+	return &CircuitBreaker{
+		config:      config,
+		state:       StateClosed,
+		windowStart: time.Now(),
+	}
+}
+
+// State returns the current state of the breaker.
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mutex.Lock()
+	transition := cb.tick(time.Now())
+	state := cb.state
+	cb.mutex.Unlock()
+
+	cb.notify(transition)
+	return state
+}
+
+// Allow asks the breaker to admit one task.
+// On success it returns a done callback that must be called once with the task's outcome.
+// On rejection it returns a *CircuitOpenError.
+func (cb *CircuitBreaker) Allow() (func(err error), error) {
+	done, _, err := cb.admit()
+	return done, err
+}
+
+// admit is Allow that also returns a release callback, which gives the admission
+// back without reporting an outcome. It is meant for tasks that never ran, such as
+// tasks rejected by a full queue or discarded on shutdown.
+// At most one of done and release may be called.
+func (cb *CircuitBreaker) admit() (done func(err error), release func(), err error) {
+	now := time.Now()
+
+	cb.mutex.Lock()
+	transition := cb.tick(now)
+
+	switch cb.state {
+	case StateOpen:
+		retryAfter := cb.openedAt.Add(cb.config.OpenTimeout).Sub(now)
+		cb.mutex.Unlock()
+		cb.notify(transition)
+		return nil, nil, &CircuitOpenError{State: StateOpen, RetryAfter: retryAfter}
+
+	case StateHalfOpen:
+		cb.requests++
+		if float64(cb.admitted) >= halfOpenSteps[cb.step]*float64(cb.requests) {
+			cb.mutex.Unlock()
+			cb.notify(transition)
+			return nil, nil, &CircuitOpenError{State: StateHalfOpen}
+		}
+		cb.admitted++
+	}
+
+	generation := cb.generation
+	cb.mutex.Unlock()
+	cb.notify(transition)
+
+	done = func(err error) { cb.record(generation, err) }
+	release = func() { cb.release(generation) }
+	return done, release, nil
+}
+
+// release returns an admission of the given generation that will never report an outcome.
+func (cb *CircuitBreaker) release(generation uint64) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if generation != cb.generation || cb.state != StateHalfOpen {
+		return
+	}
+
+	cb.requests--
+	cb.admitted--
+}
+
+// record accounts for the outcome of a task admitted in the given generation.
+func (cb *CircuitBreaker) record(generation uint64, err error) {
+	cb.mutex.Lock()
+	transition := cb.tick(time.Now())
+
+	if generation != cb.generation {
+		cb.mutex.Unlock()
+		cb.notify(transition)
+		return
+	}
+
+	if cb.config.IsFailure(err) {
+		cb.failures++
+	} else {
+		cb.successes++
+	}
+
+	total := cb.successes + cb.failures
+	ratio := float64(cb.failures) / float64(total)
+
+	switch cb.state {
+	case StateClosed:
+		if total >= cb.config.MinRequests && ratio >= cb.config.FailureThreshold {
+			transition = cb.setState(StateOpen, time.Now())
+		}
+
+	case StateHalfOpen:
+		switch {
+		case float64(cb.failures) >= cb.config.FailureThreshold*float64(cb.config.StepRequests):
+			// The step can no longer pass, reopen right away
+			transition = cb.setState(StateOpen, time.Now())
+		case total >= cb.config.StepRequests && cb.step == len(halfOpenSteps)-1:
+			transition = cb.setState(StateClosed, time.Now())
+		case total >= cb.config.StepRequests:
+			// Outcomes of tasks admitted during the previous step must not count towards the next one
+			cb.step++
+			cb.generation++
+			cb.resetCounts()
+		}
+	}
+
+	cb.mutex.Unlock()
+	cb.notify(transition)
+}
+
+// tick applies time-based transitions: open → half-open and closed window resets.
+// Must be called with the mutex held.
+func (cb *CircuitBreaker) tick(now time.Time) *[2]CircuitState {
+	switch cb.state {
+	case StateOpen:
+		if now.Sub(cb.openedAt) >= cb.config.OpenTimeout {
+			return cb.setState(StateHalfOpen, now)
+		}
+	case StateClosed:
+		if now.Sub(cb.windowStart) >= cb.config.Interval {
+			cb.windowStart = now
+			cb.resetCounts()
+		}
+	}
+
+	return nil
+}
+
+// setState moves the breaker to a new state and returns the transition to report.
+// Must be called with the mutex held.
+func (cb *CircuitBreaker) setState(to CircuitState, now time.Time) *[2]CircuitState {
+	from := cb.state
+	cb.state = to
+	cb.generation++
+	cb.step = 0
+	cb.resetCounts()
+
+	switch to {
+	case StateOpen:
+		cb.openedAt = now
+	case StateClosed:
+		cb.windowStart = now
+	}
+
+	return &[2]CircuitState{from, to}
+}
+
+// resetCounts clears outcome and admission counters.
+// Must be called with the mutex held.
+func (cb *CircuitBreaker) resetCounts() {
+	cb.requests = 0
+	cb.admitted = 0
+	cb.successes = 0
+	cb.failures = 0
+}
+
+// notify invokes the state change callback outside of the mutex.
+func (cb *CircuitBreaker) notify(transition *[2]CircuitState) {
+	if transition == nil || cb.config.OnStateChange == nil {
+		return
+	}
+
+	cb.config.OnStateChange(transition[0], transition[1])
+}
@@ -0,0 +1,155 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errTask = errors.New("task failed")
+
+// openBreaker returns a breaker that opens after two failures and probes right away.
+func openBreaker(t *testing.T) *CircuitBreaker {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{
+		MinRequests:  2,
+		OpenTimeout:  10 * time.Millisecond,
+		StepRequests: 4,
+	})
+
+	for range 2 {
+		done, err := cb.Allow()
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		done(errTask)
+	}
+
+	if state := cb.State(); state != StateOpen {
+		t.Fatalf("state = %s, want open", state)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if state := cb.State(); state != StateHalfOpen {
+		t.Fatalf("state = %s, want half-open", state)
+	}
+
+	return cb
+}
+
+func TestCircuitBreakerReleaseReturnsAdmission(t *testing.T) {
+	cb := openBreaker(t)
+
+	// The first step admits one request out of four
+	_, release, err := cb.admit()
+	if err != nil {
+		t.Fatalf("admit: %v", err)
+	}
+
+	if _, _, err := cb.admit(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second admit: err = %v, want ErrCircuitOpen", err)
+	}
+
+	release()
+
+	cb.mutex.Lock()
+	requests, admitted := cb.requests, cb.admitted
+	cb.mutex.Unlock()
+
+	if requests != 1 || admitted != 0 {
+		t.Fatalf("requests = %d, admitted = %d after release, want 1 and 0", requests, admitted)
+	}
+}
+
+func TestCircuitBreakerIgnoresOutcomesOfPreviousStep(t *testing.T) {
+	cb := openBreaker(t)
+
+	// Admitted during the first step, but only reported after it has passed
+	var late func(error)
+	for late == nil {
+		late, _, _ = cb.admit()
+	}
+
+	for cb.stepIndex() == 0 {
+		if done, _, err := cb.admit(); err == nil {
+			done(nil)
+		}
+	}
+
+	late(errTask)
+
+	cb.mutex.Lock()
+	failures := cb.failures
+	cb.mutex.Unlock()
+
+	if failures != 0 {
+		t.Fatalf("failures = %d, want late outcome to be ignored", failures)
+	}
+}
+
+func TestCircuitBreakerCountsSubmissionOnce(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{MinRequests: 1})
+	pool := NewPool(1, 1, 1,
+		WithCircuitBreaker(cb),
+		WithRetryPolicy(&RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}),
+	)
+	defer pool.Close()
+
+	var attempts atomic.Int32
+	future := Submit(pool, func(context.Context) (int32, error) {
+		if n := attempts.Add(1); n < 3 {
+			return n, errTask
+		}
+		return 3, nil
+	})
+
+	if _, err := future.Await(context.Background()); err != nil {
+		t.Fatalf("Await: %v", err)
+	}
+
+	// Failed attempts that are retried must not open the breaker
+	if state := cb.State(); state != StateClosed {
+		t.Fatalf("state = %s, want closed", state)
+	}
+}
+
+func TestCircuitBreakerReleasesRejectedTasks(t *testing.T) {
+	cb := openBreaker(t)
+	pool := NewPool(1, 1, 1, WithCircuitBreaker(cb))
+
+	block := make(chan token)
+	started := make(chan token)
+
+	// Keep scheduling until one task is admitted, then occupy the worker and the queue slot
+	for pool.TrySchedule(func(context.Context) error { close(started); <-block; return nil }) != nil {
+	}
+	<-started
+
+	cb.mutex.Lock()
+	admitted := cb.admitted
+	cb.mutex.Unlock()
+
+	queued := 0
+	for range 20 {
+		if pool.TrySchedule(func(context.Context) error { return nil }) == nil {
+			queued++
+		}
+	}
+
+	cb.mutex.Lock()
+	if cb.admitted != admitted+queued {
+		t.Errorf("admitted = %d, want %d with rejected tasks released", cb.admitted, admitted+queued)
+	}
+	cb.mutex.Unlock()
+
+	close(block)
+	pool.Close()
+}
+
+// stepIndex returns the current half-open step.
+func (cb *CircuitBreaker) stepIndex() int {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	return cb.step
+}
@@ -0,0 +1,265 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeadLetter is a task that failed for good, together with what is known about its failure.
+type DeadLetter struct {
+	ID           string    // Unique identifier assigned when the task is dead-lettered
+	Name         string    // Task name given to ScheduleNamed or SchedulePersistent
+	Payload      []byte    // Serialized task input given along with the name, if any
+	Priority     Priority  // Priority the task was scheduled with
+	Err          error     // Error of the last attempt, a *PanicError if the task panicked
+	Attempts     int       // Number of times the task was executed
+	FirstAttempt time.Time // When the task was first executed
+	LastAttempt  time.Time // When the task last failed
+	Task         Task      // The task itself for in-process replay, nil if it was not kept
+}
+
+// DeadLetterQueue stores tasks that exhausted their retries or panicked.
+// Implementations must be safe for concurrent use.
+type DeadLetterQueue interface {
+	// Add stores a dead letter. Its ID is already set.
+	Add(ctx context.Context, letter *DeadLetter) error
+	// List returns every stored dead letter, oldest first.
+	List(ctx context.Context) ([]*DeadLetter, error)
+	// Get returns the dead letter with the given ID or ErrDeadLetterNotFound.
+	Get(ctx context.Context, id string) (*DeadLetter, error)
+	// Remove deletes the dead letter with the given ID or returns ErrDeadLetterNotFound.
+	// Replay claims a letter by removing it, so of concurrent calls for an ID only one may succeed.
+	Remove(ctx context.Context, id string) error
+	// Purge deletes every dead letter and returns how many were removed.
+	Purge(ctx context.Context) (int, error)
+}
+
+// WithDeadLetterQueue captures tasks that fail for good in dlq.
+// With a retry policy that is every task that exhausts its attempts; without one,
+// only tasks that panic are captured since errors are already returned through futures.
+func WithDeadLetterQueue(dlq DeadLetterQueue) Option {
+	return func(p *Pool) {
+		p.deadLetters = dlq
+	}
+}
+
+// DeadLetters returns the pool's dead letter queue, nil if none is configured.
+func (p *Pool) DeadLetters() DeadLetterQueue {
+	return p.deadLetters
+}
+
+// deadLetter hands a failed job to the dead letter queue, if any.
+// There is no caller to report a storage error to, so it is logged.
+func (p *Pool) deadLetter(j *job, err error) {
+	if p.deadLetters == nil {
+		return
+	}
+
+	letter := &DeadLetter{
+		ID:           uuid.NewString(),
+		Name:         j.name,
+		Payload:      j.payload,
+		Priority:     j.priority,
+		Err:          err,
+		Attempts:     j.attempts,
+		FirstAttempt: j.firstAttempt,
+		LastAttempt:  time.Now(),
+		Task:         j.task,
+	}
+
+	if addErr := p.deadLetters.Add(p.ctx, letter); addErr != nil {
+		log.Printf("workerpool: dead letter %s (%s) lost: %v", letter.ID, letter.Name, addErr)
+		return
+	}
+
+	j.deadLettered = true
+}
+
+// Replay removes the dead letter with the given ID from the queue and schedules it again.
+// The task starts over with a fresh attempt count; if it fails again it is captured under a new ID.
+// If it can't be scheduled, the letter is put back at the end of the queue.
+// Returns ErrNotReplayable if the dead letter doesn't hold a task, and ErrDeadLetterNotFound
+// if it doesn't exist or another call is replaying it.
+func (p *Pool) Replay(ctx context.Context, id string) error {
+	if p.deadLetters == nil {
+		return ErrNoDeadLetterQueue
+	}
+
+	letter, err := p.deadLetters.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if letter.Task == nil {
+		return ErrNotReplayable
+	}
+
+	// Removing claims the letter: of concurrent replays, only one gets past this point
+	if err := p.deadLetters.Remove(ctx, id); err != nil {
+		return err
+	}
+
+	j := &job{task: letter.Task, name: letter.Name, payload: letter.Payload, priority: letter.Priority}
+	if err := p.enqueue(j, blockIndefinitely); err != nil {
+		if addErr := p.deadLetters.Add(ctx, letter); addErr != nil {
+			log.Printf("workerpool: dead letter %s (%s) lost: %v", letter.ID, letter.Name, addErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ReplayAll replays every dead letter that holds a task and returns how many were rescheduled.
+// Letters replayed meanwhile by another call are skipped. It stops at the first scheduling error.
+func (p *Pool) ReplayAll(ctx context.Context) (int, error) {
+	if p.deadLetters == nil {
+		return 0, ErrNoDeadLetterQueue
+	}
+
+	letters, err := p.deadLetters.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, letter := range letters {
+		if letter.Task == nil {
+			continue
+		}
+
+		err := p.Replay(ctx, letter.ID)
+		if errors.Is(err, ErrDeadLetterNotFound) {
+			continue
+		}
+		if err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+
+	return replayed, nil
+}
+
+// DeadLetterSink returns an OnExhausted callback that stores exhausted tasks in dlq.
+// It lets tasks decorated for the fixed and adaptive pools share a dead letter queue:
+//
+//	policy := &RetryPolicy{OnExhausted: DeadLetterSink(dlq)}
+func DeadLetterSink(dlq DeadLetterQueue) func(ctx context.Context, exhausted Exhausted) {
+	return func(ctx context.Context, exhausted Exhausted) {
+		letter := &DeadLetter{
+			ID:           uuid.NewString(),
+			Name:         exhausted.Name,
+			Payload:      exhausted.Payload,
+			Priority:     PriorityNormal,
+			Err:          exhausted.Err,
+			Attempts:     exhausted.Attempts,
+			FirstAttempt: exhausted.FirstAttempt,
+			LastAttempt:  exhausted.LastAttempt,
+			Task:         exhausted.Task,
+		}
+
+		if err := dlq.Add(ctx, letter); err != nil {
+			log.Printf("workerpool: dead letter %s (%s) lost: %v", letter.ID, letter.Name, err)
+		}
+	}
+}
+
+// MemoryDeadLetterQueue is an in-memory DeadLetterQueue.
+// When a capacity is set, the oldest dead letters are evicted to make room for new ones.
+type MemoryDeadLetterQueue struct {
+	mutex    sync.Mutex
+	letters  []*DeadLetter // Oldest first
+	capacity int           // Maximum number of letters kept, 0 for unbounded
+}
+
+// NewMemoryDeadLetterQueue creates an in-memory dead letter queue keeping at most capacity
+// letters. A capacity <= 0 keeps every letter.
+func NewMemoryDeadLetterQueue(capacity int) *MemoryDeadLetterQueue {
+	return &MemoryDeadLetterQueue{capacity: max(capacity, 0)}
+}
+
+// Add stores a dead letter, evicting the oldest one if the queue is full.
+func (q *MemoryDeadLetterQueue) Add(_ context.Context, letter *DeadLetter) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.capacity > 0 && len(q.letters) >= q.capacity {
+		q.letters[0] = nil
+		q.letters = q.letters[1:]
+	}
+
+	q.letters = append(q.letters, letter)
+	return nil
+}
+
+// List returns a snapshot of every stored dead letter, oldest first.
+func (q *MemoryDeadLetterQueue) List(_ context.Context) ([]*DeadLetter, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	letters := make([]*DeadLetter, len(q.letters))
+	copy(letters, q.letters)
+	return letters, nil
+}
+
+// Get returns the dead letter with the given ID.
+func (q *MemoryDeadLetterQueue) Get(_ context.Context, id string) (*DeadLetter, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if i := q.index(id); i >= 0 {
+		return q.letters[i], nil
+	}
+
+	return nil, ErrDeadLetterNotFound
+}
+
+// Remove deletes the dead letter with the given ID.
+func (q *MemoryDeadLetterQueue) Remove(_ context.Context, id string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	i := q.index(id)
+	if i < 0 {
+		return ErrDeadLetterNotFound
+	}
+
+	q.letters = append(q.letters[:i], q.letters[i+1:]...)
+	return nil
+}
+
+// Purge deletes every dead letter.
+func (q *MemoryDeadLetterQueue) Purge(_ context.Context) (int, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	purged := len(q.letters)
+	q.letters = nil
+	return purged, nil
+}
+
+// Len returns the number of stored dead letters.
+func (q *MemoryDeadLetterQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return len(q.letters)
+}
+
+// index returns the position of the dead letter with the given ID, or -1.
+// Must be called with the mutex held.
+func (q *MemoryDeadLetterQueue) index(id string) int {
+	for i, letter := range q.letters {
+		if letter.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
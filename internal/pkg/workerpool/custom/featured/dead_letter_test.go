@@ -0,0 +1,225 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitLetters waits until dlq holds n dead letters and returns them.
+func waitLetters(t *testing.T, dlq *MemoryDeadLetterQueue, n int) []*DeadLetter {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); dlq.Len() != n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d dead letters, want %d", dlq.Len(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	letters, _ := dlq.List(context.Background())
+	return letters
+}
+
+func TestDeadLetterCapturesPanics(t *testing.T) {
+	dlq := NewMemoryDeadLetterQueue(0)
+	pool := NewPool(1, 1, 0, WithDeadLetterQueue(dlq))
+	defer pool.Close()
+
+	// Without a retry policy failures are left to the futures, only panics are captured
+	pool.ScheduleNamed("failing", nil, func(context.Context) error { return errTask })
+	pool.ScheduleNamed("panicking", []byte(`{"id":7}`), func(context.Context) error { panic("boom") })
+
+	letter := waitLetters(t, dlq, 1)[0]
+
+	var panicErr *PanicError
+	if letter.Name != "panicking" || string(letter.Payload) != `{"id":7}` || !errors.As(letter.Err, &panicErr) {
+		t.Fatalf("letter = %+v, want the panicking task with its payload", letter)
+	}
+	if letter.ID == "" || letter.Task == nil || letter.Attempts != 1 {
+		t.Errorf("letter has ID %q, task %v and %d attempts, want an ID, the task and 1 attempt", letter.ID, letter.Task != nil, letter.Attempts)
+	}
+}
+
+func TestDeadLetterCapturesExhaustedTasks(t *testing.T) {
+	dlq := NewMemoryDeadLetterQueue(0)
+	pool := NewPool(1, 1, 0,
+		WithDeadLetterQueue(dlq),
+		WithRetryPolicy(&RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}),
+	)
+	defer pool.Close()
+
+	pool.SchedulePriority(PriorityHigh, func(context.Context) error { return errTask })
+
+	letter := waitLetters(t, dlq, 1)[0]
+	if !errors.Is(letter.Err, errTask) || letter.Attempts != 3 || letter.Priority != PriorityHigh {
+		t.Fatalf("letter = %+v, want errTask after 3 attempts at high priority", letter)
+	}
+	if letter.FirstAttempt.IsZero() || letter.LastAttempt.Before(letter.FirstAttempt) {
+		t.Errorf("attempts from %s to %s", letter.FirstAttempt, letter.LastAttempt)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dlq := NewMemoryDeadLetterQueue(0)
+	pool := NewPool(1, 1, 0, WithDeadLetterQueue(dlq))
+	defer pool.Close()
+
+	var runs atomic.Int32
+	pool.Schedule(func(context.Context) error {
+		if runs.Add(1) < 3 {
+			panic("not yet")
+		}
+		return nil
+	})
+	first := waitLetters(t, dlq, 1)[0]
+
+	// Failing again, the task comes back under a new ID
+	if err := pool.Replay(context.Background(), first.ID); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	second := waitLetters(t, dlq, 1)[0]
+	if second.ID == first.ID {
+		t.Fatal("replayed letter kept its ID")
+	}
+
+	if err := pool.Replay(context.Background(), second.ID); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	waitLetters(t, dlq, 0)
+
+	for deadline := time.Now().Add(time.Second); runs.Load() != 3; {
+		if time.Now().After(deadline) {
+			t.Fatalf("runs = %d, want 3", runs.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	ctx := context.Background()
+
+	if err := NewPool(1, 1, 0).Replay(ctx, "any"); !errors.Is(err, ErrNoDeadLetterQueue) {
+		t.Errorf("Replay without a queue: err = %v, want ErrNoDeadLetterQueue", err)
+	}
+
+	dlq := NewMemoryDeadLetterQueue(0)
+	dlq.Add(ctx, &DeadLetter{ID: "stored", Name: "from another process"})
+	pool := NewPool(1, 1, 0, WithDeadLetterQueue(dlq))
+
+	if err := pool.Replay(ctx, "missing"); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Replay of a missing letter: err = %v, want ErrDeadLetterNotFound", err)
+	}
+	if err := pool.Replay(ctx, "stored"); !errors.Is(err, ErrNotReplayable) {
+		t.Errorf("Replay without a task: err = %v, want ErrNotReplayable", err)
+	}
+
+	// A letter that can't be scheduled stays in the queue
+	dlq.Add(ctx, &DeadLetter{ID: "task", Task: func(context.Context) error { return nil }})
+	pool.Close()
+
+	if err := pool.Replay(ctx, "task"); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Replay on a closed pool: err = %v, want ErrPoolClosed", err)
+	}
+	if _, err := dlq.Get(ctx, "task"); err != nil {
+		t.Errorf("letter lost by a failed replay: %v", err)
+	}
+}
+
+// gatedDeadLetterQueue holds every Get until all the expected callers have the letter.
+type gatedDeadLetterQueue struct {
+	*MemoryDeadLetterQueue
+	gets sync.WaitGroup
+}
+
+func (q *gatedDeadLetterQueue) Get(ctx context.Context, id string) (*DeadLetter, error) {
+	letter, err := q.MemoryDeadLetterQueue.Get(ctx, id)
+	q.gets.Done()
+	q.gets.Wait()
+	return letter, err
+}
+
+func TestConcurrentReplaysRunTaskOnce(t *testing.T) {
+	const replays = 8
+
+	ctx := context.Background()
+	dlq := &gatedDeadLetterQueue{MemoryDeadLetterQueue: NewMemoryDeadLetterQueue(0)}
+	dlq.gets.Add(replays)
+	pool := NewPool(4, 16, 0, WithDeadLetterQueue(dlq))
+
+	var runs atomic.Int32
+	dlq.Add(ctx, &DeadLetter{ID: "once", Task: func(context.Context) error { runs.Add(1); return nil }})
+
+	var (
+		wg       sync.WaitGroup
+		replayed atomic.Int32
+	)
+	for range replays {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			switch err := pool.Replay(ctx, "once"); {
+			case err == nil:
+				replayed.Add(1)
+			case !errors.Is(err, ErrDeadLetterNotFound):
+				t.Errorf("Replay: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := pool.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	if replayed.Load() != 1 || runs.Load() != 1 {
+		t.Errorf("%d replays succeeded and the task ran %d times, want 1 and 1", replayed.Load(), runs.Load())
+	}
+}
+
+func TestReplayAllSkipsLettersWithoutTask(t *testing.T) {
+	ctx := context.Background()
+	dlq := NewMemoryDeadLetterQueue(0)
+	pool := NewPool(2, 8, 0, WithDeadLetterQueue(dlq))
+
+	var runs atomic.Int32
+	task := func(context.Context) error { runs.Add(1); return nil }
+	dlq.Add(ctx, &DeadLetter{ID: "a", Task: task})
+	dlq.Add(ctx, &DeadLetter{ID: "b"})
+	dlq.Add(ctx, &DeadLetter{ID: "c", Task: task})
+
+	replayed, err := pool.ReplayAll(ctx)
+	if err != nil || replayed != 2 {
+		t.Fatalf("ReplayAll = %d, %v; want 2, nil", replayed, err)
+	}
+
+	pool.Shutdown(ctx)
+	if runs.Load() != 2 || dlq.Len() != 1 {
+		t.Errorf("ran %d tasks and kept %d letters, want 2 and 1", runs.Load(), dlq.Len())
+	}
+}
+
+func TestMemoryDeadLetterQueueEvictsOldest(t *testing.T) {
+	ctx := context.Background()
+	dlq := NewMemoryDeadLetterQueue(2)
+
+	for _, id := range []string{"a", "b", "c"} {
+		dlq.Add(ctx, &DeadLetter{ID: id})
+	}
+
+	letters, _ := dlq.List(ctx)
+	if len(letters) != 2 || letters[0].ID != "b" || letters[1].ID != "c" {
+		t.Fatalf("letters = %v, want b and c", letters)
+	}
+	if err := dlq.Remove(ctx, "a"); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Remove evicted letter: err = %v, want ErrDeadLetterNotFound", err)
+	}
+
+	if purged, _ := dlq.Purge(ctx); purged != 2 || dlq.Len() != 0 {
+		t.Errorf("Purge = %d leaving %d, want 2 leaving 0", purged, dlq.Len())
+	}
+}
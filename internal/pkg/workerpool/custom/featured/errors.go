@@ -0,0 +1,37 @@
+package workerpool
+
+import (
+	"errors"
+	"fmt"
+	"pkg/workerpool"
+)
+
+var (
+	ErrPoolClosed      = workerpool.ErrPoolClosed
+	ErrScheduleTimeout = workerpool.ErrScheduleTimeout
+	ErrQueueFull       = workerpool.ErrQueueFull
+
+	ErrNoDeadLetterQueue  = errors.New("no dead letter queue configured")
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	ErrNotReplayable      = errors.New("dead letter has no task to replay")
+
+	ErrNoTaskStore = errors.New("no task store configured")
+	ErrUnknownTask = errors.New("no handler registered for task")
+)
+
+// PanicError is reported when a task panics instead of returning.
+// It keeps the recovered value and the stack of the panicking goroutine.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panicked: %v", e.Value)
+}
+
+// isPanic reports whether err is, or wraps, a *PanicError.
+func isPanic(err error) bool {
+	var panicErr *PanicError
+	return errors.As(err, &panicErr)
+}
@@ -0,0 +1,107 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Future is a handle to the result of a task submitted with Submit.
+// It is completed exactly once, either by the task or by a scheduling failure.
+type Future[T any] struct {
+	done  chan token
+	once  sync.Once
+	value T
+	err   error
+}
+
+func newFuture[T any]() *Future[T] {
+	return &Future[T]{done: make(chan token)}
+}
+
+// complete stores the outcome of the task and releases every waiter.
+// Only the first call has any effect.
+func (f *Future[T]) complete(value T, err error) {
+	f.once.Do(func() {
+		f.value = value
+		f.err = err
+		close(f.done)
+	})
+}
+
+// Done returns a channel that is closed once the result is available.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Await blocks until the task completes or ctx is done.
+// It returns the task's value and error, or ctx.Err() if ctx ends first.
+func (f *Future[T]) Await(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Submit schedules fn on the pool and returns a Future for its result.
+// If the task cannot be scheduled, the returned Future is already completed with that error.
+// A panic inside fn completes the Future with a *PanicError.
+// When the pool has a retry policy, the Future reflects the last attempt.
+func Submit[T any](p *Pool, fn func(ctx context.Context) (T, error)) *Future[T] {
+	return SubmitPriority(p, PriorityNormal, fn)
+}
+
+// SubmitPriority is like Submit but queues the task with the given priority.
+func SubmitPriority[T any](p *Pool, priority Priority, fn func(ctx context.Context) (T, error)) *Future[T] {
+	future := newFuture[T]()
+
+	// The value of the latest attempt is kept until the pool reports the final outcome,
+	// so retried tasks only complete the future once.
+	var value T
+
+	j := &job{
+		priority: priority,
+		task: func(ctx context.Context) (err error) {
+			value, err = fn(ctx)
+			return err
+		},
+		finish: func(err error) {
+			future.complete(value, err)
+		},
+	}
+
+	if err := p.enqueue(j, blockIndefinitely); err != nil {
+		var zero T
+		future.complete(zero, err)
+	}
+
+	return future
+}
+
+// SubmitAll schedules every fn on the pool and waits for all of them.
+// Results are returned in submission order; failed tasks leave the zero value in their slot.
+// The returned error joins every task error, each annotated with the task index.
+func SubmitAll[T any](ctx context.Context, p *Pool, fns ...func(ctx context.Context) (T, error)) ([]T, error) {
+	futures := make([]*Future[T], len(fns))
+	for i, fn := range fns {
+		futures[i] = Submit(p, fn)
+	}
+
+	results := make([]T, len(fns))
+	var errs []error
+
+	for i, future := range futures {
+		value, err := future.Await(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("task %d: %w", i, err))
+			continue
+		}
+		results[i] = value
+	}
+
+	return results, errors.Join(errs...)
+}
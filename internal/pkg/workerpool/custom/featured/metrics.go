@@ -0,0 +1,44 @@
+package workerpool
+
+import (
+	"errors"
+	"pkg/workerpool/telemetry"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// WithMetrics exports queue depth, active workers, task latency, failures and panics,
+// rejected submissions and scaling events on meter, labelled with the pool name.
+// Retried attempts are recorded individually.
+func WithMetrics(meter metric.Meter, name string) Option {
+	return func(p *Pool) {
+		p.metrics = telemetry.New(meter, name)
+	}
+}
+
+// rejected records a submission turned down with err and returns err.
+func (p *Pool) rejected(err error) error {
+	reason := telemetry.ReasonClosed
+	switch {
+	case errors.Is(err, ErrScheduleTimeout):
+		reason = telemetry.ReasonTimeout
+	case errors.Is(err, ErrCircuitOpen):
+		reason = telemetry.ReasonCircuitOpen
+	case errors.Is(err, ErrQueueFull):
+		reason = telemetry.ReasonQueueFull
+	}
+
+	p.metrics.Rejected(p.ctx, reason)
+	return err
+}
+
+// recordTask records the outcome of one task attempt that started at start.
+func (p *Pool) recordTask(start time.Time, err error) {
+	if isPanic(err) {
+		p.metrics.TaskPanicked(p.ctx, start)
+		return
+	}
+
+	p.metrics.TaskDone(p.ctx, start, err)
+}
@@ -1 +1,162 @@
-package workerpool
\ No newline at end of file
+package workerpool
+
+import (
+	"context"
+	"pkg/logger"
+	"pkg/workerpool"
+	"runtime/debug"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// Middleware wraps the execution of a task.
+// It can act before and after next runs, change its context or its error.
+type Middleware func(next Task) Task
+
+// Chain composes middleware so that the first one is the outermost.
+func Chain(middleware ...Middleware) Middleware {
+	return func(next Task) Task {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			next = middleware[i](next)
+		}
+		return next
+	}
+}
+
+// WithMiddleware registers middleware that wraps every task executed by the pool.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(p *Pool) {
+		p.Use(middleware...)
+	}
+}
+
+// Use appends middleware to the pool. Middleware registered first runs outermost.
+// It is safe to call Use while tasks are running; only tasks that start afterwards are affected.
+func (p *Pool) Use(middleware ...Middleware) {
+	p.middlewareMutex.Lock()
+	defer p.middlewareMutex.Unlock()
+
+	current := p.middleware.Load()
+	chained := make([]Middleware, 0, len(middleware)+1)
+	if current != nil {
+		chained = append(chained, *current)
+	}
+	chained = append(chained, middleware...)
+
+	composed := Chain(chained...)
+	p.middleware.Store(&composed)
+}
+
+// Recover converts a panic in the task into a *PanicError.
+// Registering it inside other middleware lets them observe panics as regular errors.
+func Recover() Middleware {
+	return func(next Task) Task {
+		return func(ctx context.Context) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}()
+
+			return next(ctx)
+		}
+	}
+}
+
+// Logging logs the outcome and duration of every task under the given name.
+// Failures are logged as errors, successes at debug level.
+func Logging(log logger.Zapper, name string) Middleware {
+	return func(next Task) Task {
+		return func(ctx context.Context) error {
+			start := time.Now()
+			err := next(ctx)
+
+			if err != nil {
+				log.Error(ctx, "task failed",
+					zap.String("pool", name),
+					zap.Duration("duration", time.Since(start)),
+					zap.Error(err),
+				)
+				return err
+			}
+
+			log.Debug(ctx, "task completed",
+				zap.String("pool", name),
+				zap.Duration("duration", time.Since(start)),
+			)
+			return nil
+		}
+	}
+}
+
+// Tracing runs every task inside an OpenTelemetry span named after the pool.
+// The span is a child of whatever span the task context carries.
+func Tracing(name string) Middleware {
+	tracer := otel.Tracer(name)
+
+	return func(next Task) Task {
+		return func(ctx context.Context) error {
+			ctx, span := tracer.Start(ctx, name+".task")
+			defer span.End()
+
+			err := next(ctx)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+
+			return err
+		}
+	}
+}
+
+// Timing records the duration of every task, in seconds, on the given histogram.
+// Measurements carry a "status" attribute of either "ok" or "error".
+func Timing(histogram metric.Float64Histogram) Middleware {
+	ok := metric.WithAttributes(attribute.String("status", "ok"))
+	failed := metric.WithAttributes(attribute.String("status", "error"))
+
+	return func(next Task) Task {
+		return func(ctx context.Context) error {
+			start := time.Now()
+			err := next(ctx)
+
+			if err != nil {
+				histogram.Record(ctx, time.Since(start).Seconds(), failed)
+			} else {
+				histogram.Record(ctx, time.Since(start).Seconds(), ok)
+			}
+
+			return err
+		}
+	}
+}
+
+// TimeoutHandler is shared by every pool, see pkg/workerpool.
+type TimeoutHandler = workerpool.TimeoutHandler
+
+// WithTaskTimeout bounds the context of every task executed by the pool to budget.
+// onTimeout may be nil.
+func WithTaskTimeout(budget time.Duration, onTimeout TimeoutHandler) Option {
+	return WithMiddleware(Timeout(budget, onTimeout))
+}
+
+// Timeout cancels the task's context once budget has elapsed since the task started.
+// The task has to observe its context for the timeout to take effect.
+// onTimeout, if not nil, is called as soon as a task exceeds its budget, whether or not it returns.
+// A budget <= 0 leaves the context unbounded.
+func Timeout(budget time.Duration, onTimeout TimeoutHandler) Middleware {
+	return func(next Task) Task {
+		return func(ctx context.Context) error {
+			ctx, cancel := workerpool.WithBudget(ctx, budget, onTimeout)
+			defer cancel()
+
+			return next(ctx)
+		}
+	}
+}
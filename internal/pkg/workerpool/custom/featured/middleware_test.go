@@ -0,0 +1,179 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder collects the steps taken by middleware and tasks, in order.
+type recorder struct {
+	mutex sync.Mutex
+	steps []string
+}
+
+func (r *recorder) add(step string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.steps = append(r.steps, step)
+}
+
+func (r *recorder) list() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return slices.Clone(r.steps)
+}
+
+// middleware returns a Middleware recording its name before and after next runs, along with next's error.
+func (r *recorder) middleware(name string) Middleware {
+	return func(next Task) Task {
+		return func(ctx context.Context) error {
+			r.add(name + " before")
+			err := next(ctx)
+
+			var panicErr *PanicError
+			switch {
+			case errors.As(err, &panicErr):
+				r.add(name + " after panic")
+			case err != nil:
+				r.add(name + " after error")
+			default:
+				r.add(name + " after")
+			}
+
+			return err
+		}
+	}
+}
+
+func TestChainRunsFirstMiddlewareOutermost(t *testing.T) {
+	r := &recorder{}
+
+	task := Chain(r.middleware("a"), r.middleware("b"), r.middleware("c"))(func(context.Context) error {
+		r.add("task")
+		return errTask
+	})
+
+	if err := task(context.Background()); !errors.Is(err, errTask) {
+		t.Fatalf("task: err = %v, want errTask", err)
+	}
+
+	want := []string{"a before", "b before", "c before", "task", "c after error", "b after error", "a after error"}
+	if got := r.list(); !slices.Equal(got, want) {
+		t.Fatalf("steps = %v, want %v", got, want)
+	}
+}
+
+func TestUseWrapsInsideExistingMiddleware(t *testing.T) {
+	r := &recorder{}
+	pool := NewPool(1, 1, 0, WithMiddleware(r.middleware("a"), r.middleware("b")))
+	defer pool.Close()
+
+	pool.Use(r.middleware("c"))
+
+	_, err := Submit(pool, func(context.Context) (int, error) {
+		r.add("task")
+		return 0, nil
+	}).Await(context.Background())
+	if err != nil {
+		t.Fatalf("Await: %v", err)
+	}
+
+	want := []string{"a before", "b before", "c before", "task", "c after", "b after", "a after"}
+	if got := r.list(); !slices.Equal(got, want) {
+		t.Fatalf("steps = %v, want %v", got, want)
+	}
+}
+
+func TestMiddlewarePanicPropagation(t *testing.T) {
+	tests := []struct {
+		name       string
+		middleware func(r *recorder) []Middleware
+		want       []string
+	}{
+		{
+			// The panic unwinds through the middleware, which never see it return
+			name: "without Recover",
+			middleware: func(r *recorder) []Middleware {
+				return []Middleware{r.middleware("outer"), r.middleware("inner")}
+			},
+			want: []string{"outer before", "inner before"},
+		},
+		{
+			// Middleware registered outside Recover observe the panic as a *PanicError
+			name: "with Recover",
+			middleware: func(r *recorder) []Middleware {
+				return []Middleware{r.middleware("outer"), Recover(), r.middleware("inner")}
+			},
+			want: []string{"outer before", "inner before", "outer after panic"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &recorder{}
+			pool := NewPool(1, 1, 0, WithMiddleware(test.middleware(r)...))
+			defer pool.Close()
+
+			_, err := Submit(pool, func(context.Context) (int, error) {
+				panic("boom")
+			}).Await(context.Background())
+
+			// Either way the pool reports the panic instead of crashing the worker
+			var panicErr *PanicError
+			if !errors.As(err, &panicErr) || panicErr.Value != "boom" {
+				t.Fatalf("Await: err = %v, want a *PanicError for boom", err)
+			}
+			if got := r.list(); !slices.Equal(got, test.want) {
+				t.Fatalf("steps = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTimeoutReportsHungTask(t *testing.T) {
+	reported := make(chan time.Duration, 1)
+	release := make(chan token)
+	defer close(release)
+
+	task := Timeout(10*time.Millisecond, func(_, elapsed time.Duration) {
+		reported <- elapsed
+	})(func(context.Context) error {
+		<-release // Ignores its context
+		return nil
+	})
+
+	go task(context.Background())
+
+	select {
+	case elapsed := <-reported:
+		if elapsed < 10*time.Millisecond {
+			t.Fatalf("elapsed = %s, want at least the budget", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("onTimeout was not called while the task was still running")
+	}
+}
+
+func TestTimeoutIgnoresTasksWithinBudget(t *testing.T) {
+	reported := make(chan time.Duration, 1)
+
+	task := Timeout(20*time.Millisecond, func(_, elapsed time.Duration) {
+		reported <- elapsed
+	})(func(context.Context) error { return nil })
+
+	if err := task(context.Background()); err != nil {
+		t.Fatalf("task: %v", err)
+	}
+
+	select {
+	case <-reported:
+		t.Fatal("onTimeout was called for a task that finished in time")
+	case <-time.After(40 * time.Millisecond):
+	}
+}
@@ -0,0 +1,174 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Handler executes a persistent task from its serialized payload.
+type Handler func(ctx context.Context, payload []byte) error
+
+// StoredTask is the durable form of a task scheduled with SchedulePersistent.
+// Only the handler name and the payload are stored; the handler is looked up again on recovery.
+type StoredTask struct {
+	ID         string
+	Name       string
+	Payload    []byte
+	Priority   Priority
+	EnqueuedAt time.Time
+}
+
+// TaskStore durably records persistent tasks until they are acknowledged.
+// Implementations must be safe for concurrent use.
+type TaskStore interface {
+	// Append durably stores a task before it is queued. Its ID is already set.
+	Append(ctx context.Context, task *StoredTask) error
+	// Ack removes a task that no longer needs to be delivered.
+	Ack(ctx context.Context, id string) error
+	// Pending returns every stored task that has not been acknowledged, oldest first.
+	Pending(ctx context.Context) ([]*StoredTask, error)
+}
+
+/**
+ * WithTaskStore makes tasks scheduled with SchedulePersistent survive restarts.
+ *
+ * Delivery is at-least-once:
+ * 	- a task is appended to the store before it is queued,
+ * 	- it is acknowledged once it succeeds, or once it fails for good and is captured by the dead letter queue,
+ * 	- anything else (queued or running during a crash, queued or backing off at Shutdown, failed
+ * 	  without a dead letter queue) stays in the store and is queued again by Recover on the next start.
+ *
+ * Handlers should therefore be idempotent.
+ */
+func WithTaskStore(store TaskStore) Option {
+	return func(p *Pool) {
+		p.store = store
+	}
+}
+
+// Register makes handler available to persistent tasks scheduled under name.
+// Every handler has to be registered before Recover is called.
+func (p *Pool) Register(name string, handler Handler) {
+	p.handlersMutex.Lock()
+	defer p.handlersMutex.Unlock()
+
+	if p.handlers == nil {
+		p.handlers = make(map[string]Handler)
+	}
+	p.handlers[name] = handler
+}
+
+// handler returns the handler registered under name.
+func (p *Pool) handler(name string) (Handler, error) {
+	p.handlersMutex.RLock()
+	defer p.handlersMutex.RUnlock()
+
+	handler, ok := p.handlers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTask, name)
+	}
+
+	return handler, nil
+}
+
+// SchedulePersistent stores a task for the handler registered under name and queues it
+// with PriorityNormal. The task is redelivered after a crash until it is acknowledged.
+// Returns ErrNoTaskStore if the pool has no task store and ErrUnknownTask if no handler is registered.
+func (p *Pool) SchedulePersistent(ctx context.Context, name string, payload []byte) error {
+	return p.SchedulePersistentPriority(ctx, PriorityNormal, name, payload)
+}
+
+// SchedulePersistentPriority is like SchedulePersistent but queues the task with the given priority.
+func (p *Pool) SchedulePersistentPriority(ctx context.Context, priority Priority, name string, payload []byte) error {
+	if p.store == nil {
+		return ErrNoTaskStore
+	}
+
+	handler, err := p.handler(name)
+	if err != nil {
+		return err
+	}
+
+	stored := &StoredTask{
+		ID:         uuid.NewString(),
+		Name:       name,
+		Payload:    payload,
+		Priority:   priority,
+		EnqueuedAt: time.Now(),
+	}
+
+	if err := p.store.Append(ctx, stored); err != nil {
+		return err
+	}
+
+	if err := p.enqueue(p.persistentJob(stored, handler), blockIndefinitely); err != nil {
+		// The caller learns about the rejection, so the task must not come back on restart
+		return errors.Join(err, p.store.Ack(ctx, stored.ID))
+	}
+
+	return nil
+}
+
+// Recover queues every task left unacknowledged in the store, e.g. by a crash or an expired
+// shutdown, and returns how many were queued. Tasks without a registered handler are left
+// in the store and reported in the returned error.
+// Recover is meant to be called once at startup, before new persistent tasks are scheduled.
+func (p *Pool) Recover(ctx context.Context) (int, error) {
+	if p.store == nil {
+		return 0, ErrNoTaskStore
+	}
+
+	pending, err := p.store.Pending(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	recovered := 0
+	var errs []error
+
+	for _, stored := range pending {
+		handler, err := p.handler(stored.Name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("task %s: %w", stored.ID, err))
+			continue
+		}
+
+		if err := p.enqueue(p.persistentJob(stored, handler), blockIndefinitely); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		recovered++
+	}
+
+	return recovered, errors.Join(errs...)
+}
+
+// persistentJob builds the job of a stored task, acknowledging it once it leaves the pool for good.
+func (p *Pool) persistentJob(stored *StoredTask, handler Handler) *job {
+	j := &job{
+		name:     stored.Name,
+		payload:  stored.Payload,
+		priority: stored.Priority,
+		task: func(ctx context.Context) error {
+			return handler(ctx, stored.Payload)
+		},
+	}
+
+	j.finish = func(err error) {
+		// Dropped by Shutdown, whether queued or backing off, or failed without a dead letter
+		if errors.Is(err, ErrPoolClosed) || (err != nil && !j.deadLettered) {
+			return // Left in the store for redelivery
+		}
+
+		if ackErr := p.store.Ack(context.Background(), stored.ID); ackErr != nil {
+			log.Printf("workerpool: ack of task %s (%s) failed, it will be redelivered: %v", stored.ID, stored.Name, ackErr)
+		}
+	}
+
+	return j
+}
@@ -0,0 +1,213 @@
+package workerpool
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTaskStore opens a file task store in a temporary directory and closes it with the test.
+func openTaskStore(t *testing.T, path string) *FileTaskStore {
+	store, err := NewFileTaskStore(path)
+	if err != nil {
+		t.Fatalf("NewFileTaskStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+// pendingIDs returns the IDs of the tasks pending in store, oldest first.
+func pendingIDs(t *testing.T, store TaskStore) []string {
+	tasks, err := store.Pending(context.Background())
+	if err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	return ids
+}
+
+func equalIDs(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFileTaskStoreReplaysLog(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tasks.wal")
+
+	store := openTaskStore(t, path)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := store.Append(ctx, &StoredTask{ID: id, Name: "task", Payload: []byte(id), EnqueuedAt: time.Now()}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	if err := store.Ack(ctx, "b"); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	store.Close()
+
+	reopened := openTaskStore(t, path)
+	if got := pendingIDs(t, reopened); !equalIDs(got, []string{"a", "c"}) {
+		t.Fatalf("pending after reopen = %v, want [a c]", got)
+	}
+}
+
+func TestFileTaskStoreDropsTornRecord(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tasks.wal")
+
+	store := openTaskStore(t, path)
+	if err := store.Append(ctx, &StoredTask{ID: "a", Name: "task"}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	store.Close()
+
+	// Simulate a crash in the middle of writing the next record
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatalf("open log: %v", err)
+	}
+	file.WriteString(`{"op":"append","id":"b","task":{"ID":`)
+	file.Close()
+
+	reopened := openTaskStore(t, path)
+	if err := reopened.Append(ctx, &StoredTask{ID: "c", Name: "task"}); err != nil {
+		t.Fatalf("Append after recovery: %v", err)
+	}
+	reopened.Close()
+
+	if got := pendingIDs(t, openTaskStore(t, path)); !equalIDs(got, []string{"a", "c"}) {
+		t.Fatalf("pending = %v, want [a c]", got)
+	}
+}
+
+func TestFileTaskStoreCompacts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tasks.wal")
+
+	store := openTaskStore(t, path)
+	if err := store.Append(ctx, &StoredTask{ID: "kept", Name: "task"}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	for i := range compactThreshold + 1 {
+		id := fmt.Sprintf("acked-%d", i)
+		if err := store.Append(ctx, &StoredTask{ID: id, Name: "task"}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+		if err := store.Ack(ctx, id); err != nil {
+			t.Fatalf("Ack: %v", err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat log: %v", err)
+	}
+	if info.Size() > 4096 {
+		t.Fatalf("log size = %d bytes, want it compacted", info.Size())
+	}
+
+	store.Close()
+	if got := pendingIDs(t, openTaskStore(t, path)); !equalIDs(got, []string{"kept"}) {
+		t.Fatalf("pending after compaction = %v, want [kept]", got)
+	}
+}
+
+func TestPersistentTaskIsAckedOnSuccess(t *testing.T) {
+	store := openTaskStore(t, filepath.Join(t.TempDir(), "tasks.wal"))
+	pool := NewPool(1, 4, 0, WithTaskStore(store))
+
+	done := make(chan token)
+	pool.Register("task", func(context.Context, []byte) error {
+		close(done)
+		return nil
+	})
+
+	if err := pool.SchedulePersistent(context.Background(), "task", nil); err != nil {
+		t.Fatalf("SchedulePersistent: %v", err)
+	}
+	<-done
+
+	if _, err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if got := pendingIDs(t, store); len(got) != 0 {
+		t.Fatalf("pending = %v, want none", got)
+	}
+}
+
+func TestPersistentTaskBackingOffAtShutdownIsRedelivered(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tasks.wal")
+	store := openTaskStore(t, path)
+	dlq := NewMemoryDeadLetterQueue(0)
+
+	pool := NewPool(1, 4, 0,
+		WithTaskStore(store),
+		WithDeadLetterQueue(dlq),
+		WithRetryPolicy(&RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}),
+	)
+
+	attempted := make(chan token, 1)
+	pool.Register("task", func(context.Context, []byte) error {
+		attempted <- token{}
+		return errTask
+	})
+
+	if err := pool.SchedulePersistent(ctx, "task", []byte("payload")); err != nil {
+		t.Fatalf("SchedulePersistent: %v", err)
+	}
+	<-attempted
+
+	for {
+		pool.retryMutex.Lock()
+		pending := len(pool.retryTimers)
+		pool.retryMutex.Unlock()
+		if pending == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if dropped, err := pool.Shutdown(ctx); err != nil || dropped != 0 {
+		t.Fatalf("Shutdown = %d, %v; want 0, nil", dropped, err)
+	}
+	if n := pool.RetriesDropped(); n != 1 {
+		t.Fatalf("RetriesDropped = %d, want 1", n)
+	}
+	if n := dlq.Len(); n != 0 {
+		t.Fatalf("dead letters = %d, want none for a task dropped by Shutdown", n)
+	}
+
+	// The next start picks the task up again
+	restarted := NewPool(1, 4, 0, WithTaskStore(store))
+	defer restarted.Close()
+
+	redelivered := make(chan []byte, 1)
+	restarted.Register("task", func(_ context.Context, payload []byte) error {
+		redelivered <- payload
+		return nil
+	})
+
+	if n, err := restarted.Recover(ctx); err != nil || n != 1 {
+		t.Fatalf("Recover = %d, %v; want 1, nil", n, err)
+	}
+	if payload := <-redelivered; string(payload) != "payload" {
+		t.Fatalf("redelivered payload = %q, want %q", payload, "payload")
+	}
+}
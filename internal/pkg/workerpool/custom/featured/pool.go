@@ -1 +1,417 @@
-package workerpool
\ No newline at end of file
+package workerpool
+
+import (
+	"context"
+	"pkg/workerpool"
+	"pkg/workerpool/telemetry"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Pool implements a worker pool whose tasks receive a context and report an error.
+// Unlike the fixed and adaptive pools, task outcomes are not swallowed: they can be
+// collected through the futures returned by Submit and SubmitAll.
+type Pool struct {
+	maxWorkers  int            // Maximum number of workers allowed
+	queue       *priorityQueue // Queue for pending tasks, ordered by priority
+	semaphore   chan token     // Semaphore to control worker count
+	waitGroup   sync.WaitGroup
+	ctx         context.Context    // Context handed to every task, cancelled on Close
+	cancel      context.CancelFunc // Cancels ctx
+	mutex       sync.RWMutex       // Guards closed against concurrent scheduling
+	closed      bool               // Set once the pool stops admitting tasks
+	abort       chan token         // Closed when the shutdown deadline passes, workers stop picking up tasks
+	closeOnce   sync.Once
+	abortOnce   sync.Once
+	aging       time.Duration      // Wait time per priority level gained by queued tasks
+	breaker     *CircuitBreaker    // Optional admission gate, nil when disabled
+	retry       *RetryPolicy       // Optional retry policy for failed tasks, nil when disabled
+	metrics     *telemetry.Metrics // Exported pool metrics, nil when disabled
+	deadLetters DeadLetterQueue    // Optional sink for tasks that fail for good, nil when disabled
+	store       TaskStore          // Optional durable store for persistent tasks, nil when disabled
+
+	retryTimers    map[*job]pendingRetry // Jobs waiting for their backoff delay to elapse
+	retriesStopped bool                  // Set by Shutdown, failed jobs are dropped instead of retried
+	retriesDropped atomic.Int64          // Jobs whose retry was dropped by Shutdown
+	retryMutex     sync.Mutex            // Guards retryTimers and retriesStopped
+
+	handlers      map[string]Handler // Handlers of persistent tasks by name
+	handlersMutex sync.RWMutex       // Guards handlers
+
+	middleware      atomic.Pointer[Middleware] // Composed middleware wrapping every task, nil when none
+	middlewareMutex sync.Mutex                 // Serializes Use
+}
+
+// Task is a unit of work executed by the featured pool.
+// The context is cancelled when the pool shuts down.
+type Task func(ctx context.Context) error
+
+// Option configures optional behaviour of the featured pool.
+type Option func(*Pool)
+
+// Simplified type aliases for better readability
+type token = struct{}
+
+// blockIndefinitely makes enqueue wait for queue space without a timeout.
+const blockIndefinitely time.Duration = -1
+
+// dontBlock makes enqueue fail with ErrQueueFull rather than wait for queue space.
+const dontBlock time.Duration = -2
+
+// WithAging sets how long a queued task has to wait to gain one priority level.
+// Aging keeps low-priority tasks from starving behind a steady flow of high-priority work.
+// A zero interval disables aging; tasks of equal priority always run in FIFO order.
+func WithAging(interval time.Duration) Option {
+	return func(p *Pool) {
+		p.aging = interval
+	}
+}
+
+// NewPool creates a new featured goroutine pool with specified parameters.
+//
+// Parameters:
+//   - maxWorkers: Maximum number of goroutines that can be created
+//   - queueSize: Maximum number of tasks that can wait in the queue
+//   - preAllocWorkers: Number of workers to create in advance (0 for lazy initialization)
+//   - opts: Optional behaviour such as WithAging
+//
+// The pool will create workers on demand up to maxWorkers.
+func NewPool(maxWorkers, queueSize, preAllocWorkers int, opts ...Option) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	pool := &Pool{
+		maxWorkers: maxWorkers,
+		semaphore:  make(chan token, maxWorkers),
+		ctx:        ctx,
+		cancel:     cancel,
+		abort:      make(chan token),
+		aging:      DefaultAgingInterval,
+	}
+
+	for _, opt := range opts {
+		opt(pool)
+	}
+
+	pool.queue = newPriorityQueue(queueSize, pool.aging)
+	pool.metrics.Observe(pool.QueueDepth, pool.ActiveWorkerCount)
+
+	// Initialize workers upfront if requested
+	if preAllocWorkers > 0 {
+		preAllocWorkers = min(preAllocWorkers, maxWorkers)
+		for i := 0; i < preAllocWorkers; i++ {
+			pool.semaphore <- token{}
+			pool.startWorker()
+		}
+	}
+
+	return pool
+}
+
+// WithCircuitBreaker gates task admission with the given circuit breaker.
+// Rejected tasks return a *CircuitOpenError and every finished task reports its final outcome, after retries, to the breaker.
+func WithCircuitBreaker(breaker *CircuitBreaker) Option {
+	return func(p *Pool) {
+		p.breaker = breaker
+	}
+}
+
+// Schedule adds a task with PriorityNormal to be executed by the worker pool.
+// If the queue is full, it tries to start a new worker.
+// If the worker limit is reached, it blocks until the queue has space.
+// Returns ErrPoolClosed if the pool has been closed and a *CircuitOpenError
+// if the circuit breaker rejects the task.
+func (p *Pool) Schedule(task Task) error {
+	return p.SchedulePriority(PriorityNormal, task)
+}
+
+// SchedulePriority adds a task with the given priority to be executed by the worker pool.
+// Queued tasks with a higher priority are dequeued first.
+func (p *Pool) SchedulePriority(priority Priority, task Task) error {
+	return p.enqueue(&job{task: task, priority: priority}, blockIndefinitely)
+}
+
+// ScheduleNamed adds a task with PriorityNormal that carries a name and an optional payload.
+// Both are recorded with the task if it ends up in the dead letter queue, so operators can
+// tell failed tasks apart and inspect their input. The payload is never interpreted by the pool.
+func (p *Pool) ScheduleNamed(name string, payload []byte, task Task) error {
+	return p.enqueue(&job{task: task, name: name, payload: payload, priority: PriorityNormal}, blockIndefinitely)
+}
+
+// ScheduleTimeout attempts to schedule a task with PriorityNormal and a timeout.
+// Returns ErrScheduleTimeout if the task couldn't be scheduled within the given timeout
+// and ErrPoolClosed if the pool has been closed.
+func (p *Pool) ScheduleTimeout(timeout time.Duration, task Task) error {
+	return p.SchedulePriorityTimeout(timeout, PriorityNormal, task)
+}
+
+// SchedulePriorityTimeout attempts to schedule a task with the given priority and a timeout.
+func (p *Pool) SchedulePriorityTimeout(timeout time.Duration, priority Priority, task Task) error {
+	return p.enqueue(&job{task: task, priority: priority}, max(timeout, 0))
+}
+
+// TrySchedule adds a task with PriorityNormal only if there is room in the queue right away.
+// It never blocks and returns ErrQueueFull if the queue is full, ErrPoolClosed if the pool
+// has been closed and a *CircuitOpenError if the circuit breaker rejects the task.
+func (p *Pool) TrySchedule(task Task) error {
+	return p.enqueue(&job{task: task, priority: PriorityNormal}, dontBlock)
+}
+
+// enqueue admits a job and adds it to the queue.
+// If the queue is full, it tries to start a new worker and then waits for space,
+// giving up after timeout unless timeout is blockIndefinitely. With dontBlock it returns ErrQueueFull instead.
+func (p *Pool) enqueue(j *job, timeout time.Duration) error {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.closed {
+		return p.rejected(ErrPoolClosed)
+	}
+
+	if err := p.admit(j); err != nil {
+		return p.rejected(err)
+	}
+
+	// Fast path: try to enqueue without blocking
+	if p.queue.tryPush(j) {
+		p.ensureWorker()
+		return nil
+	}
+
+	if timeout == dontBlock {
+		j.cancel()
+		return p.rejected(ErrQueueFull)
+	}
+
+	// Queue is full, try to acquire a worker slot and spawn a new worker
+	select {
+	case p.semaphore <- token{}:
+		p.startWorker()
+	default:
+		// Worker limit reached, wait until queue has space
+	}
+
+	var expired <-chan time.Time
+	if timeout != blockIndefinitely {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	if err := p.queue.push(j, expired); err != nil {
+		j.cancel()
+		return p.rejected(err)
+	}
+
+	return nil
+}
+
+// admit asks the circuit breaker, if any, to let the job in.
+func (p *Pool) admit(j *job) error {
+	if p.breaker == nil {
+		return nil
+	}
+
+	done, release, err := p.breaker.admit()
+	if err != nil {
+		return err
+	}
+
+	j.done, j.release = done, release
+	return nil
+}
+
+// startWorker launches a new worker goroutine that processes tasks from the queue.
+// The caller must have acquired a semaphore slot; it is released when the worker exits.
+func (p *Pool) startWorker() {
+	p.waitGroup.Add(1)
+	p.metrics.ScaledUp(p.ctx)
+
+	go func() {
+		defer p.waitGroup.Done()
+		defer p.metrics.ScaledDown(p.ctx)
+		defer func() { <-p.semaphore }() // Release worker slot when done
+
+		// Process tasks until the queue is drained on shutdown
+		for {
+			// Stop picking up tasks once the shutdown deadline has passed
+			select {
+			case <-p.abort:
+				return
+			default:
+			}
+
+			j, ok := p.queue.pop()
+			if !ok {
+				return
+			}
+
+			p.process(j)
+		}
+	}()
+}
+
+// process executes one attempt of a job and decides what happens next:
+// failed attempts may be retried, otherwise the job is finished and its final
+// outcome is reported to the circuit breaker.
+func (p *Pool) process(j *job) {
+	j.attempts++
+	if j.firstAttempt.IsZero() {
+		j.firstAttempt = time.Now()
+	}
+
+	start := time.Now()
+	err := p.execute(j.task)
+	p.recordTask(start, err)
+
+	if err != nil && p.retry != nil {
+		if p.retry.shouldRetry(err, j.attempts) {
+			p.retryLater(j, err)
+			return
+		}
+
+		p.retry.exhaust(p.ctx, j, err)
+		p.deadLetter(j, err)
+	} else if isPanic(err) {
+		p.deadLetter(j, err)
+	}
+
+	j.report(err)
+	j.complete(err)
+}
+
+// ensureWorker starts a worker when none is running, so lazily initialized
+// pools don't leave tasks sitting in a queue that hasn't filled up yet.
+func (p *Pool) ensureWorker() {
+	if len(p.semaphore) > 0 {
+		return
+	}
+
+	select {
+	case p.semaphore <- token{}:
+		p.startWorker()
+	default:
+	}
+}
+
+// execute runs a single task through the registered middleware, converting a panic
+// into a *PanicError so that one misbehaving task cannot take the worker down with it.
+func (p *Pool) execute(task Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+
+	if middleware := p.middleware.Load(); middleware != nil {
+		task = (*middleware)(task)
+	}
+
+	return task(p.ctx)
+}
+
+// QueueDepth returns the current number of tasks in the queue
+func (p *Pool) QueueDepth() int {
+	return p.queue.len()
+}
+
+// QueueDepthByPriority returns the current number of queued tasks per priority level.
+// Levels without queued tasks are omitted.
+func (p *Pool) QueueDepthByPriority() map[Priority]int {
+	return p.queue.depthByPriority()
+}
+
+// ActiveWorkerCount returns the current number of active workers
+func (p *Pool) ActiveWorkerCount() int {
+	return len(p.semaphore)
+}
+
+// RetriesDropped returns the number of jobs whose retry was cut short by Shutdown.
+func (p *Pool) RetriesDropped() int {
+	return int(p.retriesDropped.Load())
+}
+
+// Stats returns a snapshot of the pool's workers and queue.
+func (p *Pool) Stats() workerpool.Stats {
+	return workerpool.Stats{
+		ActiveWorkers: p.ActiveWorkerCount(),
+		MaxWorkers:    p.maxWorkers,
+		QueueDepth:    p.QueueDepth(),
+		QueueSize:     cap(p.queue.slots),
+	}
+}
+
+// Shutdown stops admitting tasks and waits for queued and running tasks to finish.
+// Schedule calls made afterwards, or still blocked on a full queue, return ErrPoolClosed.
+//
+// Tasks waiting for a retry are not retried again: their backoff is cut short and their futures
+// complete with their last error joined with ErrPoolClosed. They are neither exhausted nor
+// dead-lettered, and as they were not queued Shutdown doesn't count them: RetriesDropped does,
+// and the metrics record them as rejected because the pool is closing.
+//
+// If ctx is done before the pool has drained, the task context is cancelled, queued tasks
+// are discarded (their futures complete with ErrPoolClosed) and Shutdown returns their number
+// along with ctx.Err().
+func (p *Pool) Shutdown(ctx context.Context) (int, error) {
+	p.closeOnce.Do(func() {
+		// Wake up Schedule calls blocked on a full queue
+		p.queue.close()
+
+		// Wait for Schedule calls in progress, so nothing is queued after this point
+		p.mutex.Lock()
+		p.closed = true
+		p.mutex.Unlock()
+
+		p.queue.finish()
+
+		// Jobs in backoff would only be retried into a closed queue
+		p.stopRetries()
+
+		// Make sure someone drains the queue, even if no worker has been started yet
+		if p.queue.len() > 0 {
+			p.ensureWorker()
+		}
+	})
+
+	finished := make(chan token)
+	go func() {
+		p.waitGroup.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		p.cancel()
+		p.metrics.Close()
+		return 0, nil
+	case <-ctx.Done():
+		p.cancel()
+		p.abortOnce.Do(func() { close(p.abort) })
+
+		dropped := p.queue.discard()
+		for _, j := range dropped {
+			j.cancel()
+			j.complete(ErrPoolClosed)
+		}
+
+		p.metrics.Close()
+		return len(dropped), ctx.Err()
+	}
+}
+
+// Close shuts down the pool and waits for all workers to finish.
+// The task context is cancelled first, so running and queued tasks can bail out early.
+// Tasks scheduled after Close are rejected with ErrPoolClosed.
+func (p *Pool) Close() {
+	p.cancel()
+	p.Shutdown(context.Background())
+}
+
+// min returns the smaller of two integers
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -1 +1,279 @@
-package workerpool
\ No newline at end of file
+package workerpool
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Priority determines the order in which queued tasks are dequeued.
+// Higher values are dequeued first; any integer is accepted.
+type Priority int
+
+// Common priority levels. Values in between (or beyond) are valid as well.
+const (
+	PriorityLow    Priority = 0
+	PriorityNormal Priority = 10
+	PriorityHigh   Priority = 20
+)
+
+// DefaultAgingInterval is how long a task has to wait to gain one priority level.
+// With the default levels a low-priority task overtakes fresh high-priority work after 10s.
+const DefaultAgingInterval = 500 * time.Millisecond
+
+/**
+ * priorityQueue is a bounded, blocking priority queue of jobs.
+ *
+ * Starvation protection (aging):
+ * 	A job's effective priority grows by one level for every aging interval it spends in the queue:
+ *
+ * 		effective(t) = priority + (t - enqueuedAt) / aging
+ *
+ * 	Comparing two jobs a and b at the same instant t, the t term cancels out: a goes first when
+ *
+ * 		a.priority - b.priority > (a.enqueuedAt - b.enqueuedAt) / aging
+ *
+ * 	which never changes after the push. The heap therefore stays valid without re-sorting as jobs age.
+ * 	The comparison is done without multiplying priorities by the aging interval, so it holds for any priority.
+ *
+ * Capacity:
+ * 	slots holds one token per queued (or being queued) job and bounds the queue size,
+ * 	ready holds one token per job that can be popped. Both are channels so producers and
+ * 	consumers can block, time out and observe close in a single select.
+ */
+type priorityQueue struct {
+	mutex    sync.Mutex
+	items    jobHeap
+	depth    map[Priority]int // Number of queued jobs per priority level
+	slots    chan token       // Reserved queue capacity
+	ready    chan token       // Jobs available for pop
+	closed   chan token       // Closed when pushes are rejected
+	drained  chan token       // Closed when no more jobs will be pushed, pop fails once the queue is empty
+	epoch    time.Time        // Reference point for push times
+	aging    time.Duration    // Wait time per priority level gained, 0 disables aging
+	sequence uint64           // Tie breaker keeping equal effective priorities in FIFO order
+}
+
+// job is a queued task together with its scheduling metadata.
+type job struct {
+	task         Task
+	name         string // Optional task name, reported with dead letters
+	payload      []byte // Optional serialized task input, reported with dead letters
+	priority     Priority
+	enqueuedAt   time.Duration // Push time, relative to the queue epoch
+	sequence     uint64
+	done         func(err error) // Reports the final outcome to the circuit breaker, if any
+	release      func()          // Returns the circuit breaker admission of a job that never finished, if any
+	finish       func(err error) // Receives the final outcome once the job leaves the pool, if set
+	attempts     int             // Number of times the task has been executed
+	firstAttempt time.Time       // When the task was first executed
+	deadLettered bool            // Set once the job has been stored in the dead letter queue
+}
+
+// complete hands the final outcome of the job to its finish callback.
+func (j *job) complete(err error) {
+	if j.finish != nil {
+		j.finish(err)
+	}
+}
+
+// report hands the final outcome of the job to the circuit breaker, at most once.
+func (j *job) report(err error) {
+	if j.done != nil {
+		j.done(err)
+	}
+	j.done, j.release = nil, nil
+}
+
+// cancel returns the circuit breaker admission of a job that was rejected or dropped, at most once.
+func (j *job) cancel() {
+	if j.release != nil {
+		j.release()
+	}
+	j.done, j.release = nil, nil
+}
+
+func newPriorityQueue(size int, aging time.Duration) *priorityQueue {
+	if size < 1 {
+		size = 1
+	}
+
+	return &priorityQueue{
+		items:   jobHeap{aging: aging},
+		depth:   make(map[Priority]int),
+		slots:   make(chan token, size),
+		ready:   make(chan token, size),
+		closed:  make(chan token),
+		drained: make(chan token),
+		epoch:   time.Now(),
+		aging:   aging,
+	}
+}
+
+// tryPush adds a job without blocking. It returns false if the queue is full.
+func (q *priorityQueue) tryPush(j *job) bool {
+	select {
+	case q.slots <- token{}:
+		q.insert(j)
+		return true
+	default:
+		return false
+	}
+}
+
+// push adds a job, blocking until space is available or timeout fires.
+// A nil timeout blocks indefinitely. It returns ErrScheduleTimeout if timeout fired first
+// and ErrPoolClosed if the queue was closed while waiting.
+func (q *priorityQueue) push(j *job, timeout <-chan time.Time) error {
+	select {
+	case q.slots <- token{}:
+		q.insert(j)
+		return nil
+	case <-timeout:
+		return ErrScheduleTimeout
+	case <-q.closed:
+		return ErrPoolClosed
+	}
+}
+
+// insert places a job in the heap once its slot has been reserved.
+func (q *priorityQueue) insert(j *job) {
+	q.mutex.Lock()
+	j.enqueuedAt = time.Since(q.epoch)
+	j.sequence = q.sequence
+	q.sequence++
+	heap.Push(&q.items, j)
+	q.depth[j.priority]++
+	q.mutex.Unlock()
+
+	q.ready <- token{}
+}
+
+// pop removes the job with the highest effective priority, blocking until one is available.
+// It returns false once the queue is drained.
+func (q *priorityQueue) pop() (*job, bool) {
+	select {
+	case <-q.ready:
+		return q.remove(), true
+	case <-q.drained:
+		// Drain whatever is still queued before reporting closure
+		select {
+		case <-q.ready:
+			return q.remove(), true
+		default:
+			return nil, false
+		}
+	}
+}
+
+// remove takes the top job out of the heap and frees its slot.
+func (q *priorityQueue) remove() *job {
+	q.mutex.Lock()
+	j := heap.Pop(&q.items).(*job)
+	q.depth[j.priority]--
+	if q.depth[j.priority] == 0 {
+		delete(q.depth, j.priority)
+	}
+	q.mutex.Unlock()
+
+	<-q.slots
+	return j
+}
+
+// close rejects pending and future pushes. Jobs already queued can still be popped.
+func (q *priorityQueue) close() {
+	close(q.closed)
+}
+
+// finish lets pop fail once the queue is empty. It must be called after close,
+// once no push can still be in progress.
+func (q *priorityQueue) finish() {
+	close(q.drained)
+}
+
+// discard removes every queued job without running it.
+func (q *priorityQueue) discard() []*job {
+	var jobs []*job
+	for {
+		select {
+		case <-q.ready:
+			jobs = append(jobs, q.remove())
+		default:
+			return jobs
+		}
+	}
+}
+
+// len returns the number of queued jobs.
+func (q *priorityQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.items.Len()
+}
+
+// depthByPriority returns a snapshot of the number of queued jobs per priority level.
+func (q *priorityQueue) depthByPriority() map[Priority]int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	depth := make(map[Priority]int, len(q.depth))
+	for priority, count := range q.depth {
+		depth[priority] = count
+	}
+
+	return depth
+}
+
+// jobHeap implements heap.Interface, ordering by effective priority and then by push order.
+type jobHeap struct {
+	jobs  []*job
+	aging time.Duration // Wait time per priority level gained, 0 disables aging
+}
+
+func (h *jobHeap) Len() int { return len(h.jobs) }
+
+func (h *jobHeap) Less(i, j int) bool {
+	a, b := h.jobs[i], h.jobs[j]
+	if h.aging <= 0 {
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		return a.sequence < b.sequence
+	}
+
+	// a goes first when its lead in priority exceeds the levels b gained by waiting longer.
+	// Push times are non-negative, so their difference cannot overflow.
+	lead := int64(a.priority) - int64(b.priority)
+	if (lead < 0) != (a.priority < b.priority) {
+		// The priorities are further apart than any wait time can make up for
+		return a.priority > b.priority
+	}
+
+	waited := a.enqueuedAt - b.enqueuedAt
+	levels := int64(waited / h.aging)
+	if waited%h.aging < 0 {
+		levels-- // Round towards minus infinity
+	}
+	if lead != levels {
+		return lead > levels
+	}
+	if waited%h.aging != 0 {
+		// a's lead only falls short of b's wait by a fraction of a level
+		return false
+	}
+	return a.sequence < b.sequence
+}
+
+func (h *jobHeap) Swap(i, j int) { h.jobs[i], h.jobs[j] = h.jobs[j], h.jobs[i] }
+
+func (h *jobHeap) Push(x any) { h.jobs = append(h.jobs, x.(*job)) }
+
+func (h *jobHeap) Pop() any {
+	old := h.jobs
+	n := len(old)
+	j := old[n-1]
+	old[n-1] = nil
+	h.jobs = old[:n-1]
+	return j
+}
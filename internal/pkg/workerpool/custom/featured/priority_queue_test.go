@@ -0,0 +1,180 @@
+package workerpool
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// elapse moves the queue clock forward: jobs pushed from now on are timed as if d had passed.
+func (q *priorityQueue) elapse(d time.Duration) {
+	q.epoch = q.epoch.Add(-d)
+}
+
+// popNames pops every queued job and returns their names in order.
+func popNames(t *testing.T, q *priorityQueue) []string {
+	t.Helper()
+
+	var names []string
+	for q.len() > 0 {
+		j, ok := q.pop()
+		if !ok {
+			t.Fatal("pop failed with jobs queued")
+		}
+		names = append(names, j.name)
+	}
+	return names
+}
+
+func pushNamed(t *testing.T, q *priorityQueue, name string, priority Priority) {
+	t.Helper()
+
+	if !q.tryPush(&job{name: name, priority: priority}) {
+		t.Fatalf("push %s: queue full", name)
+	}
+}
+
+func TestPriorityQueueOrdersByPriorityThenFIFO(t *testing.T) {
+	q := newPriorityQueue(10, DefaultAgingInterval)
+
+	pushNamed(t, q, "low-1", PriorityLow)
+	pushNamed(t, q, "normal-1", PriorityNormal)
+	pushNamed(t, q, "high-1", PriorityHigh)
+	pushNamed(t, q, "normal-2", PriorityNormal)
+	pushNamed(t, q, "high-2", PriorityHigh)
+	pushNamed(t, q, "custom", 15)
+
+	want := []string{"high-1", "high-2", "custom", "normal-1", "normal-2", "low-1"}
+	if got := popNames(t, q); !slices.Equal(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
+
+func TestPriorityQueueAging(t *testing.T) {
+	// Low and high priority are 20 levels apart: 10s with the default aging interval
+	tests := []struct {
+		name   string
+		aging  time.Duration
+		waited time.Duration
+		want   []string
+	}{
+		{"not waited long enough", DefaultAgingInterval, 9 * time.Second, []string{"high", "low"}},
+		{"overtakes fresh work", DefaultAgingInterval, 11 * time.Second, []string{"low", "high"}},
+		{"faster aging", 100 * time.Millisecond, 3 * time.Second, []string{"low", "high"}},
+		{"aging disabled", 0, time.Hour, []string{"high", "low"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := newPriorityQueue(10, test.aging)
+
+			pushNamed(t, q, "low", PriorityLow)
+			q.elapse(test.waited)
+			pushNamed(t, q, "high", PriorityHigh)
+
+			if got := popNames(t, q); !slices.Equal(got, test.want) {
+				t.Errorf("order = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPriorityQueueAcceptsAnyPriority(t *testing.T) {
+	q := newPriorityQueue(10, DefaultAgingInterval)
+
+	pushNamed(t, q, "min", math.MinInt)
+	pushNamed(t, q, "max", math.MaxInt)
+	pushNamed(t, q, "normal", PriorityNormal)
+	pushNamed(t, q, "below max", math.MaxInt-1)
+	pushNamed(t, q, "above min", math.MinInt+1)
+
+	want := []string{"max", "below max", "normal", "above min", "min"}
+	if got := popNames(t, q); !slices.Equal(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
+
+func TestPriorityQueueAgingAtExtremePriorities(t *testing.T) {
+	tests := []struct {
+		name      string
+		old, late Priority
+	}{
+		{"near the maximum", math.MaxInt - 1, math.MaxInt},
+		{"near the minimum", math.MinInt, math.MinInt + 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := newPriorityQueue(10, DefaultAgingInterval)
+
+			// One level apart, the old task gains two while waiting a second
+			pushNamed(t, q, "old", test.old)
+			q.elapse(time.Second)
+			pushNamed(t, q, "late", test.late)
+
+			if got, want := popNames(t, q), []string{"old", "late"}; !slices.Equal(got, want) {
+				t.Errorf("order = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPriorityQueueDepthByPriority(t *testing.T) {
+	q := newPriorityQueue(10, DefaultAgingInterval)
+
+	pushNamed(t, q, "a", PriorityHigh)
+	pushNamed(t, q, "b", PriorityHigh)
+	pushNamed(t, q, "c", PriorityLow)
+	q.pop()
+
+	depth := q.depthByPriority()
+	if depth[PriorityHigh] != 1 || depth[PriorityLow] != 1 || len(depth) != 2 {
+		t.Errorf("depth = %v, want one high and one low", depth)
+	}
+
+	q.pop()
+	q.pop()
+	if depth := q.depthByPriority(); len(depth) != 0 {
+		t.Errorf("depth = %v once empty, want none", depth)
+	}
+}
+
+func TestPriorityQueueCapacityAndClose(t *testing.T) {
+	q := newPriorityQueue(2, DefaultAgingInterval)
+
+	pushNamed(t, q, "a", PriorityNormal)
+	pushNamed(t, q, "b", PriorityNormal)
+
+	if q.tryPush(&job{name: "c"}) {
+		t.Fatal("tryPush succeeded on a full queue")
+	}
+	if err := q.push(&job{name: "c"}, time.After(10*time.Millisecond)); !errors.Is(err, ErrScheduleTimeout) {
+		t.Fatalf("push on a full queue: err = %v, want ErrScheduleTimeout", err)
+	}
+
+	// A push waiting for room is woken up by close
+	pushed := make(chan error, 1)
+	go func() { pushed <- q.push(&job{name: "c"}, nil) }()
+	time.Sleep(10 * time.Millisecond)
+	q.close()
+
+	select {
+	case err := <-pushed:
+		if !errors.Is(err, ErrPoolClosed) {
+			t.Fatalf("push during close: err = %v, want ErrPoolClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("push still waiting after close")
+	}
+
+	// Queued jobs are still handed out, then pop reports the end
+	q.finish()
+	if got := popNames(t, q); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("drained %v, want [a b]", got)
+	}
+	if _, ok := q.pop(); ok {
+		t.Error("pop succeeded on a drained queue")
+	}
+}
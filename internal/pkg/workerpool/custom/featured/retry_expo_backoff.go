@@ -1 +1,238 @@
-package workerpool
\ No newline at end of file
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"pkg/workerpool/telemetry"
+	"time"
+)
+
+// Exhausted describes a task that failed and will not be retried again,
+// either because it ran out of attempts or because its error is not retryable.
+type Exhausted struct {
+	Task         Task
+	Name         string
+	Payload      []byte
+	Err          error
+	Attempts     int
+	FirstAttempt time.Time
+	LastAttempt  time.Time
+}
+
+/**
+ * RetryPolicy retries failed tasks with exponential backoff and jitter.
+ *
+ * The delay before attempt n+1 is
+ *
+ * 	min(BaseDelay * Multiplier^(n-1), MaxDelay) ± Jitter * delay
+ *
+ * Waiting never happens inside a worker: the task is handed back to its pool once
+ * the delay has elapsed, so a backing-off task doesn't hold a worker slot.
+ */
+type RetryPolicy struct {
+	MaxAttempts int                                            // Total attempts including the first one (default 3)
+	BaseDelay   time.Duration                                  // Delay before the first retry (default 100ms)
+	MaxDelay    time.Duration                                  // Upper bound for a single delay (default 10s)
+	Multiplier  float64                                        // Growth factor between retries (default 2)
+	Jitter      float64                                        // Fraction of the delay randomized in both directions, 0..1 (0 disables jitter)
+	Retryable   func(err error) bool                           // Decides whether an error is worth retrying (default: all but cancellation)
+	OnExhausted func(ctx context.Context, exhausted Exhausted) // Sink for tasks that will not be retried again
+}
+
+// NewRetryPolicy returns a policy with the given limits, 20% jitter and defaults for everything else.
+func NewRetryPolicy(maxAttempts int, baseDelay, maxDelay time.Duration) *RetryPolicy {
+	return (&RetryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   baseDelay,
+		MaxDelay:    maxDelay,
+		Jitter:      0.2,
+	}).withDefaults()
+}
+
+// withDefaults returns a copy of the policy with zero fields set to their default values.
+func (r *RetryPolicy) withDefaults() *RetryPolicy {
+	policy := *r
+	r = &policy
+
+	if r.MaxAttempts <= 0 {
+		r.MaxAttempts = 3
+	}
+	if r.BaseDelay <= 0 {
+		r.BaseDelay = 100 * time.Millisecond
+	}
+	if r.MaxDelay <= 0 {
+		r.MaxDelay = 10 * time.Second
+	}
+	if r.Multiplier < 1 {
+		r.Multiplier = 2
+	}
+	r.Jitter = math.Max(0, math.Min(r.Jitter, 1))
+	if r.Retryable == nil {
+		r.Retryable = func(err error) bool {
+			return !errors.Is(err, context.Canceled)
+		}
+	}
+
+	return r
+}
+
+// WithRetryPolicy retries failed tasks of the featured pool according to policy.
+// Futures returned by Submit only complete once the task succeeds, is exhausted or is dropped by Shutdown.
+func WithRetryPolicy(policy *RetryPolicy) Option {
+	return func(p *Pool) {
+		p.retry = policy.withDefaults()
+	}
+}
+
+// Backoff returns the delay to wait after the given (1-based) failed attempt.
+func (r *RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := float64(r.BaseDelay) * math.Pow(r.Multiplier, float64(attempt-1))
+	delay = math.Min(delay, float64(r.MaxDelay))
+
+	if r.Jitter > 0 {
+		delay += delay * r.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(delay)
+}
+
+// shouldRetry reports whether a task that failed with err on the given attempt gets another one.
+func (r *RetryPolicy) shouldRetry(err error, attempt int) bool {
+	return attempt < r.MaxAttempts && r.Retryable(err)
+}
+
+// exhaust hands a job that will not be retried again to the sink.
+func (r *RetryPolicy) exhaust(ctx context.Context, j *job, err error) {
+	if r.OnExhausted == nil {
+		return
+	}
+
+	r.OnExhausted(ctx, Exhausted{
+		Task:         j.task,
+		Name:         j.name,
+		Payload:      j.payload,
+		Err:          err,
+		Attempts:     j.attempts,
+		FirstAttempt: j.firstAttempt,
+		LastAttempt:  time.Now(),
+	})
+}
+
+// pendingRetry is a job waiting for its backoff delay to elapse.
+type pendingRetry struct {
+	timer *time.Timer
+	err   error // Error of the attempt that failed
+}
+
+// retryLater puts a failed job back on the queue once its backoff delay has elapsed.
+// The backoff timer is tracked by the pool, so Shutdown can stop it and drop the job.
+func (p *Pool) retryLater(j *job, err error) {
+	p.retryMutex.Lock()
+	defer p.retryMutex.Unlock()
+
+	if p.retriesStopped {
+		p.dropRetry(j, err)
+		return
+	}
+
+	if p.retryTimers == nil {
+		p.retryTimers = make(map[*job]pendingRetry)
+	}
+
+	// Keeps Shutdown waiting until the timer is either stopped or done pushing
+	p.waitGroup.Add(1)
+	timer := time.AfterFunc(p.retry.Backoff(j.attempts), func() {
+		defer p.waitGroup.Done()
+
+		p.retryMutex.Lock()
+		_, pending := p.retryTimers[j]
+		delete(p.retryTimers, j)
+		p.retryMutex.Unlock()
+
+		if !pending {
+			return // Stopped by Shutdown
+		}
+
+		p.mutex.RLock()
+		defer p.mutex.RUnlock()
+
+		// The queue only rejects jobs once it is closed
+		if p.closed || p.queue.push(j, nil) != nil {
+			p.dropRetry(j, err)
+			return
+		}
+
+		p.ensureWorker()
+	})
+
+	p.retryTimers[j] = pendingRetry{timer: timer, err: err}
+}
+
+// stopRetries stops every pending backoff timer and drops its job.
+// Jobs that fail after this point are dropped instead of being retried.
+func (p *Pool) stopRetries() {
+	p.retryMutex.Lock()
+	defer p.retryMutex.Unlock()
+
+	p.retriesStopped = true
+	for j, retry := range p.retryTimers {
+		// A timer that already fired finds the pool closed and drops its job itself
+		if retry.timer.Stop() {
+			delete(p.retryTimers, j)
+			p.dropRetry(j, retry.err)
+			p.waitGroup.Done()
+		}
+	}
+}
+
+// dropRetry finishes a job whose retry was cut short by Shutdown.
+// The job is neither exhausted nor dead-lettered, so persistent tasks stay in their store for redelivery.
+func (p *Pool) dropRetry(j *job, err error) {
+	p.retriesDropped.Add(1)
+	p.metrics.Rejected(p.ctx, telemetry.ReasonClosed)
+	j.report(err)
+	j.complete(errors.Join(err, ErrPoolClosed))
+}
+
+// Decorate wraps a task for pools that run bare func() tasks, such as the fixed and adaptive pools.
+// A failed attempt is handed back to schedule after its backoff delay instead of sleeping in the worker:
+//
+//	pool.Schedule(policy.Decorate(pool.Schedule, func() error { return sendEmail() }))
+//
+// Every call of the returned func starts a new run with its own attempt count,
+// so the decorated task can be scheduled several times.
+// If schedule rejects a retry (e.g. because the pool is closed), the task is exhausted with that error.
+func (r *RetryPolicy) Decorate(schedule func(task func()) error, task func() error) func() {
+	r = r.withDefaults()
+
+	return func() {
+		r.attempt(schedule, &job{task: func(context.Context) error { return task() }}, task)
+	}
+}
+
+// attempt runs task once on behalf of j and schedules its next attempt if it failed and may be retried.
+func (r *RetryPolicy) attempt(schedule func(task func()) error, j *job, task func() error) {
+	j.attempts++
+	if j.firstAttempt.IsZero() {
+		j.firstAttempt = time.Now()
+	}
+
+	err := task()
+	if err == nil {
+		return
+	}
+
+	if r.shouldRetry(err, j.attempts) {
+		time.AfterFunc(r.Backoff(j.attempts), func() {
+			retry := func() { r.attempt(schedule, j, task) }
+			if scheduleErr := schedule(retry); scheduleErr != nil {
+				r.exhaust(context.Background(), j, errors.Join(err, scheduleErr))
+			}
+		})
+		return
+	}
+
+	r.exhaust(context.Background(), j, err)
+}
@@ -0,0 +1,216 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyRetriesUntilSuccess(t *testing.T) {
+	pool := NewPool(2, 4, 0, WithRetryPolicy(&RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+	defer pool.Close()
+
+	var attempts atomic.Int32
+	future := Submit(pool, func(context.Context) (int32, error) {
+		n := attempts.Add(1)
+		if n < 3 {
+			return n, errTask
+		}
+		return n, nil
+	})
+
+	n, err := future.Await(context.Background())
+	if err != nil || n != 3 {
+		t.Fatalf("Await = %d, %v; want 3, nil", n, err)
+	}
+}
+
+func TestRetryPolicyExhausts(t *testing.T) {
+	exhausted := make(chan Exhausted, 1)
+	pool := NewPool(2, 4, 0, WithRetryPolicy(&RetryPolicy{
+		MaxAttempts: 2,
+		BaseDelay:   time.Millisecond,
+		OnExhausted: func(_ context.Context, e Exhausted) { exhausted <- e },
+	}))
+	defer pool.Close()
+
+	future := Submit(pool, func(context.Context) (struct{}, error) { return struct{}{}, errTask })
+	if _, err := future.Await(context.Background()); !errors.Is(err, errTask) {
+		t.Fatalf("Await: err = %v, want errTask", err)
+	}
+
+	if e := <-exhausted; e.Attempts != 2 || !errors.Is(e.Err, errTask) {
+		t.Fatalf("exhausted after %d attempts with %v, want 2 attempts with errTask", e.Attempts, e.Err)
+	}
+}
+
+func TestRetryPolicyDoesNotRetryUnretryableErrors(t *testing.T) {
+	pool := NewPool(1, 1, 0, WithRetryPolicy(&RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond}))
+	defer pool.Close()
+
+	var attempts atomic.Int32
+	future := Submit(pool, func(context.Context) (struct{}, error) {
+		attempts.Add(1)
+		return struct{}{}, context.Canceled
+	})
+
+	future.Await(context.Background())
+	if n := attempts.Load(); n != 1 {
+		t.Fatalf("attempts = %d, want 1", n)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := NewRetryPolicy(5, 100*time.Millisecond, time.Second)
+	policy.Jitter = 0
+
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for i, delay := range want {
+		if got := policy.Backoff(i + 1); got != delay {
+			t.Errorf("Backoff(%d) = %s, want %s", i+1, got, delay)
+		}
+	}
+
+	policy.Jitter = 0.2
+	for range 100 {
+		if got := policy.Backoff(1); got < 80*time.Millisecond || got > 120*time.Millisecond {
+			t.Fatalf("Backoff(1) with 20%% jitter = %s, want within 80ms..120ms", got)
+		}
+	}
+}
+
+func TestRetryBackoffDoesNotHoldWorker(t *testing.T) {
+	pool := NewPool(1, 1, 0, WithRetryPolicy(&RetryPolicy{MaxAttempts: 2, BaseDelay: time.Second}))
+	defer pool.Close()
+
+	failed := make(chan token)
+	retried := Submit(pool, func(context.Context) (struct{}, error) {
+		select {
+		case <-failed:
+			return struct{}{}, nil
+		default:
+			close(failed)
+			return struct{}{}, errTask
+		}
+	})
+	<-failed
+
+	// The only worker is free while the first task backs off
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	other := Submit(pool, func(context.Context) (int, error) { return 42, nil })
+	if n, err := other.Await(ctx); err != nil || n != 42 {
+		t.Fatalf("Await = %d, %v during a backoff; want 42, nil", n, err)
+	}
+
+	if _, err := retried.Await(context.Background()); err != nil {
+		t.Fatalf("Await retried task: %v", err)
+	}
+}
+
+func TestShutdownDropsPendingRetries(t *testing.T) {
+	var exhausted atomic.Int32
+	pool := NewPool(1, 1, 0, WithRetryPolicy(&RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Hour,
+		OnExhausted: func(context.Context, Exhausted) { exhausted.Add(1) },
+	}))
+
+	attempted := make(chan token)
+	future := Submit(pool, func(context.Context) (struct{}, error) {
+		close(attempted)
+		return struct{}{}, errTask
+	})
+	<-attempted
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Wait for the first attempt to enter its backoff
+	for {
+		pool.retryMutex.Lock()
+		pending := len(pool.retryTimers)
+		pool.retryMutex.Unlock()
+		if pending == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The pool drained in time: the retry isn't counted as a dropped queued task
+	dropped, err := pool.Shutdown(ctx)
+	if err != nil || dropped != 0 {
+		t.Fatalf("Shutdown = %d, %v; want 0, nil", dropped, err)
+	}
+	if n := pool.RetriesDropped(); n != 1 {
+		t.Fatalf("RetriesDropped = %d, want 1", n)
+	}
+
+	if _, err := future.Await(ctx); !errors.Is(err, ErrPoolClosed) || !errors.Is(err, errTask) {
+		t.Fatalf("Await: err = %v, want errTask joined with ErrPoolClosed", err)
+	}
+	if n := exhausted.Load(); n != 0 {
+		t.Fatalf("OnExhausted called %d times for a dropped retry", n)
+	}
+}
+
+func TestDecorateCountsAttemptsPerCall(t *testing.T) {
+	exhausted := make(chan Exhausted, 2)
+	policy := &RetryPolicy{
+		MaxAttempts: 2,
+		BaseDelay:   time.Millisecond,
+		OnExhausted: func(_ context.Context, e Exhausted) { exhausted <- e },
+	}
+
+	var attempts atomic.Int32
+	schedule := func(task func()) error {
+		go task()
+		return nil
+	}
+	decorated := policy.Decorate(schedule, func() error {
+		attempts.Add(1)
+		return errTask
+	})
+
+	// Each call is a run of its own, with the full number of attempts
+	for run := range 2 {
+		decorated()
+
+		select {
+		case e := <-exhausted:
+			if e.Attempts != 2 || !errors.Is(e.Err, errTask) {
+				t.Fatalf("run %d exhausted after %d attempts with %v, want 2 attempts with errTask", run, e.Attempts, e.Err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("run %d never exhausted", run)
+		}
+	}
+
+	if n := attempts.Load(); n != 4 {
+		t.Fatalf("attempts = %d, want 4", n)
+	}
+}
+
+func TestDecorateExhaustsRejectedRetries(t *testing.T) {
+	exhausted := make(chan Exhausted, 1)
+	policy := &RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Millisecond,
+		OnExhausted: func(_ context.Context, e Exhausted) { exhausted <- e },
+	}
+
+	decorated := policy.Decorate(func(func()) error { return ErrPoolClosed }, func() error { return errTask })
+	decorated()
+
+	select {
+	case e := <-exhausted:
+		if e.Attempts != 1 || !errors.Is(e.Err, errTask) || !errors.Is(e.Err, ErrPoolClosed) {
+			t.Fatalf("exhausted after %d attempts with %v, want 1 attempt with errTask and ErrPoolClosed", e.Attempts, e.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("rejected retry never exhausted")
+	}
+}
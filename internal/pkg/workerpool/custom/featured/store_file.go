@@ -0,0 +1,250 @@
+package workerpool
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// compactThreshold is the number of acknowledged records after which the log is rewritten.
+const compactThreshold = 1024
+
+// walRecord is one line of the write-ahead log.
+type walRecord struct {
+	Op   string      `json:"op"` // "append" or "ack"
+	ID   string      `json:"id"`
+	Task *StoredTask `json:"task,omitempty"`
+}
+
+/**
+ * FileTaskStore is a TaskStore backed by a write-ahead log on the local disk.
+ *
+ * Every Append and Ack writes one JSON line and syncs the file before returning, so an
+ * acknowledged call survives a crash. Pending tasks are kept in memory and rebuilt from
+ * the log on open. A torn last line, left by a crash in the middle of a write, is dropped.
+ *
+ * Once more than compactThreshold acknowledgements have piled up and they outnumber the
+ * pending tasks, the log is rewritten with the pending tasks only.
+ */
+type FileTaskStore struct {
+	mutex   sync.Mutex
+	path    string
+	file    *os.File
+	pending map[string]*StoredTask
+	order   map[string]uint64 // Append order of pending tasks
+	next    uint64            // Next append sequence number
+	acked   int               // Ack records written since the last compaction
+}
+
+// NewFileTaskStore opens, or creates, the log at path and loads the tasks still pending in it.
+func NewFileTaskStore(path string) (*FileTaskStore, error) {
+	store := &FileTaskStore{
+		path:    path,
+		pending: make(map[string]*StoredTask),
+		order:   make(map[string]uint64),
+	}
+
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// load replays the log, truncating it after the last complete record.
+func (s *FileTaskStore) load() error {
+	file, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("open task log: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	var valid int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break // A partial line without newline is a torn write
+		}
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("read task log: %w", err)
+		}
+
+		var record walRecord
+		if json.Unmarshal(line, &record) != nil {
+			break // Everything after a corrupt record is untrustworthy
+		}
+
+		s.apply(record)
+		valid += int64(len(line))
+	}
+
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return fmt.Errorf("truncate task log: %w", err)
+	}
+	if _, err := file.Seek(valid, io.SeekStart); err != nil {
+		file.Close()
+		return fmt.Errorf("seek task log: %w", err)
+	}
+
+	s.file = file
+	return nil
+}
+
+// apply updates the in-memory state with one record.
+func (s *FileTaskStore) apply(record walRecord) {
+	switch record.Op {
+	case "append":
+		if record.Task == nil {
+			return
+		}
+		s.pending[record.Task.ID] = record.Task
+		s.order[record.Task.ID] = s.next
+		s.next++
+	case "ack":
+		delete(s.pending, record.ID)
+		delete(s.order, record.ID)
+		s.acked++
+	}
+}
+
+// Append durably logs a task.
+func (s *FileTaskStore) Append(_ context.Context, task *StoredTask) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record := walRecord{Op: "append", ID: task.ID, Task: task}
+	if err := s.write(record); err != nil {
+		return err
+	}
+
+	s.apply(record)
+	return nil
+}
+
+// Ack durably logs the acknowledgement of a task.
+func (s *FileTaskStore) Ack(_ context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.pending[id]; !ok {
+		return nil
+	}
+
+	record := walRecord{Op: "ack", ID: id}
+	if err := s.write(record); err != nil {
+		return err
+	}
+
+	s.apply(record)
+
+	if s.acked > compactThreshold && s.acked > len(s.pending) {
+		return s.compact()
+	}
+
+	return nil
+}
+
+// Pending returns every unacknowledged task in append order.
+func (s *FileTaskStore) Pending(_ context.Context) ([]*StoredTask, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.sorted(), nil
+}
+
+// Close closes the log file.
+func (s *FileTaskStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// sorted returns the pending tasks in append order.
+// Must be called with the mutex held.
+func (s *FileTaskStore) sorted() []*StoredTask {
+	tasks := make([]*StoredTask, 0, len(s.pending))
+	for _, task := range s.pending {
+		tasks = append(tasks, task)
+	}
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return s.order[tasks[i].ID] < s.order[tasks[j].ID]
+	})
+
+	return tasks
+}
+
+// write appends one record to the log and syncs it to disk.
+// Must be called with the mutex held.
+func (s *FileTaskStore) write(record walRecord) error {
+	if s.file == nil {
+		return os.ErrClosed
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encode task record: %w", err)
+	}
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write task log: %w", err)
+	}
+
+	return s.file.Sync()
+}
+
+// compact rewrites the log with the pending tasks only and atomically replaces the old one.
+// Must be called with the mutex held.
+func (s *FileTaskStore) compact() error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("compact task log: %w", err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	for _, task := range s.sorted() {
+		line, err := json.Marshal(walRecord{Op: "append", ID: task.ID, Task: task})
+		if err == nil {
+			_, err = writer.Write(append(line, '\n'))
+		}
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("compact task log: %w", err)
+		}
+	}
+
+	if err := errors.Join(writer.Flush(), tmp.Sync()); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("compact task log: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("compact task log: %w", err)
+	}
+
+	s.file.Close()
+	s.file = tmp
+	s.acked = 0
+	return nil
+}
@@ -0,0 +1,97 @@
+package workerpool
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+)
+
+// DefaultTaskTable is the table used by NewSQLTaskStore when none is given.
+const DefaultTaskTable = "workerpool_tasks"
+
+// tableName restricts table names to plain identifiers, as they cannot be bound as parameters.
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SQLTaskStore is a TaskStore backed by a MySQL table, e.g. on the *sql.DB from pkg/db.
+// Acknowledged tasks are deleted from the table.
+type SQLTaskStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLTaskStore creates the task table if needed and returns a store using it.
+// The database handle is owned by the caller.
+func NewSQLTaskStore(ctx context.Context, db *sql.DB, table string) (*SQLTaskStore, error) {
+	if table == "" {
+		table = DefaultTaskTable
+	}
+	if !tableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid task table name %q", table)
+	}
+
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		seq         BIGINT       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		id          CHAR(36)     NOT NULL UNIQUE,
+		name        VARCHAR(255) NOT NULL,
+		payload     LONGBLOB,
+		priority    INT          NOT NULL,
+		enqueued_at DATETIME(6)  NOT NULL
+	)`, table))
+	if err != nil {
+		return nil, fmt.Errorf("create task table: %w", err)
+	}
+
+	return &SQLTaskStore{db: db, table: table}, nil
+}
+
+// Append inserts a task.
+func (s *SQLTaskStore) Append(ctx context.Context, task *StoredTask) error {
+	_, err := s.db.ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (id, name, payload, priority, enqueued_at) VALUES (?, ?, ?, ?, ?)", s.table),
+		task.ID, task.Name, task.Payload, int(task.Priority), task.EnqueuedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("store task: %w", err)
+	}
+
+	return nil
+}
+
+// Ack deletes a task.
+func (s *SQLTaskStore) Ack(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = ?", s.table), id)
+	if err != nil {
+		return fmt.Errorf("ack task: %w", err)
+	}
+
+	return nil
+}
+
+// Pending returns every stored task in insertion order.
+func (s *SQLTaskStore) Pending(ctx context.Context) ([]*StoredTask, error) {
+	rows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf("SELECT id, name, payload, priority, enqueued_at FROM %s ORDER BY seq", s.table),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("load pending tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []*StoredTask
+	for rows.Next() {
+		var (
+			task     StoredTask
+			priority int
+		)
+
+		if err := rows.Scan(&task.ID, &task.Name, &task.Payload, &priority, &task.EnqueuedAt); err != nil {
+			return nil, fmt.Errorf("load pending tasks: %w", err)
+		}
+
+		task.Priority = Priority(priority)
+		tasks = append(tasks, &task)
+	}
+
+	return tasks, rows.Err()
+}
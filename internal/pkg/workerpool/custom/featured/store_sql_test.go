@@ -0,0 +1,136 @@
+package workerpool
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTaskDB is an in-memory stand-in for the task table, understanding only the
+// statements issued by SQLTaskStore.
+type fakeTaskDB struct {
+	mutex  sync.Mutex
+	tables map[string]bool
+	rows   [][]driver.Value // id, name, payload, priority, enqueued_at in insertion order
+}
+
+func (db *fakeTaskDB) Open(string) (driver.Conn, error) { return &fakeTaskConn{db: db}, nil }
+
+func (db *fakeTaskDB) Connect(context.Context) (driver.Conn, error) { return db.Open("") }
+func (db *fakeTaskDB) Driver() driver.Driver                        { return db }
+
+type fakeTaskConn struct{ db *fakeTaskDB }
+
+func (c *fakeTaskConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeTaskStmt{db: c.db, query: query}, nil
+}
+func (c *fakeTaskConn) Close() error { return nil }
+func (c *fakeTaskConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+type fakeTaskStmt struct {
+	db    *fakeTaskDB
+	query string
+}
+
+func (s *fakeTaskStmt) Close() error  { return nil }
+func (s *fakeTaskStmt) NumInput() int { return -1 }
+
+func (s *fakeTaskStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+
+	switch fields := strings.Fields(s.query); {
+	case strings.HasPrefix(s.query, "CREATE TABLE IF NOT EXISTS"):
+		s.db.tables[fields[5]] = true
+	case strings.HasPrefix(s.query, "INSERT INTO"):
+		if !s.db.tables[fields[2]] {
+			return nil, errors.New("no such table")
+		}
+		s.db.rows = append(s.db.rows, args)
+	case strings.HasPrefix(s.query, "DELETE FROM"):
+		for i, row := range s.db.rows {
+			if row[0] == args[0] {
+				s.db.rows = append(s.db.rows[:i], s.db.rows[i+1:]...)
+				break
+			}
+		}
+	default:
+		return nil, errors.New("unexpected statement: " + s.query)
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeTaskStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+
+	if !strings.HasPrefix(s.query, "SELECT id, name, payload, priority, enqueued_at FROM") {
+		return nil, errors.New("unexpected query: " + s.query)
+	}
+
+	return &fakeTaskRows{rows: append([][]driver.Value(nil), s.db.rows...)}, nil
+}
+
+type fakeTaskRows struct{ rows [][]driver.Value }
+
+func (r *fakeTaskRows) Columns() []string {
+	return []string{"id", "name", "payload", "priority", "enqueued_at"}
+}
+func (r *fakeTaskRows) Close() error { return nil }
+
+func (r *fakeTaskRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestSQLTaskStore(t *testing.T) {
+	db := sql.OpenDB(&fakeTaskDB{tables: make(map[string]bool)})
+	defer db.Close()
+
+	ctx := context.Background()
+	if _, err := NewSQLTaskStore(ctx, db, "tasks; DROP TABLE users"); err == nil {
+		t.Fatal("NewSQLTaskStore accepted an invalid table name")
+	}
+
+	store, err := NewSQLTaskStore(ctx, db, "")
+	if err != nil {
+		t.Fatalf("NewSQLTaskStore: %v", err)
+	}
+
+	enqueuedAt := time.Now().UTC().Truncate(time.Microsecond)
+	for _, id := range []string{"a", "b", "c"} {
+		task := &StoredTask{ID: id, Name: "task", Payload: []byte(id), Priority: PriorityHigh, EnqueuedAt: enqueuedAt}
+		if err := store.Append(ctx, task); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	if err := store.Ack(ctx, "b"); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+
+	tasks, err := store.Pending(ctx)
+	if err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].ID != "a" || tasks[1].ID != "c" {
+		t.Fatalf("pending = %v, want tasks a and c", pendingIDs(t, store))
+	}
+
+	task := tasks[1]
+	if task.Name != "task" || string(task.Payload) != "c" || task.Priority != PriorityHigh || !task.EnqueuedAt.Equal(enqueuedAt) {
+		t.Fatalf("pending task = %+v, want it stored as appended", task)
+	}
+}
@@ -0,0 +1,37 @@
+package workerpool
+
+import (
+	"pkg/workerpool"
+	"time"
+)
+
+// ContextTask and TimeoutHandler are shared by every pool, see pkg/workerpool.
+type (
+	ContextTask    = workerpool.ContextTask
+	TimeoutHandler = workerpool.TimeoutHandler
+)
+
+// Option configures optional behaviour of the pool.
+type Option func(*Pool)
+
+// WithTimeoutHandler registers a callback for tasks that exceed their budget.
+func WithTimeoutHandler(handler TimeoutHandler) Option {
+	return func(p *Pool) {
+		p.onTimeout = handler
+	}
+}
+
+// WithOverflowPolicy sets what Schedule does when the queue is full and every worker is busy.
+// The default is workerpool.Block.
+func WithOverflowPolicy(policy workerpool.OverflowPolicy) Option {
+	return func(p *Pool) {
+		p.overflow.Policy = policy
+	}
+}
+
+// ScheduleWithDeadline adds a context-aware task to be executed by the worker pool.
+// The task's context is cancelled once budget has elapsed since the task started,
+// or when the pool is closed. A budget <= 0 means the task is only bounded by the pool's lifetime.
+func (p *Pool) ScheduleWithDeadline(budget time.Duration, task ContextTask) error {
+	return p.Schedule(workerpool.BindBudget(p.ctx, budget, p.onTimeout, task))
+}
@@ -0,0 +1,9 @@
+package workerpool
+
+import "pkg/workerpool"
+
+var (
+	ErrPoolClosed      = workerpool.ErrPoolClosed
+	ErrScheduleTimeout = workerpool.ErrScheduleTimeout
+	ErrQueueFull       = workerpool.ErrQueueFull
+)
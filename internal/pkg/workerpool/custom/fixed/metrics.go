@@ -0,0 +1,29 @@
+package workerpool
+
+import (
+	"pkg/workerpool/telemetry"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// WithMetrics exports queue depth, active workers, task latency, panics,
+// rejected submissions and scaling events on meter, labelled with the pool name.
+func WithMetrics(meter metric.Meter, name string) Option {
+	return func(p *Pool) {
+		p.metrics = telemetry.New(meter, name)
+	}
+}
+
+// rejected records a submission turned down with err and returns err.
+func (p *Pool) rejected(err error) error {
+	reason := telemetry.ReasonClosed
+	switch err {
+	case ErrScheduleTimeout:
+		reason = telemetry.ReasonTimeout
+	case ErrQueueFull:
+		reason = telemetry.ReasonQueueFull
+	}
+
+	p.metrics.Rejected(p.ctx, reason)
+	return err
+}
@@ -1,7 +1,11 @@
 package workerpool
 
 import (
-	"errors"
+	"context"
+	"log"
+	"pkg/workerpool"
+	"pkg/workerpool/telemetry"
+	"runtime/debug"
 	"sync"
 	"time"
 )
@@ -13,6 +17,18 @@ type Pool struct {
 	queue      chan task  // Queue for pending tasks
 	semaphore  chan token // Semaphore to control worker count
 	waitGroup  sync.WaitGroup
+	ctx        context.Context    // Context handed to context-aware tasks, cancelled on Close
+	cancel     context.CancelFunc // Cancels ctx
+	onTimeout  TimeoutHandler     // Called when a task exceeds its budget, may be nil
+	admission  sync.RWMutex       // Held by Schedule calls, lets Shutdown wait for them to finish
+	closing    chan token         // Closed when the pool stops admitting tasks
+	drain      chan token         // Closed once no more tasks can be queued, workers exit when the queue is empty
+	abort      chan token         // Closed when the shutdown deadline passes, workers stop picking up tasks
+	closeOnce  sync.Once
+	abortOnce  sync.Once
+	metrics    *telemetry.Metrics // Exported pool metrics, nil when disabled
+
+	overflow workerpool.Overflow // What Schedule does when the queue is full at the worker limit
 }
 
 // Simplified type aliases for better readability
@@ -27,19 +43,41 @@ type (
 //   - maxWorkers: Maximum number of goroutines that can be created
 //   - queueSize: Maximum number of tasks that can wait in the queue
 //   - preAllocWorkers: Number of workers to create in advance (0 for lazy initialization)
+//   - opts: Optional behaviour such as WithTimeoutHandler
 //
 // The pool will create workers on demand up to maxWorkers.
-func NewPool(maxWorkers, queueSize, preAllocWorkers int) *Pool {
+func NewPool(maxWorkers, queueSize, preAllocWorkers int, opts ...Option) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	pool := &Pool{
 		maxWorkers: maxWorkers,
 		queue:      make(chan task, queueSize),
 		semaphore:  make(chan token, maxWorkers),
+		ctx:        ctx,
+		cancel:     cancel,
+		closing:    make(chan token),
+		drain:      make(chan token),
+		abort:      make(chan token),
 	}
 
+	for _, opt := range opts {
+		opt(pool)
+	}
+
+	pool.overflow.Queue = pool.queue
+	pool.overflow.Closing = pool.closing
+	pool.overflow.Running = &pool.waitGroup
+	pool.overflow.RunTask = pool.runTask
+	pool.overflow.Rejected = pool.rejected
+	pool.overflow.Dropped = func() { pool.metrics.Rejected(pool.ctx, telemetry.ReasonDropped) }
+
+	pool.metrics.Observe(pool.QueueDepth, pool.ActiveWorkerCount)
+
 	// Initialize workers upfront if requested
 	if preAllocWorkers > 0 {
 		preAllocWorkers = min(preAllocWorkers, maxWorkers)
 		for i := 0; i < preAllocWorkers; i++ {
+			pool.semaphore <- token{}
 			pool.startWorker()
 		}
 	}
@@ -49,78 +87,252 @@ func NewPool(maxWorkers, queueSize, preAllocWorkers int) *Pool {
 
 // Schedule adds a task to be executed by the worker pool.
 // If the queue is full, it tries to start a new worker.
-// If the worker limit is reached, it blocks until a worker becomes available.
-func (p *Pool) Schedule(task task) {
-	// Try to add task to queue without blocking
+// If the worker limit is reached, the overflow policy decides: by default it blocks until the queue has space.
+// Returns ErrPoolClosed if the pool is shutting down and ErrQueueFull if the Reject policy turns the task down.
+func (p *Pool) Schedule(task task) error {
+	return p.overflow.Complete(task, p.schedule(task))
+}
+
+// schedule queues a task under the admission lock, applying the overflow policy without a timeout.
+func (p *Pool) schedule(task task) error {
+	p.admission.RLock()
+	defer p.admission.RUnlock()
+
+	if p.isClosing() {
+		return p.rejected(ErrPoolClosed)
+	}
+
+	if p.offer(task) {
+		return nil
+	}
+
+	return p.overflow.Apply(task, nil)
+}
+
+// ScheduleTimeout attempts to schedule a task with a timeout.
+// Returns ErrScheduleTimeout if the Block policy couldn't queue the task within the given timeout
+// and ErrPoolClosed if the pool is shutting down. Other policies behave as in Schedule.
+func (p *Pool) ScheduleTimeout(timeout time.Duration, task task) error {
+	return p.overflow.Complete(task, p.scheduleTimeout(timeout, task))
+}
+
+// scheduleTimeout queues a task under the admission lock, giving the Block policy up to timeout.
+func (p *Pool) scheduleTimeout(timeout time.Duration, task task) error {
+	p.admission.RLock()
+	defer p.admission.RUnlock()
+
+	if p.isClosing() {
+		return p.rejected(ErrPoolClosed)
+	}
+
+	if p.offer(task) {
+		return nil
+	}
+
+	return p.overflow.ApplyTimeout(task, timeout)
+}
+
+// offer queues the task if there is room, starting a worker first if the queue is full.
+// It reports whether the task was queued.
+func (p *Pool) offer(task task) bool {
+	// Fast path: try to add task to queue without blocking
 	select {
 	case p.queue <- task:
-		return // Task scheduled successfully
+		return true
 	default:
 		// Queue is full, try to spawn a new worker
 	}
 
-	// Try to acquire worker slot
 	select {
 	case p.semaphore <- token{}:
-		// Worker slot acquired, start a new worker and queue the task
+		// Worker slot acquired, start a new worker
 		p.startWorker()
-		p.queue <- task
 	default:
-		// Worker limit reached, block until queue has space
-		p.queue <- task
+		// Worker limit reached
+		return false
 	}
-}
 
-// ScheduleTimeout attempts to schedule a task with a timeout.
-// Returns ErrScheduleTimeout if the task couldn't be scheduled within the given timeout.
-func (p *Pool) ScheduleTimeout(timeout time.Duration, task task) error {
-	// Fast path: try to enqueue directly
+	// The new worker may already be waiting on an unbuffered queue
 	select {
 	case p.queue <- task:
-		return nil // Task scheduled successfully
+		return true
 	default:
-		// Queue is full, try other approaches
+		return false
+	}
+}
+
+// TrySchedule adds a task only if it can be queued right away, starting a worker if none is free.
+// It never blocks and returns ErrQueueFull if the queue is full
+// and ErrPoolClosed if the pool is shutting down.
+func (p *Pool) TrySchedule(task task) error {
+	p.admission.RLock()
+	defer p.admission.RUnlock()
+
+	if p.isClosing() {
+		return p.rejected(ErrPoolClosed)
 	}
 
-	// Try to start a new worker
+	// Start a worker first, so an unbuffered queue has someone to hand the task to
 	select {
 	case p.semaphore <- token{}:
-		// Worker slot acquired, start a new worker and queue the task
 		p.startWorker()
-		p.queue <- task
+	default:
+	}
+
+	select {
+	case p.queue <- task:
 		return nil
 	default:
-		// Worker limit reached, try to queue with timeout
-		select {
-		case p.queue <- task:
-			return nil
-		case <-time.After(timeout):
-			return errors.New("ErrScheduleTimeout")
-		}
+		return p.rejected(ErrQueueFull)
+	}
+}
+
+// isClosing reports whether the pool has stopped admitting tasks.
+func (p *Pool) isClosing() bool {
+	select {
+	case <-p.closing:
+		return true
+	default:
+		return false
 	}
 }
 
 // startWorker launches a new worker goroutine that processes tasks from the queue.
-// The worker automatically exits when the queue is closed or when there are no more tasks.
+// The caller must have acquired a semaphore slot; it is released when the worker exits.
+// The worker exits once the pool is shutting down and the queue is empty, or when the shutdown is aborted.
 func (p *Pool) startWorker() {
 	p.waitGroup.Add(1)
+	p.metrics.ScaledUp(p.ctx)
 
 	go func() {
 		defer p.waitGroup.Done()
+		defer p.metrics.ScaledDown(p.ctx)
 		defer func() { <-p.semaphore }() // Release worker slot when done
 
-		// Process tasks until queue is closed
-		for task := range p.queue {
-			task()
+		for {
+			// Stop picking up tasks once the shutdown deadline has passed
+			select {
+			case <-p.abort:
+				return
+			default:
+			}
+
+			select {
+			case task := <-p.queue:
+				p.runTask(task)
+			case <-p.drain:
+				select {
+				case task := <-p.queue:
+					p.runTask(task)
+				default:
+					return // Queue drained
+				}
+			case <-p.abort:
+				return
+			}
+		}
+	}()
+}
+
+// QueueDepth returns the current number of tasks in the queue
+func (p *Pool) QueueDepth() int {
+	return len(p.queue)
+}
+
+// ActiveWorkerCount returns the current number of active workers
+func (p *Pool) ActiveWorkerCount() int {
+	return len(p.semaphore)
+}
+
+// Stats returns a snapshot of the pool's workers and queue.
+func (p *Pool) Stats() workerpool.Stats {
+	return workerpool.Stats{
+		ActiveWorkers: p.ActiveWorkerCount(),
+		MaxWorkers:    p.maxWorkers,
+		QueueDepth:    p.QueueDepth(),
+		QueueSize:     cap(p.queue),
+	}
+}
+
+// runTask executes a task, recovering from a panic so the worker survives it.
+// The panic and its stack trace are logged, as there is no caller to return them to.
+func (p *Pool) runTask(task task) {
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("workerpool: task panicked: %v\n%s", r, debug.Stack())
+			p.metrics.TaskPanicked(p.ctx, start)
 		}
 	}()
+
+	task()
+	p.metrics.TaskDone(p.ctx, start, nil)
+}
+
+// Shutdown stops admitting tasks and waits for queued and running tasks to finish.
+// Schedule calls made afterwards, or still blocked on a full queue, return ErrPoolClosed.
+//
+// If ctx is done before the pool has drained, the context of running context-aware tasks
+// is cancelled, queued tasks are discarded and Shutdown returns their number along with ctx.Err().
+func (p *Pool) Shutdown(ctx context.Context) (int, error) {
+	p.closeOnce.Do(func() {
+		close(p.closing)
+
+		// Wait for Schedule calls that passed the closing check, so nothing is queued after this point
+		p.admission.Lock()
+		p.admission.Unlock()
+
+		close(p.drain)
+
+		// Make sure someone drains the queue, even if no worker has been started yet
+		if len(p.queue) > 0 {
+			select {
+			case p.semaphore <- token{}:
+				p.startWorker()
+			default:
+			}
+		}
+	})
+
+	finished := make(chan token)
+	go func() {
+		p.waitGroup.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		p.cancel()
+		p.metrics.Close()
+		return 0, nil
+	case <-ctx.Done():
+		p.cancel()
+		p.abortOnce.Do(func() { close(p.abort) })
+		dropped := p.discardQueued()
+		p.metrics.Close()
+		return dropped, ctx.Err()
+	}
+}
+
+// discardQueued empties the queue without running the tasks and returns how many were dropped.
+func (p *Pool) discardQueued() int {
+	dropped := 0
+	for {
+		select {
+		case <-p.queue:
+			dropped++
+		default:
+			return dropped
+		}
+	}
 }
 
-// Close gracefully shuts down the pool by closing the queue and waiting for all workers to finish.
-// No new tasks should be scheduled after calling Close.
+// Close shuts down the pool and waits for all workers to finish.
+// The context of context-aware tasks is cancelled first, so running and queued ones can bail out early.
+// Tasks scheduled after Close are rejected with ErrPoolClosed.
 func (p *Pool) Close() {
-	close(p.queue)
-	p.waitGroup.Wait()
+	p.cancel()
+	p.Shutdown(context.Background())
 }
 
 // min returns the smaller of two integers
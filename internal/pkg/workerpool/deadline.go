@@ -0,0 +1,49 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ContextTask is a task that observes cancellation through its context.
+// The context is done when the task's budget runs out or when the pool is closed.
+type ContextTask = func(ctx context.Context)
+
+// TimeoutHandler is called when a task is still running after its budget has elapsed.
+// It runs on its own goroutine as soon as the deadline hits, so it also fires for tasks
+// that ignore their context and never return. elapsed is the time since the task started.
+type TimeoutHandler func(budget, elapsed time.Duration)
+
+// WithBudget returns a context cancelled once budget has elapsed, or when parent is done.
+// onTimeout, if not nil, is called as soon as the budget runs out while cancel hasn't been called yet.
+// A budget <= 0 means the context is only bounded by parent.
+func WithBudget(parent context.Context, budget time.Duration, onTimeout TimeoutHandler) (context.Context, context.CancelFunc) {
+	if budget <= 0 {
+		return context.WithCancel(parent)
+	}
+
+	ctx, cancel := context.WithTimeout(parent, budget)
+
+	if onTimeout != nil {
+		start := time.Now()
+		context.AfterFunc(ctx, func() {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				onTimeout(budget, time.Since(start))
+			}
+		})
+	}
+
+	return ctx, cancel
+}
+
+// BindBudget turns a context-aware task into a bare task for pools running func() tasks.
+// The task's context derives from ctx and is bounded by budget from the moment the task starts, as in WithBudget.
+func BindBudget(ctx context.Context, budget time.Duration, onTimeout TimeoutHandler, task ContextTask) func() {
+	return func() {
+		ctx, cancel := WithBudget(ctx, budget, onTimeout)
+		defer cancel()
+
+		task(ctx)
+	}
+}
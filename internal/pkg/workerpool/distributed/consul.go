@@ -0,0 +1,208 @@
+package distributed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// DefaultConsulPrefix is the KV prefix under which ConsulTransport stores tasks.
+const DefaultConsulPrefix = "workerpool/tasks"
+
+/**
+ * ConsulTransport shares tasks through the Consul KV store the services already register with.
+ *
+ * Every task is a JSON document under <prefix>/<id>. Leases, heartbeats and acknowledgements are
+ * check-and-set writes against the key's modify index, so two workers can never both win a lease.
+ * Lease scans the whole prefix, which suits queues of up to a few thousand pending tasks.
+ */
+type ConsulTransport struct {
+	kv     *api.KV
+	prefix string
+}
+
+// NewConsulTransport creates a transport storing tasks under prefix (DefaultConsulPrefix if empty).
+// A nil client connects to the local agent with api.DefaultConfig, like pkg/discovery.
+func NewConsulTransport(client *api.Client, prefix string) (*ConsulTransport, error) {
+	if client == nil {
+		var err error
+		if client, err = api.NewClient(api.DefaultConfig()); err != nil {
+			return nil, fmt.Errorf("failed to create consul client: %w", err)
+		}
+	}
+
+	if prefix == "" {
+		prefix = DefaultConsulPrefix
+	}
+
+	return &ConsulTransport{kv: client.KV(), prefix: prefix}, nil
+}
+
+// Enqueue writes the task, failing if a task with the same ID already exists.
+func (c *ConsulTransport) Enqueue(ctx context.Context, task *Task) error {
+	pair, err := c.pair(task, 0)
+	if err != nil {
+		return err
+	}
+
+	ok, _, err := c.kv.CAS(pair, c.write(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to enqueue task %s: %w", task.ID, err)
+	}
+	if !ok {
+		return fmt.Errorf("failed to enqueue task %s: already exists", task.ID)
+	}
+
+	return nil
+}
+
+// Lease claims the oldest available task. Tasks claimed concurrently by another worker are skipped.
+func (c *ConsulTransport) Lease(ctx context.Context, worker string, ttl time.Duration) (*Task, error) {
+	pairs, _, err := c.kv.List(c.prefix+"/", c.query(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+
+	// Keys are returned in lexical order, which is enqueue order
+	for _, pair := range pairs {
+		var task Task
+		if err := json.Unmarshal(pair.Value, &task); err != nil {
+			continue
+		}
+
+		now := time.Now()
+		if !task.available(now) {
+			continue
+		}
+
+		task.Worker = worker
+		task.LeaseUntil = now.Add(ttl)
+		task.Attempts++
+
+		won, err := c.update(ctx, &task, pair.ModifyIndex)
+		if err != nil {
+			return nil, err
+		}
+		if won {
+			return &task, nil
+		}
+	}
+
+	return nil, ErrNoTask
+}
+
+// Heartbeat extends the lease of worker on the task.
+func (c *ConsulTransport) Heartbeat(ctx context.Context, id, worker string, ttl time.Duration) error {
+	task, index, err := c.leased(ctx, id, worker)
+	if err != nil {
+		return err
+	}
+
+	task.LeaseUntil = time.Now().Add(ttl)
+	return c.mustUpdate(ctx, task, index)
+}
+
+// Ack deletes a completed task.
+func (c *ConsulTransport) Ack(ctx context.Context, id, worker string) error {
+	_, index, err := c.leased(ctx, id, worker)
+	if err != nil {
+		return err
+	}
+
+	ok, _, err := c.kv.DeleteCAS(&api.KVPair{Key: c.key(id), ModifyIndex: index}, c.write(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to ack task %s: %w", id, err)
+	}
+	if !ok {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+// Nack releases a failed task until retryAt.
+func (c *ConsulTransport) Nack(ctx context.Context, id, worker string, retryAt time.Time, cause error) error {
+	task, index, err := c.leased(ctx, id, worker)
+	if err != nil {
+		return err
+	}
+
+	release(task, retryAt, cause)
+	return c.mustUpdate(ctx, task, index)
+}
+
+// leased reads a task and checks that worker still holds its lease.
+func (c *ConsulTransport) leased(ctx context.Context, id, worker string) (*Task, uint64, error) {
+	pair, _, err := c.kv.Get(c.key(id), c.query(ctx))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read task %s: %w", id, err)
+	}
+	if pair == nil {
+		return nil, 0, ErrLeaseLost
+	}
+
+	var task Task
+	if err := json.Unmarshal(pair.Value, &task); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode task %s: %w", id, err)
+	}
+	if !task.heldBy(worker, time.Now()) {
+		return nil, 0, ErrLeaseLost
+	}
+
+	return &task, pair.ModifyIndex, nil
+}
+
+// update writes the task if its key is still at index, reporting whether the write won.
+func (c *ConsulTransport) update(ctx context.Context, task *Task, index uint64) (bool, error) {
+	pair, err := c.pair(task, index)
+	if err != nil {
+		return false, err
+	}
+
+	ok, _, err := c.kv.CAS(pair, c.write(ctx))
+	if err != nil {
+		return false, fmt.Errorf("failed to update task %s: %w", task.ID, err)
+	}
+
+	return ok, nil
+}
+
+// mustUpdate is update for a task leased by the caller: losing the write means losing the lease.
+func (c *ConsulTransport) mustUpdate(ctx context.Context, task *Task, index uint64) error {
+	ok, err := c.update(ctx, task, index)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+func (c *ConsulTransport) pair(task *Task, index uint64) (*api.KVPair, error) {
+	value, err := json.Marshal(task)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode task %s: %w", task.ID, err)
+	}
+
+	return &api.KVPair{Key: c.key(task.ID), Value: value, ModifyIndex: index}, nil
+}
+
+func (c *ConsulTransport) key(id string) string {
+	return path.Join(c.prefix, id)
+}
+
+func (c *ConsulTransport) query(ctx context.Context) *api.QueryOptions {
+	return (&api.QueryOptions{RequireConsistent: true}).WithContext(ctx)
+}
+
+func (c *ConsulTransport) write(ctx context.Context) *api.WriteOptions {
+	return (&api.WriteOptions{}).WithContext(ctx)
+}
+
+var _ Transport = (*ConsulTransport)(nil)
@@ -0,0 +1,23 @@
+package distributed
+
+import (
+	"errors"
+	"fmt"
+	"pkg/workerpool"
+)
+
+var (
+	ErrNoTask          = errors.New("no task available")
+	ErrLeaseLost       = errors.New("lease lost")
+	ErrHandlerNotFound = errors.New("handler not found")
+	ErrPoolClosed      = workerpool.ErrPoolClosed
+)
+
+// PanicError is the failure recorded for a task whose handler panicked.
+type PanicError struct {
+	Value any
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task handler panicked: %v", e.Value)
+}
@@ -0,0 +1,122 @@
+package distributed
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Loopback is an in-process transport, for tests and for running a single instance
+// without a shared store. Workers of the same process share tasks exactly like remote ones.
+type Loopback struct {
+	mutex sync.Mutex
+	tasks map[string]*Task
+}
+
+// NewLoopback creates an empty in-process transport.
+func NewLoopback() *Loopback {
+	return &Loopback{tasks: make(map[string]*Task)}
+}
+
+// Enqueue stores a copy of the task.
+func (l *Loopback) Enqueue(_ context.Context, task *Task) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	stored := *task
+	l.tasks[task.ID] = &stored
+	return nil
+}
+
+// Lease hands out the oldest available task.
+func (l *Loopback) Lease(_ context.Context, worker string, ttl time.Duration) (*Task, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+
+	var oldest *Task
+	for _, task := range l.tasks {
+		if task.available(now) && (oldest == nil || task.ID < oldest.ID) {
+			oldest = task
+		}
+	}
+	if oldest == nil {
+		return nil, ErrNoTask
+	}
+
+	oldest.Worker = worker
+	oldest.LeaseUntil = now.Add(ttl)
+	oldest.Attempts++
+
+	leased := *oldest
+	return &leased, nil
+}
+
+// Heartbeat extends the lease of worker on the task.
+func (l *Loopback) Heartbeat(_ context.Context, id, worker string, ttl time.Duration) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	task, err := l.leased(id, worker)
+	if err != nil {
+		return err
+	}
+
+	task.LeaseUntil = time.Now().Add(ttl)
+	return nil
+}
+
+// Ack removes a completed task.
+func (l *Loopback) Ack(_ context.Context, id, worker string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, err := l.leased(id, worker); err != nil {
+		return err
+	}
+
+	delete(l.tasks, id)
+	return nil
+}
+
+// Nack releases a failed task until retryAt.
+func (l *Loopback) Nack(_ context.Context, id, worker string, retryAt time.Time, cause error) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	task, err := l.leased(id, worker)
+	if err != nil {
+		return err
+	}
+
+	release(task, retryAt, cause)
+	return nil
+}
+
+// Tasks returns a snapshot of every stored task, oldest first.
+func (l *Loopback) Tasks() []Task {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	tasks := make([]Task, 0, len(l.tasks))
+	for _, task := range l.tasks {
+		tasks = append(tasks, *task)
+	}
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks
+}
+
+// leased returns the task if it is still leased to worker. Must be called with the mutex held.
+func (l *Loopback) leased(id, worker string) (*Task, error) {
+	task, ok := l.tasks[id]
+	if !ok || !task.heldBy(worker, time.Now()) {
+		return nil, ErrLeaseLost
+	}
+
+	return task, nil
+}
+
+var _ Transport = (*Loopback)(nil)
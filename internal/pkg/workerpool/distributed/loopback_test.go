@@ -0,0 +1,101 @@
+package distributed
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func enqueueAt(t *testing.T, l *Loopback, name string, at time.Time) *Task {
+	t.Helper()
+
+	task := &Task{ID: newTaskID(at), Name: name, EnqueuedAt: at}
+	if err := l.Enqueue(context.Background(), task); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	return task
+}
+
+func TestLoopbackLeasesOldestFirst(t *testing.T) {
+	l := NewLoopback()
+	ctx := context.Background()
+	now := time.Now()
+
+	enqueueAt(t, l, "second", now)
+	enqueueAt(t, l, "first", now.Add(-time.Minute))
+
+	for _, want := range []string{"first", "second"} {
+		task, err := l.Lease(ctx, "w1", time.Minute)
+		if err != nil {
+			t.Fatalf("Lease: %v", err)
+		}
+		if task.Name != want || task.Worker != "w1" || task.Attempts != 1 {
+			t.Fatalf("leased %+v, want %s held by w1 on its first attempt", task, want)
+		}
+	}
+
+	if _, err := l.Lease(ctx, "w2", time.Minute); !errors.Is(err, ErrNoTask) {
+		t.Fatalf("Lease with every task held: err = %v, want ErrNoTask", err)
+	}
+}
+
+func TestLoopbackLeaseOwnership(t *testing.T) {
+	l := NewLoopback()
+	ctx := context.Background()
+	enqueueAt(t, l, "task", time.Now())
+
+	task, _ := l.Lease(ctx, "w1", 20*time.Millisecond)
+
+	if err := l.Heartbeat(ctx, task.ID, "w2", time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Heartbeat by another worker: err = %v, want ErrLeaseLost", err)
+	}
+	if err := l.Ack(ctx, task.ID, "w2"); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Ack by another worker: err = %v, want ErrLeaseLost", err)
+	}
+
+	// Once expired, the lease goes to the next worker asking
+	time.Sleep(30 * time.Millisecond)
+	if err := l.Heartbeat(ctx, task.ID, "w1", time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Heartbeat on an expired lease: err = %v, want ErrLeaseLost", err)
+	}
+
+	taken, err := l.Lease(ctx, "w2", time.Minute)
+	if err != nil || taken.ID != task.ID || taken.Attempts != 2 {
+		t.Fatalf("Lease after expiry = %+v, %v, want the task on its second attempt", taken, err)
+	}
+	if err := l.Ack(ctx, task.ID, "w1"); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Ack by the previous holder: err = %v, want ErrLeaseLost", err)
+	}
+	if err := l.Ack(ctx, task.ID, "w2"); err != nil {
+		t.Errorf("Ack: %v", err)
+	}
+	if tasks := l.Tasks(); len(tasks) != 0 {
+		t.Errorf("%d tasks left after Ack", len(tasks))
+	}
+}
+
+func TestLoopbackNackDelaysRetry(t *testing.T) {
+	l := NewLoopback()
+	ctx := context.Background()
+	enqueueAt(t, l, "task", time.Now())
+
+	task, _ := l.Lease(ctx, "w1", time.Minute)
+	retryAt := time.Now().Add(30 * time.Millisecond)
+	if err := l.Nack(ctx, task.ID, "w1", retryAt, errors.New("db down")); err != nil {
+		t.Fatalf("Nack: %v", err)
+	}
+
+	stored := l.Tasks()[0]
+	if stored.Worker != "" || stored.LastError != "db down" || !stored.NotBefore.Equal(retryAt) {
+		t.Errorf("released task = %+v, want no worker, the error and the retry time", stored)
+	}
+
+	if _, err := l.Lease(ctx, "w2", time.Minute); !errors.Is(err, ErrNoTask) {
+		t.Fatalf("Lease before retryAt: err = %v, want ErrNoTask", err)
+	}
+	time.Sleep(time.Until(retryAt))
+	if _, err := l.Lease(ctx, "w2", time.Minute); err != nil {
+		t.Fatalf("Lease after retryAt: %v", err)
+	}
+}
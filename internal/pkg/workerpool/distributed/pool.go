@@ -0,0 +1,373 @@
+package distributed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Handler runs a task. The context is cancelled if the task's lease is lost or the pool
+// is shut down before the task finishes; the task will then be delivered again.
+type Handler func(ctx context.Context, task *Task) error
+
+// DeadLetterHandler receives tasks that failed on every attempt, along with the last error.
+type DeadLetterHandler func(ctx context.Context, task *Task, err error)
+
+// Config holds configuration for the distributed pool. Zero values are replaced with the
+// defaults noted on each field.
+type Config struct {
+	Workers      int           `mapstructure:"workers"`      // Tasks run concurrently by this instance (default 4)
+	LeaseTTL     time.Duration `mapstructure:"leaseTTL"`     // How long a task stays leased without a heartbeat (default 30s)
+	PollInterval time.Duration `mapstructure:"pollInterval"` // Wait between leases while the queue is empty (default 1s)
+	MaxAttempts  int           `mapstructure:"maxAttempts"`  // Attempts before a task is dead-lettered (default 5)
+	RetryDelay   time.Duration `mapstructure:"retryDelay"`   // Delay before the first retry, doubled on every further one (default 5s)
+	WorkerID     string        `mapstructure:"workerID"`     // Identifies this instance's leases (default hostname and a random suffix)
+}
+
+// withDefaults returns a copy of the configuration with zero fields set to their default values.
+func (c *Config) withDefaults() *Config {
+	conf := *c
+	c = &conf
+
+	if c.Workers <= 0 {
+		c.Workers = 4
+	}
+	if c.LeaseTTL <= 0 {
+		c.LeaseTTL = 30 * time.Second
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 5
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = 5 * time.Second
+	}
+	if c.WorkerID == "" {
+		host, _ := os.Hostname()
+		c.WorkerID = fmt.Sprintf("%s-%s", host, uuid.NewString()[:8])
+	}
+
+	return c
+}
+
+// backoff returns the delay before retrying a task that failed its nth attempt.
+func (c *Config) backoff(attempt int) time.Duration {
+	return c.RetryDelay << min(attempt-1, 10)
+}
+
+// Option configures optional behaviour of the pool.
+type Option func(*Pool)
+
+// WithDeadLetterHandler replaces the default dead letter handler, which logs the task.
+func WithDeadLetterHandler(handler DeadLetterHandler) Option {
+	return func(p *Pool) {
+		p.onDeadLetter = handler
+	}
+}
+
+type token = struct{}
+
+/**
+ * Pool runs tasks enqueued by any instance of a service on whichever instance has a free worker.
+ *
+ * Each of the pool's workers leases one task at a time from the shared transport, so busy instances
+ * stop pulling and idle ones pick the work up. While a task runs its lease is renewed every third of
+ * the lease TTL; if the instance dies, the lease expires and another instance takes the task over.
+ *
+ * 	pool := distributed.NewPool(transport, &distributed.Config{Workers: 8})
+ * 	pool.Handle("reindex-product", func(ctx context.Context, task *distributed.Task) error {
+ * 		return reindex(ctx, string(task.Payload))
+ * 	})
+ * 	pool.Start(ctx)
+ *
+ * 	pool.Enqueue(ctx, "reindex-product", []byte(productID))
+ *
+ * Delivery is at least once: a task is only removed after its handler succeeds, so handlers must be idempotent.
+ * A task that fails is retried with exponential backoff until MaxAttempts, then handed to the dead letter handler.
+ */
+type Pool struct {
+	transport    Transport
+	conf         *Config
+	onDeadLetter DeadLetterHandler
+
+	handlersMutex sync.RWMutex
+	handlers      map[string]Handler
+
+	wake      chan token         // Wakes an idle worker when a task is enqueued locally
+	stop      chan token         // Closed to stop leasing
+	running   sync.WaitGroup     // Workers that haven't returned yet
+	ctx       context.Context    // Context handed to handlers
+	cancel    context.CancelFunc // Cancels ctx
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewPool creates a pool sharing tasks through transport. Call Start to begin running tasks.
+func NewPool(transport Transport, conf *Config, opts ...Option) *Pool {
+	pool := &Pool{
+		transport: transport,
+		conf:      conf.withDefaults(),
+		handlers:  make(map[string]Handler),
+		wake:      make(chan token, 1),
+		stop:      make(chan token),
+		onDeadLetter: func(_ context.Context, task *Task, err error) {
+			log.Printf("workerpool: task %s (%s) failed after %d attempts: %v", task.ID, task.Name, task.Attempts, err)
+		},
+	}
+
+	for _, opt := range opts {
+		opt(pool)
+	}
+
+	return pool
+}
+
+// Handle registers the handler run for tasks enqueued under name, replacing any previous one.
+// Every instance leasing tasks must register the handlers of the tasks it may receive.
+func (p *Pool) Handle(name string, handler Handler) {
+	p.handlersMutex.Lock()
+	defer p.handlersMutex.Unlock()
+
+	p.handlers[name] = handler
+}
+
+// handler returns the handler registered under name, nil if there is none.
+func (p *Pool) handler(name string) Handler {
+	p.handlersMutex.RLock()
+	defer p.handlersMutex.RUnlock()
+
+	return p.handlers[name]
+}
+
+// Enqueue adds a task for the handler registered under name and returns its ID.
+// It can be called before Start, e.g. from an instance that only produces tasks.
+func (p *Pool) Enqueue(ctx context.Context, name string, payload []byte) (string, error) {
+	select {
+	case <-p.stop:
+		return "", ErrPoolClosed
+	default:
+	}
+
+	now := time.Now()
+	task := &Task{
+		ID:         newTaskID(now),
+		Name:       name,
+		Payload:    payload,
+		EnqueuedAt: now,
+	}
+
+	if err := p.transport.Enqueue(ctx, task); err != nil {
+		return "", err
+	}
+
+	select {
+	case p.wake <- token{}:
+	default:
+	}
+
+	return task.ID, nil
+}
+
+// WorkerID returns the identifier of this instance's leases.
+func (p *Pool) WorkerID() string {
+	return p.conf.WorkerID
+}
+
+// Start launches the workers. Handlers receive a context derived from ctx.
+func (p *Pool) Start(ctx context.Context) {
+	p.startOnce.Do(func() {
+		p.ctx, p.cancel = context.WithCancel(ctx)
+
+		for i := 0; i < p.conf.Workers; i++ {
+			p.running.Add(1)
+			go p.work()
+		}
+	})
+}
+
+// Shutdown stops leasing tasks and waits for running ones to finish.
+// If ctx is done first, the handlers' context is cancelled so their tasks are released for
+// another instance, and ctx.Err() is returned right away: handlers still running, including ones
+// ignoring the cancellation, release their task in the background once they return.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+
+	// Keep a later Start from running, then find out whether the workers ever ran
+	p.startOnce.Do(func() {})
+	if p.cancel == nil {
+		return nil
+	}
+
+	finished := make(chan token)
+	go func() {
+		p.running.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return ctx.Err()
+	}
+}
+
+// work leases and runs tasks until the pool is shut down.
+func (p *Pool) work() {
+	defer p.running.Done()
+
+	idle := time.NewTimer(p.conf.PollInterval)
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+
+		task, err := p.transport.Lease(p.ctx, p.conf.WorkerID, p.conf.LeaseTTL)
+		if err == nil {
+			p.process(task)
+			continue
+		}
+
+		if !errors.Is(err, ErrNoTask) && p.ctx.Err() == nil {
+			log.Printf("workerpool: failed to lease task: %v", err)
+		}
+
+		idle.Reset(p.conf.PollInterval)
+		select {
+		case <-idle.C:
+		case <-p.wake:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// process runs a leased task while renewing its lease, then acknowledges, retries or dead-letters it.
+func (p *Pool) process(task *Task) {
+	// Settle the task even when the handlers' context was cancelled by Shutdown
+	settleCtx := context.WithoutCancel(p.ctx)
+
+	if task.Attempts > p.conf.MaxAttempts {
+		// Previous holders died while running it
+		cause := errors.New("lease expired")
+		if task.LastError != "" {
+			cause = errors.New(task.LastError)
+		}
+		p.deadLetter(settleCtx, task, cause)
+		return
+	}
+
+	handler := p.handler(task.Name)
+	if handler == nil {
+		// Another instance, e.g. running a newer version, may be able to handle it
+		p.settle(settleCtx, task, fmt.Errorf("%w: %s", ErrHandlerNotFound, task.Name))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(p.ctx)
+	defer cancel()
+
+	lost := make(chan token)
+	heartbeatDone := make(chan token)
+	go func() {
+		defer close(heartbeatDone)
+		p.heartbeat(ctx, cancel, task, lost)
+	}()
+
+	err := run(ctx, handler, task)
+
+	cancel()
+	<-heartbeatDone
+
+	select {
+	case <-lost:
+		// Another worker owns the task now, and will run it again
+		return
+	default:
+	}
+
+	p.settle(settleCtx, task, err)
+}
+
+// settle records the outcome of an attempt: an error is retried until the attempts run out.
+func (p *Pool) settle(ctx context.Context, task *Task, err error) {
+	if err == nil {
+		if ackErr := p.transport.Ack(ctx, task.ID, p.conf.WorkerID); ackErr != nil {
+			log.Printf("workerpool: failed to ack task %s (%s): %v", task.ID, task.Name, ackErr)
+		}
+		return
+	}
+
+	if task.Attempts >= p.conf.MaxAttempts {
+		p.deadLetter(ctx, task, err)
+		return
+	}
+
+	retryAt := time.Now().Add(p.conf.backoff(task.Attempts))
+	if nackErr := p.transport.Nack(ctx, task.ID, p.conf.WorkerID, retryAt, err); nackErr != nil {
+		// The lease will expire and the task will be retried anyway
+		log.Printf("workerpool: failed to release task %s (%s): %v", task.ID, task.Name, nackErr)
+	}
+}
+
+// deadLetter hands the task to the dead letter handler and removes it from the queue.
+func (p *Pool) deadLetter(ctx context.Context, task *Task, err error) {
+	p.onDeadLetter(ctx, task, err)
+
+	if ackErr := p.transport.Ack(ctx, task.ID, p.conf.WorkerID); ackErr != nil {
+		log.Printf("workerpool: failed to remove dead task %s (%s): %v", task.ID, task.Name, ackErr)
+	}
+}
+
+// heartbeat renews the task's lease until ctx is done.
+// If the lease is lost, it closes lost and cancels the handler.
+func (p *Pool) heartbeat(ctx context.Context, cancel context.CancelFunc, task *Task, lost chan token) {
+	ticker := time.NewTicker(p.conf.LeaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := p.transport.Heartbeat(ctx, task.ID, p.conf.WorkerID, p.conf.LeaseTTL)
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrLeaseLost):
+			log.Printf("workerpool: lease on task %s (%s) lost", task.ID, task.Name)
+			close(lost)
+			cancel()
+			return
+		case ctx.Err() == nil:
+			// Transient, the next heartbeat may still renew the lease in time
+			log.Printf("workerpool: failed to renew lease on task %s (%s): %v", task.ID, task.Name, err)
+		}
+	}
+}
+
+// run calls the handler, turning a panic into a *PanicError.
+func run(ctx context.Context, handler Handler, task *Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r}
+		}
+	}()
+
+	return handler(ctx, task)
+}
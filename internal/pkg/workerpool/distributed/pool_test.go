@@ -0,0 +1,450 @@
+package distributed
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testConfig keeps the delays of the pool short enough for tests.
+func testConfig(workerID string) *Config {
+	return &Config{
+		Workers:      2,
+		LeaseTTL:     time.Second,
+		PollInterval: 10 * time.Millisecond,
+		MaxAttempts:  3,
+		RetryDelay:   10 * time.Millisecond,
+		WorkerID:     workerID,
+	}
+}
+
+// startPool starts a pool on transport and shuts it down at the end of the test.
+func startPool(t *testing.T, transport Transport, conf *Config, opts ...Option) *Pool {
+	t.Helper()
+
+	pool := NewPool(transport, conf, opts...)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		pool.Shutdown(ctx)
+	})
+	return pool
+}
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// deadLetters collects the tasks handed to the dead letter handler.
+type deadLetters struct {
+	mutex sync.Mutex
+	tasks []*Task
+	errs  []error
+}
+
+func (d *deadLetters) handle(_ context.Context, task *Task, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.tasks = append(d.tasks, task)
+	d.errs = append(d.errs, err)
+}
+
+func (d *deadLetters) len() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return len(d.tasks)
+}
+
+func TestInstancesShareTasks(t *testing.T) {
+	transport := NewLoopback()
+	ctx := context.Background()
+
+	const tasks = 20
+	var mutex sync.Mutex
+	runs := make(map[string]int)    // Runs of each task
+	workers := make(map[string]int) // Tasks run by each instance
+
+	handler := func(workerID string) Handler {
+		return func(_ context.Context, task *Task) error {
+			time.Sleep(5 * time.Millisecond)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			runs[string(task.Payload)]++
+			workers[workerID]++
+			return nil
+		}
+	}
+
+	var pools []*Pool
+	for _, id := range []string{"a", "b"} {
+		pool := startPool(t, transport, testConfig(id))
+		pool.Handle("reindex", handler(id))
+		pools = append(pools, pool)
+	}
+
+	// Producing from one instance only
+	for i := range tasks {
+		if _, err := pools[0].Enqueue(ctx, "reindex", []byte{byte(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	for _, pool := range pools {
+		pool.Start(ctx)
+	}
+
+	waitFor(t, "the queue to drain", func() bool { return len(transport.Tasks()) == 0 })
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(runs) != tasks {
+		t.Errorf("%d tasks ran, want %d", len(runs), tasks)
+	}
+	for payload, n := range runs {
+		if n != 1 {
+			t.Errorf("task %v ran %d times, want once", []byte(payload), n)
+		}
+	}
+	if workers["a"] == 0 || workers["b"] == 0 {
+		t.Errorf("tasks per instance = %v, want both instances to take some", workers)
+	}
+}
+
+func TestFailedTaskIsRetried(t *testing.T) {
+	transport := NewLoopback()
+	dead := &deadLetters{}
+	pool := startPool(t, transport, testConfig("a"), WithDeadLetterHandler(dead.handle))
+
+	var attempts atomic.Int32
+	done := make(chan *Task, 1)
+	pool.Handle("flaky", func(_ context.Context, task *Task) error {
+		if attempts.Add(1) < 3 {
+			return errors.New("db down")
+		}
+		done <- task
+		return nil
+	})
+
+	start := time.Now()
+	pool.Enqueue(context.Background(), "flaky", nil)
+	pool.Start(context.Background())
+
+	select {
+	case task := <-done:
+		if task.Attempts != 3 || task.LastError != "db down" {
+			t.Errorf("last attempt = %+v, want attempt 3 after db down", task)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task not retried until it succeeded")
+	}
+
+	// 10ms then 20ms of backoff
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("3 attempts took %s, want at least the 30ms of backoff", elapsed)
+	}
+
+	waitFor(t, "the ack", func() bool { return len(transport.Tasks()) == 0 })
+	if dead.len() != 0 {
+		t.Errorf("%d dead letters for a task that succeeded", dead.len())
+	}
+}
+
+func TestExhaustedTaskIsDeadLettered(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler Handler
+		want    func(err error) bool
+	}{
+		{"error", func(context.Context, *Task) error { return errors.New("invalid payload") },
+			func(err error) bool { return err.Error() == "invalid payload" }},
+		{"panic", func(context.Context, *Task) error { panic("nil map") },
+			func(err error) bool { var p *PanicError; return errors.As(err, &p) && p.Value == "nil map" }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := NewLoopback()
+			dead := &deadLetters{}
+			pool := startPool(t, transport, testConfig("a"), WithDeadLetterHandler(dead.handle))
+
+			var attempts atomic.Int32
+			pool.Handle("broken", func(ctx context.Context, task *Task) error {
+				attempts.Add(1)
+				return test.handler(ctx, task)
+			})
+
+			pool.Enqueue(context.Background(), "broken", []byte("payload"))
+			pool.Start(context.Background())
+
+			waitFor(t, "the dead letter", func() bool { return dead.len() == 1 })
+			waitFor(t, "the task to be removed", func() bool { return len(transport.Tasks()) == 0 })
+
+			dead.mutex.Lock()
+			defer dead.mutex.Unlock()
+
+			if task := dead.tasks[0]; task.Attempts != 3 || string(task.Payload) != "payload" {
+				t.Errorf("dead letter = %+v, want the task after 3 attempts", task)
+			}
+			if !test.want(dead.errs[0]) {
+				t.Errorf("dead letter error = %v", dead.errs[0])
+			}
+			if n := attempts.Load(); n != 3 {
+				t.Errorf("handler ran %d times, want 3", n)
+			}
+		})
+	}
+}
+
+func TestExpiredLeaseIsTakenOver(t *testing.T) {
+	transport := NewLoopback()
+	ctx := context.Background()
+
+	producer := NewPool(transport, testConfig("producer"))
+	id, _ := producer.Enqueue(ctx, "reindex", nil)
+
+	// An instance leases the task and dies
+	if _, err := transport.Lease(ctx, "dead", 50*time.Millisecond); err != nil {
+		t.Fatalf("Lease: %v", err)
+	}
+
+	done := make(chan *Task, 1)
+	pool := startPool(t, transport, testConfig("a"))
+	pool.Handle("reindex", func(_ context.Context, task *Task) error {
+		done <- task
+		return nil
+	})
+	pool.Start(ctx)
+
+	select {
+	case task := <-done:
+		if task.ID != id || task.Attempts != 2 || task.Worker != "a" {
+			t.Errorf("taken over task = %+v, want %s on attempt 2 held by a", task, id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task not taken over once its lease expired")
+	}
+}
+
+func TestTaskOfDeadWorkersIsDeadLettered(t *testing.T) {
+	transport := NewLoopback()
+	ctx := context.Background()
+	conf := testConfig("a")
+
+	task := enqueueAt(t, transport, "reindex", time.Now())
+	// Every holder died while running it
+	for range conf.MaxAttempts {
+		transport.Lease(ctx, "dead", time.Nanosecond)
+		time.Sleep(time.Millisecond)
+	}
+
+	dead := &deadLetters{}
+	pool := startPool(t, transport, conf, WithDeadLetterHandler(dead.handle))
+	pool.Handle("reindex", func(context.Context, *Task) error {
+		t.Error("task run after its attempts ran out")
+		return nil
+	})
+	pool.Start(ctx)
+
+	waitFor(t, "the dead letter", func() bool { return dead.len() == 1 })
+	if got := dead.tasks[0]; got.ID != task.ID || got.Attempts != conf.MaxAttempts+1 {
+		t.Errorf("dead letter = %+v, want %s on attempt %d", got, task.ID, conf.MaxAttempts+1)
+	}
+}
+
+func TestHeartbeatKeepsLease(t *testing.T) {
+	transport := NewLoopback()
+	ctx := context.Background()
+	conf := testConfig("a")
+	conf.LeaseTTL = 30 * time.Millisecond
+
+	var runs atomic.Int32
+	pool := startPool(t, transport, conf)
+	pool.Handle("long", func(context.Context, *Task) error {
+		runs.Add(1)
+		time.Sleep(150 * time.Millisecond)
+		return nil
+	})
+	pool.Enqueue(ctx, "long", nil)
+	pool.Start(ctx)
+
+	waitFor(t, "the task to start", func() bool { return runs.Load() == 1 })
+
+	// Well past the TTL the task is still held, nobody else gets it
+	deadline := time.Now().Add(100 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		if task, err := transport.Lease(ctx, "b", time.Minute); err == nil {
+			t.Fatalf("task %s leased by b while a was running it", task.ID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	waitFor(t, "the ack", func() bool { return len(transport.Tasks()) == 0 })
+	if n := runs.Load(); n != 1 {
+		t.Errorf("task ran %d times, want once", n)
+	}
+}
+
+func TestLostLeaseCancelsHandler(t *testing.T) {
+	transport := NewLoopback()
+	ctx := context.Background()
+	conf := testConfig("a")
+	conf.LeaseTTL = 30 * time.Millisecond
+
+	started, cancelled := make(chan *Task, 1), make(chan token)
+	pool := startPool(t, transport, conf)
+	pool.Handle("long", func(ctx context.Context, task *Task) error {
+		started <- task
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	pool.Enqueue(ctx, "long", nil)
+	pool.Start(ctx)
+
+	task := <-started
+
+	// Another instance takes the task over, e.g. after a network partition
+	transport.mutex.Lock()
+	transport.tasks[task.ID].Worker = "b"
+	transport.tasks[task.ID].LeaseUntil = time.Now().Add(time.Minute)
+	transport.mutex.Unlock()
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("handler not cancelled after losing its lease")
+	}
+
+	// The pool leaves the task to its new holder
+	time.Sleep(20 * time.Millisecond)
+	if stored := transport.Tasks()[0]; stored.Worker != "b" || stored.LastError != "" {
+		t.Errorf("task = %+v, want it untouched and held by b", stored)
+	}
+}
+
+func TestTaskWithoutHandlerIsReleased(t *testing.T) {
+	transport := NewLoopback()
+	ctx := context.Background()
+	conf := testConfig("a")
+	conf.RetryDelay = time.Minute
+
+	pool := startPool(t, transport, conf)
+	pool.Enqueue(ctx, "unknown", nil)
+	pool.Start(ctx)
+
+	waitFor(t, "the task to be released", func() bool {
+		tasks := transport.Tasks()
+		return len(tasks) == 1 && tasks[0].Attempts == 1 && tasks[0].Worker == ""
+	})
+
+	if task := transport.Tasks()[0]; !strings.Contains(task.LastError, ErrHandlerNotFound.Error()) {
+		t.Errorf("last error = %q, want %v", task.LastError, ErrHandlerNotFound)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	transport := NewLoopback()
+	ctx := context.Background()
+	conf := testConfig("a")
+	conf.RetryDelay = time.Minute
+
+	started := make(chan token)
+	pool := NewPool(transport, conf)
+	pool.Handle("stuck", func(ctx context.Context, _ *Task) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	pool.Enqueue(ctx, "stuck", nil)
+	pool.Start(ctx)
+	<-started
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := pool.Shutdown(shutdownCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown: err = %v, want DeadlineExceeded", err)
+	}
+
+	// The cancelled task is released for another instance
+	deadline := time.Now().Add(time.Second)
+	for task := transport.Tasks()[0]; task.Worker != "" || task.LastError == ""; task = transport.Tasks()[0] {
+		if time.Now().After(deadline) {
+			t.Fatalf("task after Shutdown = %+v, want it released with its error", task)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := pool.Enqueue(ctx, "stuck", nil); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Enqueue after Shutdown: err = %v, want ErrPoolClosed", err)
+	}
+}
+
+func TestShutdownDoesNotWaitForStuckHandlers(t *testing.T) {
+	transport := NewLoopback()
+	ctx := context.Background()
+
+	started := make(chan token)
+	release := make(chan token)
+	defer close(release)
+
+	pool := NewPool(transport, testConfig("a"))
+	pool.Handle("stuck", func(context.Context, *Task) error {
+		close(started)
+		<-release // Ignores the cancellation
+		return nil
+	})
+	pool.Enqueue(ctx, "stuck", nil)
+	pool.Start(ctx)
+	<-started
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+
+	returned := make(chan error, 1)
+	go func() { returned <- pool.Shutdown(shutdownCtx) }()
+
+	select {
+	case err := <-returned:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Shutdown: err = %v, want DeadlineExceeded", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown waited for a handler ignoring its context")
+	}
+}
+
+func TestShutdownBeforeStart(t *testing.T) {
+	transport := NewLoopback()
+	pool := NewPool(transport, testConfig("a"))
+	pool.Handle("task", func(context.Context, *Task) error {
+		t.Error("task run after Shutdown")
+		return nil
+	})
+	pool.Enqueue(context.Background(), "task", nil)
+
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	pool.Start(context.Background())
+	time.Sleep(30 * time.Millisecond)
+	if tasks := transport.Tasks(); len(tasks) != 1 || tasks[0].Attempts != 0 {
+		t.Errorf("tasks = %+v, want the task untouched", tasks)
+	}
+}
@@ -0,0 +1,83 @@
+package distributed
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Task is a unit of work shared between service instances.
+// Its input travels as a serialized payload, interpreted by the handler registered under Name.
+type Task struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Payload    []byte    `json:"payload,omitempty"`
+	Attempts   int       `json:"attempts"`            // Times the task was leased, including the current lease
+	EnqueuedAt time.Time `json:"enqueuedAt"`          // When the task was first enqueued
+	NotBefore  time.Time `json:"notBefore"`           // The task isn't leased before this time, set when retrying
+	Worker     string    `json:"worker,omitempty"`    // Worker holding the lease, empty when the task is available
+	LeaseUntil time.Time `json:"leaseUntil"`          // Lease expiry, after which another worker may take the task
+	LastError  string    `json:"lastError,omitempty"` // Error of the previous attempt
+}
+
+// available reports whether the task can be leased at now:
+// it isn't held by a live lease and isn't waiting for a retry.
+func (t *Task) available(now time.Time) bool {
+	if t.Worker != "" && now.Before(t.LeaseUntil) {
+		return false
+	}
+
+	return !now.Before(t.NotBefore)
+}
+
+// heldBy reports whether worker holds a live lease on the task at now.
+func (t *Task) heldBy(worker string, now time.Time) bool {
+	return t.Worker == worker && now.Before(t.LeaseUntil)
+}
+
+// release clears the lease of a failed task and makes it available again at retryAt.
+func release(task *Task, retryAt time.Time, cause error) {
+	task.Worker = ""
+	task.LeaseUntil = time.Time{}
+	task.NotBefore = retryAt
+	task.LastError = ""
+	if cause != nil {
+		task.LastError = cause.Error()
+	}
+}
+
+// newTaskID returns an ID that sorts by enqueue time, so transports listing tasks
+// in key order hand them out oldest first.
+func newTaskID(now time.Time) string {
+	return fmt.Sprintf("%020d-%s", now.UnixNano(), uuid.NewString())
+}
+
+/**
+ * Transport is the shared store that the instances of a service enqueue tasks to and lease them from.
+ *
+ * A lease gives one worker exclusive ownership of a task until it expires. Workers extend their lease
+ * with Heartbeat while the task runs; if a worker dies, its lease runs out and the task is handed
+ * to the next worker asking for one. Tasks are therefore delivered at least once, and handlers must
+ * tolerate running a task more than once.
+ *
+ * Implementations must be safe for concurrent use. Leases are compared against the local clock of
+ * the caller, so the instances' clocks are expected to be reasonably in sync (well within the lease TTL).
+ */
+type Transport interface {
+	// Enqueue stores a new task. The ID and EnqueuedAt are already set.
+	Enqueue(ctx context.Context, task *Task) error
+	// Lease hands out the oldest available task to worker until ttl from now,
+	// incrementing its attempts. Returns ErrNoTask if no task is available.
+	Lease(ctx context.Context, worker string, ttl time.Duration) (*Task, error)
+	// Heartbeat extends the lease of worker on the task until ttl from now.
+	// Returns ErrLeaseLost if the task is no longer leased to worker.
+	Heartbeat(ctx context.Context, id, worker string, ttl time.Duration) error
+	// Ack removes a task completed by worker.
+	// Returns ErrLeaseLost if the task is no longer leased to worker.
+	Ack(ctx context.Context, id, worker string) error
+	// Nack releases a task that failed, making it available again at retryAt.
+	// Returns ErrLeaseLost if the task is no longer leased to worker.
+	Nack(ctx context.Context, id, worker string, retryAt time.Time, cause error) error
+}
@@ -0,0 +1,10 @@
+package workerpool
+
+import "errors"
+
+// Errors shared by every Pool implementation.
+var (
+	ErrPoolClosed      = errors.New("pool closed")
+	ErrScheduleTimeout = errors.New("schedule timeout")
+	ErrQueueFull       = errors.New("queue full")
+)
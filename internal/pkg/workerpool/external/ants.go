@@ -0,0 +1,187 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"pkg/workerpool"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/panjf2000/ants/v2"
+)
+
+type token = struct{}
+
+/**
+ * Ants adapts a panjf2000/ants pool to workerpool.Pool.
+ *
+ * ants has no task queue: a submission blocks until a worker is free, and the blocked callers
+ * are the queue. The adapter keeps that model and bounds it the same way ants' MaxBlockingTasks does,
+ * while adding the timeout, non-blocking and shutdown semantics of the other pools:
+ *
+ *   - a worker slot is taken before submitting, so ants itself never blocks
+ *   - at most queueSize callers wait for a slot, further ones get ErrQueueFull
+ */
+type Ants struct {
+	pool      *ants.Pool
+	slots     chan token // One per worker, held while a task runs
+	queueSize int
+	waiting   atomic.Int32 // Callers blocked waiting for a slot
+	running   sync.WaitGroup
+	admission sync.RWMutex // Held by Schedule calls, lets Shutdown wait for them to finish
+	closing   chan token   // Closed when the pool stops admitting tasks
+	closeOnce sync.Once
+}
+
+// NewAnts creates an ants pool of workers goroutines, with room for queueSize callers waiting
+// for a free worker (0 for no limit). opts are passed to ants, e.g. ants.WithPreAlloc.
+func NewAnts(workers, queueSize int, opts ...ants.Option) (*Ants, error) {
+	pool, err := ants.NewPool(workers, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ants{
+		pool:      pool,
+		slots:     make(chan token, workers),
+		queueSize: queueSize,
+		closing:   make(chan token),
+	}, nil
+}
+
+// Schedule runs the task once a worker is free, blocking until then.
+// Returns ErrQueueFull if queueSize callers are already waiting and ErrPoolClosed if the pool is shutting down.
+func (a *Ants) Schedule(task func()) error {
+	return a.schedule(nil, task)
+}
+
+// ScheduleTimeout runs the task once a worker is free, giving up with ErrScheduleTimeout after timeout.
+func (a *Ants) ScheduleTimeout(timeout time.Duration, task func()) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	return a.schedule(timer.C, task)
+}
+
+// TrySchedule runs the task only if a worker is free right now. It never blocks.
+func (a *Ants) TrySchedule(task func()) error {
+	a.admission.RLock()
+	defer a.admission.RUnlock()
+
+	if a.isClosing() {
+		return workerpool.ErrPoolClosed
+	}
+
+	select {
+	case a.slots <- token{}:
+		return a.submit(task)
+	default:
+		return workerpool.ErrQueueFull
+	}
+}
+
+// schedule waits for a worker slot until expired fires (never if nil), then submits the task.
+func (a *Ants) schedule(expired <-chan time.Time, task func()) error {
+	a.admission.RLock()
+	defer a.admission.RUnlock()
+
+	if a.isClosing() {
+		return workerpool.ErrPoolClosed
+	}
+
+	// Fast path: a worker is free
+	select {
+	case a.slots <- token{}:
+		return a.submit(task)
+	default:
+	}
+
+	if waiting := a.waiting.Add(1); a.queueSize > 0 && int(waiting) > a.queueSize {
+		a.waiting.Add(-1)
+		return workerpool.ErrQueueFull
+	}
+	defer a.waiting.Add(-1)
+
+	select {
+	case a.slots <- token{}:
+		return a.submit(task)
+	case <-expired:
+		return workerpool.ErrScheduleTimeout
+	case <-a.closing:
+		return workerpool.ErrPoolClosed
+	}
+}
+
+// submit hands the task to ants once a slot is held. The slot is released when the task returns.
+func (a *Ants) submit(task func()) error {
+	a.running.Add(1)
+
+	err := a.pool.Submit(func() {
+		defer a.running.Done()
+		defer func() { <-a.slots }()
+		task()
+	})
+	if err == nil {
+		return nil
+	}
+
+	<-a.slots
+	a.running.Done()
+
+	if errors.Is(err, ants.ErrPoolClosed) {
+		return workerpool.ErrPoolClosed
+	}
+	return err
+}
+
+// isClosing reports whether the pool has stopped admitting tasks.
+func (a *Ants) isClosing() bool {
+	select {
+	case <-a.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stats returns a snapshot of the pool. QueueDepth counts the callers waiting for a worker.
+func (a *Ants) Stats() workerpool.Stats {
+	return workerpool.Stats{
+		ActiveWorkers: a.pool.Running(),
+		MaxWorkers:    a.pool.Cap(),
+		QueueDepth:    int(a.waiting.Load()),
+		QueueSize:     a.queueSize,
+	}
+}
+
+// Shutdown stops admitting tasks, waits for running ones until ctx is done and releases the ants pool.
+// Callers still waiting for a worker get ErrPoolClosed, so no accepted task is ever dropped and
+// the count is always 0. Tasks still running when ctx is done can't be stopped by ants: they run
+// to completion after Shutdown has returned ctx.Err(), and are not counted as dropped either.
+func (a *Ants) Shutdown(ctx context.Context) (int, error) {
+	a.closeOnce.Do(func() {
+		close(a.closing)
+
+		// Wait for Schedule calls in progress, so no task is submitted after this point
+		a.admission.Lock()
+		a.admission.Unlock()
+	})
+
+	finished := make(chan token)
+	go func() {
+		a.running.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		a.pool.Release()
+		return 0, nil
+	case <-ctx.Done():
+		a.pool.Release()
+		return 0, ctx.Err()
+	}
+}
+
+var _ workerpool.Pool = (*Ants)(nil)
@@ -0,0 +1,8 @@
+package group
+
+import "errors"
+
+var (
+	ErrGroupExists   = errors.New("worker group already declared")
+	ErrGroupNotFound = errors.New("worker group not found")
+)
@@ -0,0 +1,261 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	adaptive "pkg/workerpool/custom/adaptive"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Stats is a snapshot of one worker group.
+type Stats struct {
+	Name          string
+	MinWorkers    int
+	MaxWorkers    int
+	ActiveWorkers int
+	QueueDepth    int
+	QueueSize     int
+	Submitted     uint64 // Tasks accepted by the group
+	Completed     uint64 // Accepted tasks that have finished, including panicked ones
+	Rejected      uint64 // Tasks turned down because the group was closed or its queue stayed full
+}
+
+// group is a named adaptive pool together with its counters.
+type group struct {
+	name      string
+	pool      *adaptive.Pool
+	queueSize int
+	submitted atomic.Uint64
+	completed atomic.Uint64
+	rejected  atomic.Uint64
+}
+
+/**
+ * Registry holds named worker groups, each an adaptive pool with its own sizing and queue.
+ *
+ * Splitting work by kind keeps one kind from starving another:
+ *
+ * 	registry.Declare("db-io", &adaptive.PoolConfig{MaxWorkers: 64, QueueSize: 1024, ...})
+ * 	registry.Declare("image-cpu", &adaptive.PoolConfig{MaxWorkers: runtime.NumCPU(), QueueSize: 128, ...})
+ *
+ * 	registry.Schedule("db-io", func() { ... })
+ */
+type Registry struct {
+	mutex  sync.RWMutex
+	groups map[string]*group
+	meter  metric.Meter // Meter handed to every group, nil when metrics are disabled
+}
+
+// Option configures optional behaviour of the registry.
+type Option func(*Registry)
+
+// WithMetrics exports the metrics of every group on meter, labelled with the group name.
+func WithMetrics(meter metric.Meter) Option {
+	return func(r *Registry) {
+		r.meter = meter
+	}
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry(opts ...Option) *Registry {
+	registry := &Registry{groups: make(map[string]*group)}
+
+	for _, opt := range opts {
+		opt(registry)
+	}
+
+	return registry
+}
+
+// Declare creates a worker group sized according to conf.
+// opts are passed to the group's pool, after the registry's own options.
+func (r *Registry) Declare(name string, conf *adaptive.PoolConfig, opts ...adaptive.Option) (*adaptive.Pool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.groups[name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrGroupExists, name)
+	}
+
+	if r.meter != nil {
+		opts = append([]adaptive.Option{adaptive.WithMetrics(r.meter, name)}, opts...)
+	}
+
+	g := &group{
+		name:      name,
+		pool:      adaptive.NewPoolFromConfig(conf, opts...),
+		queueSize: conf.QueueSize,
+	}
+	r.groups[name] = g
+
+	return g.pool, nil
+}
+
+// DeclareAll declares a group for every entry of confs, e.g. loaded from a configuration file.
+// If one of them cannot be declared, the groups declared so far are removed and shut down.
+func (r *Registry) DeclareAll(confs map[string]*adaptive.PoolConfig) error {
+	declared := make([]string, 0, len(confs))
+
+	for name, conf := range confs {
+		if _, err := r.Declare(name, conf); err != nil {
+			r.undeclare(declared)
+			return err
+		}
+		declared = append(declared, name)
+	}
+
+	return nil
+}
+
+// undeclare removes the named groups and shuts their pools down.
+// It is only used for groups that were never handed out, so there are no tasks to wait for.
+func (r *Registry) undeclare(names []string) {
+	r.mutex.Lock()
+	groups := make([]*group, 0, len(names))
+	for _, name := range names {
+		groups = append(groups, r.groups[name])
+		delete(r.groups, name)
+	}
+	r.mutex.Unlock()
+
+	for _, g := range groups {
+		g.pool.Shutdown(context.Background())
+	}
+}
+
+// Group returns the pool of the named group.
+func (r *Registry) Group(name string) (*adaptive.Pool, error) {
+	g, err := r.group(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.pool, nil
+}
+
+// group looks up a group by name.
+func (r *Registry) group(name string) (*group, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	g, ok := r.groups[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, name)
+	}
+
+	return g, nil
+}
+
+// Schedule adds a task to the named group, blocking while its queue is full.
+func (r *Registry) Schedule(name string, task func()) error {
+	g, err := r.group(name)
+	if err != nil {
+		return err
+	}
+
+	return g.count(g.pool.Schedule(g.track(task)))
+}
+
+// ScheduleTimeout adds a task to the named group, giving up after timeout while its queue is full.
+func (r *Registry) ScheduleTimeout(name string, timeout time.Duration, task func()) error {
+	g, err := r.group(name)
+	if err != nil {
+		return err
+	}
+
+	return g.count(g.pool.ScheduleTimeout(timeout, g.track(task)))
+}
+
+// track wraps a task so that its completion is counted, even if it panics.
+func (g *group) track(task func()) func() {
+	return func() {
+		defer g.completed.Add(1)
+		task()
+	}
+}
+
+// count updates the submission counters with the outcome of a Schedule call and returns err.
+func (g *group) count(err error) error {
+	if err != nil {
+		g.rejected.Add(1)
+		return err
+	}
+
+	g.submitted.Add(1)
+	return nil
+}
+
+// Stats returns a snapshot of every group, sorted by name.
+func (r *Registry) Stats() []Stats {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	stats := make([]Stats, 0, len(r.groups))
+	for _, g := range r.groups {
+		stats = append(stats, g.stats())
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// stats returns a snapshot of the group.
+func (g *group) stats() Stats {
+	minWorkers, maxWorkers := g.pool.Limits()
+
+	return Stats{
+		Name:          g.name,
+		MinWorkers:    minWorkers,
+		MaxWorkers:    maxWorkers,
+		ActiveWorkers: g.pool.ActiveWorkerCount(),
+		QueueDepth:    g.pool.QueueDepth(),
+		QueueSize:     g.queueSize,
+		Submitted:     g.submitted.Load(),
+		Completed:     g.completed.Load(),
+		Rejected:      g.rejected.Load(),
+	}
+}
+
+// Shutdown shuts every group down concurrently, waiting for them to drain until ctx is done.
+// It returns the total number of tasks dropped and the errors of the groups that didn't drain.
+func (r *Registry) Shutdown(ctx context.Context) (int, error) {
+	r.mutex.RLock()
+	groups := make([]*group, 0, len(r.groups))
+	for _, g := range r.groups {
+		groups = append(groups, g)
+	}
+	r.mutex.RUnlock()
+
+	var (
+		waitGroup sync.WaitGroup
+		mutex     sync.Mutex
+		dropped   int
+		errs      []error
+	)
+
+	for _, g := range groups {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+
+			n, err := g.pool.Shutdown(ctx)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			dropped += n
+			if err != nil {
+				errs = append(errs, fmt.Errorf("group %s: %w", g.name, err))
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+	return dropped, errors.Join(errs...)
+}
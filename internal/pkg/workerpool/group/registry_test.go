@@ -0,0 +1,78 @@
+package group
+
+import (
+	"context"
+	"errors"
+	adaptive "pkg/workerpool/custom/adaptive"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testConfig() *adaptive.PoolConfig {
+	return &adaptive.PoolConfig{MaxWorkers: 2, QueueSize: 4, IdleTimeout: time.Second}
+}
+
+func TestRegistrySchedulesByGroup(t *testing.T) {
+	registry := NewRegistry()
+	defer registry.Shutdown(context.Background())
+
+	if _, err := registry.Declare("io", testConfig()); err != nil {
+		t.Fatalf("Declare: %v", err)
+	}
+	if _, err := registry.Declare("io", testConfig()); !errors.Is(err, ErrGroupExists) {
+		t.Fatalf("Declare twice: err = %v, want ErrGroupExists", err)
+	}
+
+	var waitGroup sync.WaitGroup
+	for range 10 {
+		waitGroup.Add(1)
+		if err := registry.Schedule("io", waitGroup.Done); err != nil {
+			t.Fatalf("Schedule: %v", err)
+		}
+	}
+	waitGroup.Wait()
+
+	if err := registry.Schedule("cpu", func() {}); !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("Schedule on unknown group: err = %v, want ErrGroupNotFound", err)
+	}
+
+	if _, err := registry.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := registry.Schedule("io", func() {}); err == nil {
+		t.Fatal("Schedule after Shutdown succeeded")
+	}
+
+	stats := registry.Stats()
+	if len(stats) != 1 || stats[0].Name != "io" || stats[0].Submitted != 10 || stats[0].Completed != 10 || stats[0].Rejected != 1 {
+		t.Fatalf("Stats = %+v, want 10 submitted and completed, 1 rejected", stats)
+	}
+}
+
+func TestDeclareAllRemovesGroupsOnFailure(t *testing.T) {
+	registry := NewRegistry()
+	defer registry.Shutdown(context.Background())
+
+	if _, err := registry.Declare("taken", testConfig()); err != nil {
+		t.Fatalf("Declare: %v", err)
+	}
+
+	err := registry.DeclareAll(map[string]*adaptive.PoolConfig{
+		"a":     testConfig(),
+		"b":     testConfig(),
+		"taken": testConfig(),
+	})
+	if !errors.Is(err, ErrGroupExists) {
+		t.Fatalf("DeclareAll: err = %v, want ErrGroupExists", err)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		if _, err := registry.Group(name); !errors.Is(err, ErrGroupNotFound) {
+			t.Errorf("Group(%q): err = %v, want the group to be removed", name, err)
+		}
+	}
+	if _, err := registry.Group("taken"); err != nil {
+		t.Errorf("Group(taken): %v, want the existing group to be kept", err)
+	}
+}
@@ -0,0 +1,195 @@
+package keyed
+
+import (
+	"log"
+	"sync"
+)
+
+// Scheduler runs the drain loops of the executor, e.g. any workerpool.Pool.
+type Scheduler interface {
+	Schedule(task func()) error
+}
+
+/**
+ * Executor runs tasks sharing a key strictly one after another, in the order they were scheduled,
+ * while tasks of different keys run in parallel on the underlying pool.
+ *
+ * 	orders := keyed.New[string](pool)
+ * 	orders.Schedule(productID, func() { applyStockChange(change) })
+ *
+ * A task for a key nobody is draining is handed to the pool together with a drain loop: the first loop
+ * of the key to start claims it, runs its tasks in order, including any queued meanwhile, and releases
+ * the key once it is empty; other loops of the key find it claimed or empty and return right away.
+ * Tasks behind a running loop never wait on the pool, so a full pool can't deadlock the executor,
+ * and the state of a key is dropped as soon as it has nothing queued.
+ *
+ * As every task queued while its key is unclaimed comes with its own loop, a loop the pool discards
+ * without running it, e.g. under the DropOldest policy or when Shutdown gives up, doesn't strand the key:
+ * its tasks run with the key's next loop. A task whose loop the pool refuses is dropped, unless another
+ * loop has picked it up meanwhile, and the pool's error is returned to the caller.
+ */
+type Executor[K comparable] struct {
+	pool  Scheduler
+	mutex sync.Mutex
+	keys  map[K]*queue // Tasks of the keys with tasks queued or running
+	seq   uint64       // Identifies queued tasks, so a refused one can be taken back
+}
+
+// queue holds the tasks of a key.
+type queue struct {
+	tasks   []entry // The head is the running task while the key is claimed
+	claimed bool    // A drain loop is running the key's tasks
+}
+
+type entry struct {
+	seq  uint64
+	task func()
+}
+
+// New creates a keyed executor running its tasks on pool.
+func New[K comparable](pool Scheduler) *Executor[K] {
+	return &Executor[K]{
+		pool: pool,
+		keys: make(map[K]*queue),
+	}
+}
+
+// tryScheduler is implemented by pools able to refuse a task instead of waiting, e.g. any workerpool.Pool.
+type tryScheduler interface {
+	TrySchedule(task func()) error
+}
+
+// Schedule queues a task behind the earlier tasks of the same key.
+// If a drain loop is running the key, the task is left to it and nil is returned; otherwise a loop
+// is handed to the pool and, if the pool refuses it, the task is dropped and the pool's error returned.
+func (e *Executor[K]) Schedule(key K, task func()) error {
+	return e.schedule(key, task, e.pool.Schedule)
+}
+
+// TrySchedule is Schedule without waiting for the pool: if no loop is running the key and the pool
+// has no room right away, the task is dropped and the pool's error returned.
+// It waits as Schedule does if the pool can't refuse tasks.
+func (e *Executor[K]) TrySchedule(key K, task func()) error {
+	if pool, ok := e.pool.(tryScheduler); ok {
+		return e.schedule(key, task, pool.TrySchedule)
+	}
+
+	return e.schedule(key, task, e.pool.Schedule)
+}
+
+// schedule queues a task behind the earlier tasks of the same key, handing a drain loop
+// to submit unless one is running the key.
+func (e *Executor[K]) schedule(key K, task func(), submit func(task func()) error) error {
+	e.mutex.Lock()
+	q, ok := e.keys[key]
+	if !ok {
+		q = &queue{}
+		e.keys[key] = q
+	}
+	e.seq++
+	seq := e.seq
+	q.tasks = append(q.tasks, entry{seq, task})
+	claimed := q.claimed
+	e.mutex.Unlock()
+
+	if claimed {
+		return nil
+	}
+
+	err := submit(func() { e.drain(key) })
+	if err == nil || !e.withdraw(key, seq) {
+		return nil
+	}
+
+	return err
+}
+
+// withdraw removes the task seq from the tasks of key and reports whether it was still waiting:
+// a task a drain loop has claimed meanwhile runs whatever happened to its own loop.
+func (e *Executor[K]) withdraw(key K, seq uint64) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	q, ok := e.keys[key]
+	if !ok || q.claimed {
+		return false
+	}
+
+	for i, entry := range q.tasks {
+		if entry.seq == seq {
+			q.tasks = append(q.tasks[:i], q.tasks[i+1:]...)
+			if len(q.tasks) == 0 {
+				delete(e.keys, key)
+			}
+			return true
+		}
+	}
+
+	return false
+}
+
+// drain claims key and runs its tasks until none are left.
+// It returns right away if another loop has claimed the key or its tasks have already run.
+func (e *Executor[K]) drain(key K) {
+	e.mutex.Lock()
+	q, ok := e.keys[key]
+	if !ok || q.claimed {
+		e.mutex.Unlock()
+		return
+	}
+	q.claimed = true
+	task := q.tasks[0].task
+	e.mutex.Unlock()
+
+	for task != nil {
+		e.run(task)
+		task = e.next(key, q)
+	}
+}
+
+// next removes the task that just ran and returns the following one,
+// or releases the key and returns nil if there is none.
+func (e *Executor[K]) next(key K, q *queue) func() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	q.tasks[0] = entry{}
+	q.tasks = q.tasks[1:]
+
+	if len(q.tasks) == 0 {
+		delete(e.keys, key)
+		return nil
+	}
+
+	return q.tasks[0].task
+}
+
+// run executes a task, recovering from a panic so the rest of the key's tasks still run.
+func (e *Executor[K]) run(task func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("workerpool: keyed task panicked: %v", r)
+		}
+	}()
+
+	task()
+}
+
+// Pending returns the number of tasks queued or running for key.
+func (e *Executor[K]) Pending(key K) int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if q, ok := e.keys[key]; ok {
+		return len(q.tasks)
+	}
+	return 0
+}
+
+// Keys returns the number of keys with tasks queued or running.
+func (e *Executor[K]) Keys() int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return len(e.keys)
+}
@@ -0,0 +1,273 @@
+package keyed
+
+import (
+	"errors"
+	"pkg/workerpool"
+	"pkg/workerpool/external"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// goScheduler runs every drain loop on its own goroutine.
+type goScheduler struct{}
+
+func (goScheduler) Schedule(task func()) error {
+	go task()
+	return nil
+}
+
+// scriptedScheduler hands every drain loop to decide, which may run it, keep it or drop it,
+// and returns its error.
+type scriptedScheduler struct {
+	decide func(loop func()) error
+}
+
+func (s scriptedScheduler) Schedule(loop func()) error {
+	return s.decide(loop)
+}
+
+func TestTasksOfAKeyRunInOrder(t *testing.T) {
+	e := New[string](goScheduler{})
+
+	const perKey = 200
+	keys := []string{"a", "b", "c", "d"}
+
+	var mutex sync.Mutex
+	var done sync.WaitGroup
+	order := make(map[string][]int)
+
+	for i := range perKey {
+		for _, key := range keys {
+			done.Add(1)
+			e.Schedule(key, func() {
+				defer done.Done()
+				mutex.Lock()
+				order[key] = append(order[key], i)
+				mutex.Unlock()
+			})
+		}
+	}
+	done.Wait()
+
+	for _, key := range keys {
+		if !slices.IsSorted(order[key]) || len(order[key]) != perKey {
+			t.Errorf("key %s ran %d tasks out of order", key, len(order[key]))
+		}
+	}
+	if n := e.Keys(); n != 0 {
+		t.Errorf("Keys = %d once drained, want 0", n)
+	}
+}
+
+func TestKeysRunInParallel(t *testing.T) {
+	e := New[int](goScheduler{})
+
+	// Every key waits for all the others to be running
+	const keys = 4
+	var running sync.WaitGroup
+	running.Add(keys)
+	finished := make(chan struct{}, keys)
+
+	for key := range keys {
+		e.Schedule(key, func() {
+			running.Done()
+			running.Wait()
+			finished <- struct{}{}
+		})
+	}
+
+	for range keys {
+		select {
+		case <-finished:
+		case <-time.After(time.Second):
+			t.Fatal("keys ran one after another")
+		}
+	}
+}
+
+func TestPendingAndKeys(t *testing.T) {
+	e := New[string](goScheduler{})
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	e.Schedule("a", func() { close(started); <-release })
+	<-started
+
+	e.Schedule("a", func() {})
+	e.Schedule("a", func() {})
+
+	if pending := e.Pending("a"); pending != 3 {
+		t.Errorf("Pending(a) = %d, want the running task and 2 queued", pending)
+	}
+	if pending := e.Pending("b"); pending != 0 {
+		t.Errorf("Pending(b) = %d, want 0", pending)
+	}
+	if n := e.Keys(); n != 1 {
+		t.Errorf("Keys = %d, want 1", n)
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for e.Keys() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Keys = %d once drained, want 0", e.Keys())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPanicDoesNotStopKey(t *testing.T) {
+	e := New[string](goScheduler{})
+
+	release := make(chan struct{})
+	e.Schedule("a", func() { <-release })
+	e.Schedule("a", func() { panic("boom") })
+
+	ran := make(chan struct{})
+	e.Schedule("a", func() { close(ran) })
+	close(release)
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("task queued behind a panic never ran")
+	}
+}
+
+func TestRefusedLoopDropsTasks(t *testing.T) {
+	errClosed := errors.New("pool closed")
+
+	// Both loops wait in the pool until the test refuses them
+	submitted := make(chan struct{})
+	refuse := make(chan struct{})
+	e := New[string](scriptedScheduler{func(func()) error {
+		submitted <- struct{}{}
+		<-refuse
+		return errClosed
+	}})
+
+	refused := make(chan error, 2)
+	for range 2 {
+		go func() { refused <- e.Schedule("a", func() { t.Error("refused task ran") }) }()
+		<-submitted
+	}
+	close(refuse)
+
+	for range 2 {
+		if err := <-refused; !errors.Is(err, errClosed) {
+			t.Errorf("Schedule: err = %v, want %v for every dropped task", err, errClosed)
+		}
+	}
+	if pending, keys := e.Pending("a"), e.Keys(); pending != 0 || keys != 0 {
+		t.Errorf("Pending(a) = %d, Keys = %d after a refusal, want nothing left", pending, keys)
+	}
+}
+
+func TestRefusedLoopKeepsClaimedTasks(t *testing.T) {
+	var loops []func()
+	e := New[string](scriptedScheduler{func(loop func()) error {
+		if len(loops) == 0 {
+			loops = append(loops, loop)
+			return nil
+		}
+		// The first loop runs, with the second task, before the pool turns the second loop down
+		loops[0]()
+		return workerpool.ErrQueueFull
+	}})
+
+	var ran []int
+	e.Schedule("a", func() { ran = append(ran, 1) })
+	if err := e.Schedule("a", func() { ran = append(ran, 2) }); err != nil {
+		t.Errorf("Schedule: err = %v, want nil as the task ran", err)
+	}
+
+	if !slices.Equal(ran, []int{1, 2}) {
+		t.Errorf("ran %v, want [1 2]", ran)
+	}
+}
+
+func TestDiscardedLoopDoesNotStrandKey(t *testing.T) {
+	// The pool silently drops the first loop, as DropOldest or an expired Shutdown do
+	dropped := false
+	e := New[string](scriptedScheduler{func(loop func()) error {
+		if !dropped {
+			dropped = true
+			return nil
+		}
+		go loop()
+		return nil
+	}})
+
+	var mutex sync.Mutex
+	var ran []int
+	done := make(chan struct{})
+	e.Schedule("a", func() { mutex.Lock(); ran = append(ran, 1); mutex.Unlock() })
+	e.Schedule("a", func() { mutex.Lock(); ran = append(ran, 2); mutex.Unlock(); close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("key stranded by a discarded loop")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !slices.Equal(ran, []int{1, 2}) {
+		t.Errorf("ran %v, want [1 2]", ran)
+	}
+}
+
+func TestScheduleAfterPoolShutdown(t *testing.T) {
+	// Shutdown gives up on the loop of the first task, the pool is closed from then on
+	closed := false
+	e := New[string](scriptedScheduler{func(func()) error {
+		if !closed {
+			closed = true
+			return nil
+		}
+		return workerpool.ErrPoolClosed
+	}})
+
+	e.Schedule("a", func() {})
+
+	for _, key := range []string{"a", "b"} {
+		if err := e.Schedule(key, func() { t.Errorf("task of %s ran after Shutdown", key) }); !errors.Is(err, workerpool.ErrPoolClosed) {
+			t.Errorf("Schedule(%s) after Shutdown: err = %v, want ErrPoolClosed", key, err)
+		}
+	}
+	if pending, keys := e.Pending("a"), e.Keys(); pending != 1 || keys != 1 {
+		t.Errorf("Pending(a) = %d, Keys = %d, want only the discarded task left", pending, keys)
+	}
+}
+
+func TestTryScheduleDoesNotWaitForPool(t *testing.T) {
+	pool, err := external.NewAnts(1, 0)
+	if err != nil {
+		t.Fatalf("NewAnts: %v", err)
+	}
+	e := New[string](pool)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	if err := e.TrySchedule("a", func() { close(started); <-release }); err != nil {
+		t.Fatalf("TrySchedule: %v", err)
+	}
+	<-started
+
+	// Behind a running task of its key, a task is queued without asking the pool
+	if err := e.TrySchedule("a", func() {}); err != nil {
+		t.Errorf("TrySchedule on a busy key: %v", err)
+	}
+
+	// An idle key needs a worker, there is none
+	if err := e.TrySchedule("b", func() {}); !errors.Is(err, workerpool.ErrQueueFull) {
+		t.Errorf("TrySchedule on a full pool: err = %v, want ErrQueueFull", err)
+	}
+	if pending := e.Pending("b"); pending != 0 {
+		t.Errorf("Pending(b) = %d after a refused task, want 0", pending)
+	}
+
+	close(release)
+}
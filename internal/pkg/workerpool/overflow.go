@@ -0,0 +1,152 @@
+package workerpool
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy decides what Schedule does when the queue is full and no more workers can be started.
+type OverflowPolicy int
+
+const (
+	// Block waits until the queue has room (or the timeout of ScheduleTimeout passes).
+	Block OverflowPolicy = iota
+	// Reject fails right away with ErrQueueFull.
+	Reject
+	// DropOldest discards the task that has waited longest to make room for the new one.
+	DropOldest
+	// CallerRuns runs the task in the goroutine calling Schedule, slowing the producer down.
+	CallerRuns
+)
+
+var overflowPolicyNames = map[OverflowPolicy]string{
+	Block:      "block",
+	Reject:     "reject",
+	DropOldest: "drop-oldest",
+	CallerRuns: "caller-runs",
+}
+
+func (o OverflowPolicy) String() string {
+	if name, ok := overflowPolicyNames[o]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("OverflowPolicy(%d)", int(o))
+}
+
+// ParseOverflowPolicy returns the policy named by s, as used in configuration files:
+// "block", "reject", "drop-oldest" or "caller-runs". An empty string is Block.
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	if s == "" {
+		return Block, nil
+	}
+
+	for policy, name := range overflowPolicyNames {
+		if name == s {
+			return policy, nil
+		}
+	}
+
+	return Block, fmt.Errorf("unknown overflow policy %q", s)
+}
+
+/**
+ * Overflow applies an OverflowPolicy to the queue of a pool running bare func() tasks, such as the
+ * fixed and adaptive pools. The pool fills in the fields it owns and calls Apply (or ApplyTimeout)
+ * once the queue is full at its worker limit, then passes the outcome through Complete:
+ *
+ * 	return p.overflow.Complete(task, p.schedule(task))
+ *
+ * Apply runs under the pool's admission lock, Complete after it is released, so a task run
+ * by the caller can't hold up a Shutdown past its deadline.
+ */
+type Overflow struct {
+	Policy   OverflowPolicy
+	Queue    chan func()
+	Closing  <-chan struct{}       // Closed when the pool stops admitting tasks, waiting calls return ErrPoolClosed
+	Running  *sync.WaitGroup       // Counts tasks run by the caller, so a graceful shutdown waits for them
+	RunTask  func(task func())     // Runs a task handed back by CallerRuns, e.g. recovering from panics
+	Rejected func(err error) error // Records a task turned down with err and returns err, may be nil
+	Dropped  func()                // Records a queued task discarded by DropOldest, may be nil
+}
+
+// errCallerRuns tells Complete to run the task itself, as asked by the CallerRuns policy.
+var errCallerRuns = errors.New("caller runs task")
+
+// Apply applies the policy to a task that found the queue full at the worker limit.
+// The Block policy waits until expired fires, or indefinitely if expired is nil.
+// Returns ErrQueueFull, ErrScheduleTimeout or ErrPoolClosed when the task is turned down.
+func (o *Overflow) Apply(task func(), expired <-chan time.Time) error {
+	switch o.Policy {
+	case Reject:
+		return o.reject(ErrQueueFull)
+
+	case CallerRuns:
+		// Counted like a worker, so a graceful Shutdown still waits for the task
+		o.Running.Add(1)
+		return errCallerRuns
+
+	case DropOldest:
+		// An unbuffered queue has nothing to drop, so the task waits like with Block
+		for cap(o.Queue) > 0 {
+			select {
+			case o.Queue <- task:
+				return nil
+			default:
+			}
+
+			select {
+			case <-o.Queue:
+				if o.Dropped != nil {
+					o.Dropped()
+				}
+			default:
+				// A worker took it meanwhile, try again
+			}
+		}
+	}
+
+	select {
+	case o.Queue <- task:
+		return nil
+	case <-expired:
+		return o.reject(ErrScheduleTimeout)
+	case <-o.Closing:
+		return o.reject(ErrPoolClosed)
+	}
+}
+
+// ApplyTimeout applies the policy like Apply, giving the Block policy up to timeout.
+func (o *Overflow) ApplyTimeout(task func(), timeout time.Duration) error {
+	if o.Policy != Block {
+		return o.Apply(task, nil)
+	}
+
+	timer := acquireTimer(timeout)
+	defer releaseTimer(timer)
+
+	return o.Apply(task, timer.C)
+}
+
+// Complete runs a task handed back by the CallerRuns policy on the calling goroutine and
+// returns any other outcome of a Schedule call as is.
+func (o *Overflow) Complete(task func(), err error) error {
+	if err != errCallerRuns {
+		return err
+	}
+
+	defer o.Running.Done()
+	o.RunTask(task)
+	return nil
+}
+
+// reject records a task turned down with err and returns err.
+func (o *Overflow) reject(err error) error {
+	if o.Rejected == nil {
+		return err
+	}
+
+	return o.Rejected(err)
+}
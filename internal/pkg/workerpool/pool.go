@@ -0,0 +1,42 @@
+package workerpool
+
+import (
+	"context"
+	"time"
+)
+
+// Stats is a snapshot of a pool's workers and queue.
+type Stats struct {
+	ActiveWorkers int // Workers currently started
+	MaxWorkers    int // Upper bound on workers
+	QueueDepth    int // Tasks waiting for a worker
+	QueueSize     int // Tasks that can wait for a worker before scheduling blocks or fails
+}
+
+/**
+ * Pool is implemented by every worker pool in pkg/workerpool, so a pool can be picked per workload
+ * and swapped without touching the code that schedules onto it:
+ *
+ * 	fixed.NewPool                 - a bounded number of long-lived workers, cheapest per task
+ * 	adaptive.NewPoolWithAutoScale - scales between a minimum and maximum worker count with the load
+ * 	featured.Pool.AsPool          - priorities, retries and a circuit breaker, at a higher cost per task
+ * 	external.NewAnts              - panjf2000/ants
+ *
+ * All implementations return the errors defined in this package, so callers can rely on errors.Is.
+ */
+type Pool interface {
+	// Schedule adds a task, blocking while the queue is full.
+	// Returns ErrPoolClosed if the pool is shutting down.
+	Schedule(task func()) error
+	// ScheduleTimeout adds a task, giving up with ErrScheduleTimeout once timeout has passed while the queue is full.
+	ScheduleTimeout(timeout time.Duration, task func()) error
+	// TrySchedule adds a task if that can be done right away and never blocks.
+	// Returns ErrQueueFull otherwise.
+	TrySchedule(task func()) error
+	// Stats returns a snapshot of the pool's workers and queue.
+	Stats() Stats
+	// Shutdown stops admitting tasks and waits for scheduled ones to finish until ctx is done.
+	// It returns the number of queued tasks dropped, along with ctx.Err(), if ctx ended first.
+	// Tasks already running when ctx ends are never dropped and not counted: they run to completion.
+	Shutdown(ctx context.Context) (int, error)
+}
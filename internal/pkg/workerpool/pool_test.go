@@ -0,0 +1,575 @@
+package workerpool_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pkg/workerpool"
+	adaptive "pkg/workerpool/custom/adaptive"
+	featured "pkg/workerpool/custom/featured"
+	fixed "pkg/workerpool/custom/fixed"
+	"pkg/workerpool/external"
+	"pkg/workerpool/ratelimit"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testWorkers   = 4
+	testQueueSize = 8
+)
+
+// implementation creates a pool with the given number of workers and queue size.
+type implementation struct {
+	name string
+	new  func(tb testing.TB, workers, queueSize int) workerpool.Pool
+}
+
+var implementations = []implementation{
+	{"fixed", func(_ testing.TB, workers, queueSize int) workerpool.Pool {
+		return fixed.NewPool(workers, queueSize, workers)
+	}},
+	{"adaptive", func(_ testing.TB, workers, queueSize int) workerpool.Pool {
+		return adaptive.NewPoolWithAutoScale(workers, 0, queueSize, time.Second)
+	}},
+	{"featured", func(_ testing.TB, workers, queueSize int) workerpool.Pool {
+		return featured.NewPool(workers, queueSize, workers).AsPool()
+	}},
+	{"ants", func(tb testing.TB, workers, queueSize int) workerpool.Pool {
+		pool, err := external.NewAnts(workers, queueSize)
+		if err != nil {
+			tb.Fatalf("NewAnts: %v", err)
+		}
+		return pool
+	}},
+	{"ratelimit", func(_ testing.TB, workers, queueSize int) workerpool.Pool {
+		limits := &ratelimit.Config{Global: ratelimit.Limit{Rate: 1e6, Burst: 1e6}}
+		return ratelimit.New(fixed.NewPool(workers, queueSize, workers), limits)
+	}},
+}
+
+// forEach runs the test against every implementation.
+func forEach(t *testing.T, test func(t *testing.T, pool workerpool.Pool)) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			pool := impl.new(t, testWorkers, testQueueSize)
+			t.Cleanup(func() { pool.Shutdown(expired()) })
+
+			test(t, pool)
+		})
+	}
+}
+
+// expired returns a context that is already done.
+func expired() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+// within returns a context that is done after d.
+func within(t *testing.T, d time.Duration) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// saturate blocks every worker and fills the queue with tasks waiting on release,
+// returning how many were accepted. Only TrySchedule is used, so it never blocks.
+func saturate(t *testing.T, pool workerpool.Pool, release <-chan struct{}, done *sync.WaitGroup) int {
+	t.Helper()
+
+	var started atomic.Int32
+	accepted := 0
+	deadline := time.Now().Add(time.Second)
+
+	for time.Now().Before(deadline) {
+		done.Add(1)
+		err := pool.TrySchedule(func() {
+			defer done.Done()
+			started.Add(1)
+			<-release
+		})
+
+		switch {
+		case err == nil:
+			accepted++
+		case errors.Is(err, workerpool.ErrQueueFull):
+			done.Done()
+			if started.Load() >= testWorkers {
+				return accepted
+			}
+			// Workers are still picking up the first tasks
+			time.Sleep(time.Millisecond)
+		default:
+			done.Done()
+			t.Fatalf("TrySchedule: %v", err)
+		}
+	}
+
+	t.Fatalf("pool never reported ErrQueueFull, %d tasks accepted", accepted)
+	return accepted
+}
+
+func TestScheduleRunsEveryTask(t *testing.T) {
+	forEach(t, func(t *testing.T, pool workerpool.Pool) {
+		const tasks = 1000
+
+		var ran atomic.Int32
+		for i := 0; i < tasks; i++ {
+			if err := pool.Schedule(func() { ran.Add(1) }); err != nil {
+				t.Fatalf("Schedule: %v", err)
+			}
+		}
+
+		if dropped, err := pool.Shutdown(within(t, 5*time.Second)); err != nil || dropped != 0 {
+			t.Fatalf("Shutdown = %d, %v; want 0, nil", dropped, err)
+		}
+		if got := ran.Load(); got != tasks {
+			t.Fatalf("ran %d tasks, want %d", got, tasks)
+		}
+	})
+}
+
+func TestTryScheduleNeverBlocks(t *testing.T) {
+	forEach(t, func(t *testing.T, pool workerpool.Pool) {
+		release := make(chan struct{})
+		var done sync.WaitGroup
+
+		accepted := saturate(t, pool, release, &done)
+		if accepted > testWorkers+testQueueSize {
+			t.Fatalf("accepted %d tasks, more than %d workers and %d queued", accepted, testWorkers, testQueueSize)
+		}
+
+		start := time.Now()
+		err := pool.TrySchedule(func() {})
+		if !errors.Is(err, workerpool.ErrQueueFull) {
+			t.Fatalf("TrySchedule on a full pool = %v, want ErrQueueFull", err)
+		}
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Fatalf("TrySchedule blocked for %v", elapsed)
+		}
+
+		close(release)
+		done.Wait()
+	})
+}
+
+func TestScheduleTimeoutOnFullPool(t *testing.T) {
+	forEach(t, func(t *testing.T, pool workerpool.Pool) {
+		release := make(chan struct{})
+		var done sync.WaitGroup
+		saturate(t, pool, release, &done)
+
+		// Fill whatever room blocking callers have on top of the queue
+		for {
+			done.Add(1)
+			err := pool.ScheduleTimeout(10*time.Millisecond, func() {
+				defer done.Done()
+				<-release
+			})
+			if err != nil {
+				done.Done()
+				if !errors.Is(err, workerpool.ErrScheduleTimeout) && !errors.Is(err, workerpool.ErrQueueFull) {
+					t.Fatalf("ScheduleTimeout on a full pool = %v, want ErrScheduleTimeout or ErrQueueFull", err)
+				}
+				break
+			}
+		}
+
+		close(release)
+		done.Wait()
+
+		if err := pool.ScheduleTimeout(time.Second, func() {}); err != nil {
+			t.Fatalf("ScheduleTimeout once drained = %v", err)
+		}
+	})
+}
+
+func TestScheduleAfterShutdown(t *testing.T) {
+	forEach(t, func(t *testing.T, pool workerpool.Pool) {
+		if _, err := pool.Shutdown(within(t, time.Second)); err != nil {
+			t.Fatalf("Shutdown: %v", err)
+		}
+
+		if err := pool.Schedule(func() {}); !errors.Is(err, workerpool.ErrPoolClosed) {
+			t.Errorf("Schedule = %v, want ErrPoolClosed", err)
+		}
+		if err := pool.ScheduleTimeout(time.Second, func() {}); !errors.Is(err, workerpool.ErrPoolClosed) {
+			t.Errorf("ScheduleTimeout = %v, want ErrPoolClosed", err)
+		}
+		if err := pool.TrySchedule(func() {}); !errors.Is(err, workerpool.ErrPoolClosed) {
+			t.Errorf("TrySchedule = %v, want ErrPoolClosed", err)
+		}
+	})
+}
+
+func TestShutdownUnblocksWaitingSchedule(t *testing.T) {
+	forEach(t, func(t *testing.T, pool workerpool.Pool) {
+		release := make(chan struct{})
+		var done sync.WaitGroup
+		saturate(t, pool, release, &done)
+
+		waiting := make(chan error, 1)
+		go func() { waiting <- pool.Schedule(func() {}) }()
+
+		// Give Schedule time to block, then shut down with running tasks stuck
+		time.Sleep(20 * time.Millisecond)
+		dropped, err := pool.Shutdown(within(t, 20*time.Millisecond))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Shutdown with stuck tasks = %v, want context.DeadlineExceeded", err)
+		}
+
+		// Dropped tasks never run
+		done.Add(-dropped)
+
+		select {
+		case err := <-waiting:
+			if err != nil && !errors.Is(err, workerpool.ErrPoolClosed) && !errors.Is(err, workerpool.ErrQueueFull) {
+				t.Errorf("blocked Schedule = %v, want ErrPoolClosed", err)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Schedule still blocked after Shutdown")
+		}
+
+		close(release)
+		done.Wait()
+	})
+}
+
+func TestShutdownCountsDroppedTasks(t *testing.T) {
+	forEach(t, func(t *testing.T, pool workerpool.Pool) {
+		release := make(chan struct{})
+		var done sync.WaitGroup
+		accepted := saturate(t, pool, release, &done)
+
+		// Every worker is stuck, so whatever is queued now can only be dropped
+		queued := pool.Stats().QueueDepth
+
+		dropped, err := pool.Shutdown(expired())
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Shutdown past its deadline = %v, want context.Canceled", err)
+		}
+		if dropped != queued {
+			t.Errorf("Shutdown dropped %d tasks, want the %d queued ones", dropped, queued)
+		}
+
+		// Tasks that were not dropped still run to completion
+		done.Add(-dropped)
+		close(release)
+
+		finished := make(chan struct{})
+		go func() {
+			done.Wait()
+			close(finished)
+		}()
+
+		select {
+		case <-finished:
+		case <-time.After(5 * time.Second):
+			t.Errorf("%d accepted tasks, %d dropped: the others never finished", accepted, dropped)
+		}
+	})
+}
+
+func TestStats(t *testing.T) {
+	forEach(t, func(t *testing.T, pool workerpool.Pool) {
+		release := make(chan struct{})
+		var done sync.WaitGroup
+		accepted := saturate(t, pool, release, &done)
+
+		stats := pool.Stats()
+		if stats.MaxWorkers != testWorkers {
+			t.Errorf("MaxWorkers = %d, want %d", stats.MaxWorkers, testWorkers)
+		}
+		if stats.ActiveWorkers != testWorkers {
+			t.Errorf("ActiveWorkers = %d, want %d", stats.ActiveWorkers, testWorkers)
+		}
+		if want := accepted - testWorkers; stats.QueueDepth > want {
+			t.Errorf("QueueDepth = %d, want at most %d", stats.QueueDepth, want)
+		}
+
+		close(release)
+		done.Wait()
+	})
+}
+
+func TestPanickingTaskKeepsPoolRunning(t *testing.T) {
+	forEach(t, func(t *testing.T, pool workerpool.Pool) {
+		for i := 0; i < testWorkers*2; i++ {
+			if err := pool.Schedule(func() { panic("task failed") }); err != nil {
+				t.Fatalf("Schedule: %v", err)
+			}
+		}
+
+		ran := make(chan struct{})
+		if err := pool.Schedule(func() { close(ran) }); err != nil {
+			t.Fatalf("Schedule: %v", err)
+		}
+
+		select {
+		case <-ran:
+		case <-time.After(5 * time.Second):
+			t.Fatal("task after panics never ran")
+		}
+	})
+}
+
+// BenchmarkSchedule measures the scheduling overhead per task, with tasks of increasing length.
+// Compare implementations with e.g. go test -run ^$ -bench Schedule -benchmem ./workerpool
+func BenchmarkSchedule(b *testing.B) {
+	workloads := []struct {
+		name string
+		task func()
+	}{
+		{"noop", func() {}},
+		{"cpu", func() { spin(2000) }},
+		{"io", func() { time.Sleep(50 * time.Microsecond) }},
+	}
+
+	workers := runtime.GOMAXPROCS(0) * 4
+
+	for _, impl := range implementations {
+		for _, workload := range workloads {
+			b.Run(fmt.Sprintf("%s/%s", impl.name, workload.name), func(b *testing.B) {
+				pool := impl.new(b, workers, workers*16)
+
+				var done sync.WaitGroup
+				done.Add(b.N)
+				task := func() {
+					workload.task()
+					done.Done()
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						if err := pool.Schedule(task); err != nil {
+							b.Error(err)
+							done.Done()
+						}
+					}
+				})
+
+				done.Wait()
+				b.StopTimer()
+				pool.Shutdown(context.Background())
+			})
+		}
+	}
+}
+
+// BenchmarkTrySchedule measures the cost of shedding load: the pool is kept saturated,
+// so almost every call returns ErrQueueFull.
+func BenchmarkTrySchedule(b *testing.B) {
+	for _, impl := range implementations {
+		b.Run(impl.name, func(b *testing.B) {
+			pool := impl.new(b, testWorkers, testQueueSize)
+			release := make(chan struct{})
+			for pool.TrySchedule(func() { <-release }) == nil {
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					pool.TrySchedule(func() {})
+				}
+			})
+
+			b.StopTimer()
+			close(release)
+			pool.Shutdown(context.Background())
+		})
+	}
+}
+
+var sink uint64
+
+// spin burns CPU for roughly n iterations.
+func spin(n int) {
+	x := uint64(1)
+	for i := 0; i < n; i++ {
+		x = x*6364136223846793005 + 1442695040888963407
+	}
+	atomic.AddUint64(&sink, x)
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	pools := map[string]func(policy workerpool.OverflowPolicy) workerpool.Pool{
+		"fixed": func(policy workerpool.OverflowPolicy) workerpool.Pool {
+			return fixed.NewPool(1, 2, 1, fixed.WithOverflowPolicy(policy))
+		},
+		"adaptive": func(policy workerpool.OverflowPolicy) workerpool.Pool {
+			return adaptive.NewPoolWithAutoScale(1, 0, 2, time.Second, adaptive.WithOverflowPolicy(policy))
+		},
+	}
+
+	// One worker stuck on the first task and two queued tasks, then one task too many.
+	// ran sums the values of the tasks that ran.
+	tests := []struct {
+		policy workerpool.OverflowPolicy
+		err    error
+		ran    int32
+	}{
+		{workerpool.Block, workerpool.ErrScheduleTimeout, 1 + 10 + 100},
+		{workerpool.Reject, workerpool.ErrQueueFull, 1 + 10 + 100},
+		{workerpool.DropOldest, nil, 1 + 100 + 1000},
+		{workerpool.CallerRuns, nil, 1 + 10 + 100 + 1000},
+	}
+
+	for name, newPool := range pools {
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("%s/%s", name, test.policy), func(t *testing.T) {
+				pool := newPool(test.policy)
+
+				var ran atomic.Int32
+				release := make(chan struct{})
+				started := make(chan struct{})
+
+				pool.Schedule(func() {
+					close(started)
+					<-release
+					ran.Add(1)
+				})
+				<-started
+				pool.Schedule(func() { ran.Add(10) })
+				pool.Schedule(func() { ran.Add(100) })
+
+				err := pool.ScheduleTimeout(10*time.Millisecond, func() { ran.Add(1000) })
+				if !errors.Is(err, test.err) {
+					t.Errorf("ScheduleTimeout on a full pool = %v, want %v", err, test.err)
+				}
+
+				close(release)
+				if _, err := pool.Shutdown(within(t, time.Second)); err != nil {
+					t.Fatalf("Shutdown: %v", err)
+				}
+				if got := ran.Load(); got != test.ran {
+					t.Errorf("tasks that ran add up to %d, want %d", got, test.ran)
+				}
+			})
+		}
+	}
+}
+
+func TestCallerRunsDoesNotHoldUpShutdown(t *testing.T) {
+	pools := map[string]func() workerpool.Pool{
+		"fixed": func() workerpool.Pool {
+			return fixed.NewPool(1, 1, 1, fixed.WithOverflowPolicy(workerpool.CallerRuns))
+		},
+		"adaptive": func() workerpool.Pool {
+			return adaptive.NewPoolWithAutoScale(1, 0, 1, time.Second, adaptive.WithOverflowPolicy(workerpool.CallerRuns))
+		},
+	}
+
+	for name, newPool := range pools {
+		t.Run(name, func(t *testing.T) {
+			pool := newPool()
+			release := make(chan struct{})
+			started := make(chan struct{})
+
+			pool.Schedule(func() { <-release })
+			for pool.Stats().ActiveWorkers == 0 || pool.Stats().QueueDepth > 0 {
+				time.Sleep(time.Millisecond)
+			}
+			pool.Schedule(func() { <-release })
+
+			// The pool is full, so the caller runs this one itself and hangs in it
+			go pool.Schedule(func() {
+				close(started)
+				<-release
+			})
+			<-started
+
+			begin := time.Now()
+			if _, err := pool.Shutdown(within(t, 20*time.Millisecond)); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Shutdown = %v, want context.DeadlineExceeded", err)
+			}
+			if elapsed := time.Since(begin); elapsed > time.Second {
+				t.Errorf("Shutdown took %s, want it to give up at its deadline", elapsed)
+			}
+
+			close(release)
+		})
+	}
+}
+
+func TestScheduleWithDeadline(t *testing.T) {
+	type deadlinePool interface {
+		workerpool.Pool
+		ScheduleWithDeadline(budget time.Duration, task workerpool.ContextTask) error
+	}
+
+	pools := map[string]func(onTimeout workerpool.TimeoutHandler) deadlinePool{
+		"fixed": func(onTimeout workerpool.TimeoutHandler) deadlinePool {
+			return fixed.NewPool(1, 1, 1, fixed.WithTimeoutHandler(onTimeout))
+		},
+		"adaptive": func(onTimeout workerpool.TimeoutHandler) deadlinePool {
+			return adaptive.NewPoolWithAutoScale(1, 0, 1, time.Second, adaptive.WithTimeoutHandler(onTimeout))
+		},
+	}
+
+	for name, newPool := range pools {
+		t.Run(name, func(t *testing.T) {
+			timedOut := make(chan time.Duration, 1)
+			pool := newPool(func(budget, _ time.Duration) { timedOut <- budget })
+			defer pool.Shutdown(context.Background())
+
+			release := make(chan struct{})
+			cancelled := make(chan error, 1)
+			pool.ScheduleWithDeadline(10*time.Millisecond, func(ctx context.Context) {
+				<-ctx.Done()
+				cancelled <- ctx.Err()
+				<-release // Keeps running past its budget
+			})
+
+			if err := <-cancelled; !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("task context: err = %v, want context.DeadlineExceeded", err)
+			}
+
+			// The handler fires while the task is still running
+			select {
+			case budget := <-timedOut:
+				if budget != 10*time.Millisecond {
+					t.Errorf("budget = %s, want 10ms", budget)
+				}
+			case <-time.After(time.Second):
+				t.Error("timeout handler not called")
+			}
+			close(release)
+
+			// Without a budget the task is only bounded by the pool
+			done := make(chan error, 1)
+			pool.ScheduleWithDeadline(0, func(ctx context.Context) {
+				_, bounded := ctx.Deadline()
+				if bounded {
+					done <- errors.New("context has a deadline")
+					return
+				}
+				done <- ctx.Err()
+			})
+			if err := <-done; err != nil {
+				t.Errorf("unbounded task: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	for _, policy := range []workerpool.OverflowPolicy{workerpool.Block, workerpool.Reject, workerpool.DropOldest, workerpool.CallerRuns} {
+		if got, err := workerpool.ParseOverflowPolicy(policy.String()); err != nil || got != policy {
+			t.Errorf("ParseOverflowPolicy(%q) = %v, %v; want %v", policy.String(), got, err, policy)
+		}
+	}
+
+	if _, err := workerpool.ParseOverflowPolicy("spill"); err == nil {
+		t.Error("ParseOverflowPolicy accepted an unknown policy")
+	}
+}
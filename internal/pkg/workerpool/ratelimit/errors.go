@@ -0,0 +1,10 @@
+package ratelimit
+
+import (
+	"fmt"
+	"pkg/workerpool"
+)
+
+// ErrRateLimited is returned by TrySchedule and TryScheduleKey when no token is available right away.
+// It wraps workerpool.ErrQueueFull, so callers shedding load on a full pool shed rate-limited tasks too.
+var ErrRateLimited = fmt.Errorf("rate limited: %w", workerpool.ErrQueueFull)
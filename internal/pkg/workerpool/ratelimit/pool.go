@@ -0,0 +1,289 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"pkg/workerpool"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limit is a token bucket: Rate tasks per second on average, up to Burst at once.
+type Limit struct {
+	Rate  float64 `mapstructure:"rate"`  // Tasks per second, 0 for no limit
+	Burst int     `mapstructure:"burst"` // Tasks allowed at once (default the rate rounded up, at least 1)
+}
+
+// limiter returns a limiter enforcing the limit, nil if the limit is disabled.
+func (l Limit) limiter() *rate.Limiter {
+	if l.Rate <= 0 {
+		return nil
+	}
+
+	burst := l.Burst
+	if burst <= 0 {
+		burst = max(int(math.Ceil(l.Rate)), 1)
+	}
+
+	return rate.NewLimiter(rate.Limit(l.Rate), burst)
+}
+
+// Config holds the limits of a rate-limited pool.
+type Config struct {
+	Global Limit            `mapstructure:"global"` // Limit shared by every task
+	PerKey Limit            `mapstructure:"perKey"` // Limit of each key without an entry in Keys
+	Keys   map[string]Limit `mapstructure:"keys"`   // Limits of specific keys, e.g. per gRPC method
+}
+
+type token = struct{}
+
+// sweepThreshold is the number of key limiters above which idle ones are dropped.
+const sweepThreshold = 1024
+
+/**
+ * Pool throttles the tasks scheduled onto another pool with token buckets: one shared by all tasks
+ * and, for tasks scheduled with a key, one per key.
+ *
+ * 	identity := ratelimit.New(pool, &ratelimit.Config{
+ * 		Global: ratelimit.Limit{Rate: 100},
+ * 		PerKey: ratelimit.Limit{Rate: 20, Burst: 5},
+ * 	})
+ * 	identity.ScheduleKey("GetUser", func() { ... })
+ *
+ * Scheduling waits for tokens in the calling goroutine, before the task is handed to the pool,
+ * so throttled tasks never hold a worker. The tokens of a task that can't be admitted, whether by
+ * the limiters or by the underlying pool, are returned.
+ */
+type Pool struct {
+	pool   workerpool.Pool
+	conf   *Config
+	global *rate.Limiter // nil when the global limit is disabled
+
+	mutex sync.Mutex
+	keys  map[string]*rate.Limiter // Limiters of the keys seen so far, nil entries for unlimited keys
+
+	closing   chan token // Closed by Shutdown, wakes up callers waiting for tokens
+	closeOnce sync.Once
+}
+
+// New creates a pool scheduling onto pool under the limits of conf.
+func New(pool workerpool.Pool, conf *Config) *Pool {
+	return &Pool{
+		pool:    pool,
+		conf:    conf,
+		global:  conf.Global.limiter(),
+		keys:    make(map[string]*rate.Limiter),
+		closing: make(chan token),
+	}
+}
+
+// Schedule waits for a global token, then schedules the task.
+func (p *Pool) Schedule(task func()) error {
+	return p.ScheduleKey("", task)
+}
+
+// ScheduleTimeout is Schedule giving up with ErrScheduleTimeout once timeout has passed,
+// whether waiting for a token or for room in the pool.
+func (p *Pool) ScheduleTimeout(timeout time.Duration, task func()) error {
+	return p.ScheduleKeyTimeout("", timeout, task)
+}
+
+// TrySchedule schedules the task only if a global token is available right away.
+// It never blocks and returns ErrRateLimited if there is no token.
+func (p *Pool) TrySchedule(task func()) error {
+	return p.TryScheduleKey("", task)
+}
+
+// ScheduleKey waits for a global token and a token of key, then schedules the task.
+// An empty key is only subject to the global limit.
+func (p *Pool) ScheduleKey(key string, task func()) error {
+	refund, err := p.acquire(key, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	return refundOnError(refund, p.pool.Schedule(task))
+}
+
+// ScheduleKeyTimeout is ScheduleKey giving up with ErrScheduleTimeout once timeout has passed.
+// It fails right away if the tokens won't be available in time.
+func (p *Pool) ScheduleKeyTimeout(key string, timeout time.Duration, task func()) error {
+	deadline := time.Now().Add(timeout)
+	refund, err := p.acquire(key, deadline)
+	if err != nil {
+		return err
+	}
+
+	return refundOnError(refund, p.pool.ScheduleTimeout(time.Until(deadline), task))
+}
+
+// TryScheduleKey schedules the task only if a global token and a token of key are available right away.
+// It never blocks and returns ErrRateLimited if either is missing.
+func (p *Pool) TryScheduleKey(key string, task func()) error {
+	refund, err := p.tryAcquire(key)
+	if err != nil {
+		return err
+	}
+
+	return refundOnError(refund, p.pool.TrySchedule(task))
+}
+
+// Stats returns the stats of the underlying pool.
+func (p *Pool) Stats() workerpool.Stats {
+	return p.pool.Stats()
+}
+
+// Shutdown wakes up callers waiting for tokens with ErrPoolClosed and shuts the underlying pool down.
+func (p *Pool) Shutdown(ctx context.Context) (int, error) {
+	p.closeOnce.Do(func() { close(p.closing) })
+
+	return p.pool.Shutdown(ctx)
+}
+
+// acquire takes a token from every limiter of key, waiting until they are available
+// or until deadline, unless it is zero. The returned refund gives the tokens back.
+func (p *Pool) acquire(key string, deadline time.Time) (refund func(), err error) {
+	now := time.Now()
+
+	reservations, delay, err := p.reserve(key, now)
+	if err != nil {
+		return nil, err
+	}
+
+	refund = func() { giveBack(reservations, now) }
+	if delay == 0 {
+		return refund, nil
+	}
+
+	if !deadline.IsZero() && now.Add(delay).After(deadline) {
+		// The tokens won't be there in time, leave them to others
+		cancel(reservations, now)
+		return nil, workerpool.ErrScheduleTimeout
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return refund, nil
+	case <-p.closing:
+		cancel(reservations, time.Now())
+		return nil, workerpool.ErrPoolClosed
+	}
+}
+
+// tryAcquire takes a token from every limiter of key if they all have one right away.
+// The returned refund gives the tokens back.
+func (p *Pool) tryAcquire(key string) (refund func(), err error) {
+	now := time.Now()
+
+	reservations, delay, err := p.reserve(key, now)
+	if err != nil {
+		return nil, err
+	}
+	if delay > 0 {
+		cancel(reservations, now)
+		return nil, ErrRateLimited
+	}
+
+	return func() { giveBack(reservations, now) }, nil
+}
+
+// reserve reserves a token from every limiter of key and returns how long the caller has to wait for them.
+func (p *Pool) reserve(key string, now time.Time) ([]*rate.Reservation, time.Duration, error) {
+	select {
+	case <-p.closing:
+		return nil, 0, workerpool.ErrPoolClosed
+	default:
+	}
+
+	var (
+		reservations = make([]*rate.Reservation, 0, 2)
+		delay        time.Duration
+	)
+
+	for _, limiter := range []*rate.Limiter{p.global, p.limiter(key)} {
+		if limiter == nil {
+			continue
+		}
+
+		reservation := limiter.ReserveN(now, 1)
+		if !reservation.OK() {
+			cancel(reservations, now)
+			return nil, 0, ErrRateLimited
+		}
+
+		reservations = append(reservations, reservation)
+		delay = max(delay, reservation.DelayFrom(now))
+	}
+
+	return reservations, delay, nil
+}
+
+// limiter returns the limiter of key, creating it on first use. It returns nil if key isn't limited.
+func (p *Pool) limiter(key string) *rate.Limiter {
+	if key == "" {
+		return nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if limiter, ok := p.keys[key]; ok {
+		return limiter
+	}
+
+	if len(p.keys) >= sweepThreshold {
+		p.sweep()
+	}
+
+	limit, ok := p.conf.Keys[key]
+	if !ok {
+		limit = p.conf.PerKey
+	}
+
+	limiter := limit.limiter()
+	p.keys[key] = limiter
+	return limiter
+}
+
+// sweep drops the limiters whose bucket is full again: a new limiter would behave the same.
+// Must be called with the mutex held.
+func (p *Pool) sweep() {
+	now := time.Now()
+	for key, limiter := range p.keys {
+		if limiter == nil || limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(p.keys, key)
+		}
+	}
+}
+
+// cancel returns the tokens of reservations that won't be used.
+func cancel(reservations []*rate.Reservation, now time.Time) {
+	for _, reservation := range reservations {
+		reservation.CancelAt(now)
+	}
+}
+
+// giveBack returns the tokens of reservations made at reservedAt, after they became available.
+// rate only cancels reservations that are not due yet, so each one is cancelled as of the moment
+// its token became available. Refill that happened since may be granted twice, never beyond the burst.
+func giveBack(reservations []*rate.Reservation, reservedAt time.Time) {
+	for _, reservation := range reservations {
+		reservation.CancelAt(reservedAt.Add(reservation.DelayFrom(reservedAt)))
+	}
+}
+
+// refundOnError gives the tokens of a task back if the underlying pool rejected it, and returns err.
+func refundOnError(refund func(), err error) error {
+	if err != nil {
+		refund()
+	}
+
+	return err
+}
+
+var _ workerpool.Pool = (*Pool)(nil)
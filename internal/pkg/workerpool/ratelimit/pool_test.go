@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"pkg/workerpool"
+	"testing"
+	"time"
+)
+
+// rejectingPool turns down every task with err until err is cleared.
+type rejectingPool struct {
+	err error
+}
+
+func (p *rejectingPool) Schedule(task func()) error {
+	if p.err != nil {
+		return p.err
+	}
+	task()
+	return nil
+}
+
+func (p *rejectingPool) ScheduleTimeout(_ time.Duration, task func()) error { return p.Schedule(task) }
+func (p *rejectingPool) TrySchedule(task func()) error                      { return p.Schedule(task) }
+func (p *rejectingPool) Stats() workerpool.Stats                            { return workerpool.Stats{} }
+func (p *rejectingPool) Shutdown(context.Context) (int, error)              { return 0, nil }
+
+func TestRejectedTasksGiveTheirTokensBack(t *testing.T) {
+	schedules := map[string]func(p *Pool, task func()) error{
+		"Schedule":        func(p *Pool, task func()) error { return p.ScheduleKey("key", task) },
+		"ScheduleTimeout": func(p *Pool, task func()) error { return p.ScheduleKeyTimeout("key", time.Second, task) },
+		"TrySchedule":     func(p *Pool, task func()) error { return p.TryScheduleKey("key", task) },
+	}
+
+	for name, schedule := range schedules {
+		t.Run(name, func(t *testing.T) {
+			inner := &rejectingPool{err: workerpool.ErrQueueFull}
+			pool := New(inner, &Config{
+				Global: Limit{Rate: 0.001, Burst: 1},
+				PerKey: Limit{Rate: 0.001, Burst: 1},
+			})
+
+			for range 3 {
+				if err := schedule(pool, func() {}); !errors.Is(err, workerpool.ErrQueueFull) {
+					t.Fatalf("schedule on a full pool: err = %v, want ErrQueueFull", err)
+				}
+			}
+
+			// With a token every 1000s, only a returned token lets the next task through
+			inner.err = nil
+			if err := pool.TryScheduleKey("key", func() {}); err != nil {
+				t.Fatalf("TryScheduleKey after rejections: %v, want the tokens to be back", err)
+			}
+			if err := pool.TryScheduleKey("key", func() {}); !errors.Is(err, ErrRateLimited) {
+				t.Fatalf("second TryScheduleKey: err = %v, want ErrRateLimited", err)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	pool := New(&rejectingPool{}, &Config{
+		Global: Limit{Rate: 1, Burst: 3},
+		PerKey: Limit{Rate: 1, Burst: 1},
+		Keys:   map[string]Limit{"unlimited": {}},
+	})
+
+	if err := pool.TryScheduleKey("a", func() {}); err != nil {
+		t.Fatalf("first task of a key: %v", err)
+	}
+	if err := pool.TryScheduleKey("a", func() {}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("second task of a key = %v, want %v", err, ErrRateLimited)
+	}
+	if !errors.Is(ErrRateLimited, workerpool.ErrQueueFull) {
+		t.Error("ErrRateLimited is not an ErrQueueFull")
+	}
+
+	// The denied task gave its global token back, two are left
+	if err := pool.TryScheduleKey("b", func() {}); err != nil {
+		t.Errorf("first task of another key: %v", err)
+	}
+	if err := pool.TryScheduleKey("unlimited", func() {}); err != nil {
+		t.Errorf("task of a key without limit: %v", err)
+	}
+	if err := pool.TrySchedule(func() {}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("task over the global limit = %v, want %v", err, ErrRateLimited)
+	}
+
+	// The next token comes in a second
+	if err := pool.ScheduleTimeout(10*time.Millisecond, func() {}); !errors.Is(err, workerpool.ErrScheduleTimeout) {
+		t.Errorf("ScheduleTimeout shorter than the wait = %v, want %v", err, workerpool.ErrScheduleTimeout)
+	}
+
+	start := time.Now()
+	if err := pool.Schedule(func() {}); err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+	if waited := time.Since(start); waited < 500*time.Millisecond {
+		t.Errorf("Schedule waited %v for a token, want about a second", waited)
+	}
+
+	waiting := make(chan error)
+	go func() { waiting <- pool.Schedule(func() {}) }()
+	time.Sleep(10 * time.Millisecond)
+	pool.Shutdown(context.Background())
+
+	select {
+	case err := <-waiting:
+		if !errors.Is(err, workerpool.ErrPoolClosed) {
+			t.Errorf("Schedule waiting for a token on Shutdown = %v, want %v", err, workerpool.ErrPoolClosed)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Error("Shutdown did not wake up Schedule waiting for a token")
+	}
+}
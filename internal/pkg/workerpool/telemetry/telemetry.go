@@ -0,0 +1,184 @@
+package telemetry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Rejection reasons reported on the rejected submissions counter.
+const (
+	ReasonClosed      = "closed"       // The pool is shutting down
+	ReasonTimeout     = "timeout"      // The queue stayed full until the schedule timeout
+	ReasonCircuitOpen = "circuit_open" // The circuit breaker rejected the task
+	ReasonQueueFull   = "queue_full"   // The queue was full and the task wasn't allowed to wait for room
+	ReasonDropped     = "dropped"      // A queued task was discarded to make room for a newer one
+)
+
+/**
+ * Metrics exports the state of a worker pool through OpenTelemetry.
+ *
+ * Instruments, all labelled with the pool name:
+ *
+ * 	workerpool.queue.depth      gauge      tasks waiting in the queue
+ * 	workerpool.workers.active   gauge      running workers
+ * 	workerpool.task.duration    histogram  task execution time in seconds, by status (ok, error, panic)
+ * 	workerpool.task.failures    counter    failed tasks, by kind (error, panic)
+ * 	workerpool.task.rejected    counter    rejected submissions, by reason
+ * 	workerpool.workers.scaled   counter    workers started and stopped, by direction (up, down)
+ *
+ * A nil *Metrics is valid and records nothing, so pools can call it unconditionally.
+ */
+type Metrics struct {
+	meter    metric.Meter
+	pool     attribute.KeyValue
+	duration metric.Float64Histogram
+	failures metric.Int64Counter
+	rejected metric.Int64Counter
+	scaled   metric.Int64Counter
+
+	registration metric.Registration // Gauge callback, nil until Observe is called
+	closeOnce    sync.Once
+}
+
+// New creates the pool instruments on meter, labelled with the given pool name.
+// Instrument creation errors are reported to the global OpenTelemetry error handler;
+// the affected instruments fall back to no-ops.
+func New(meter metric.Meter, name string) *Metrics {
+	m := &Metrics{
+		meter: meter,
+		pool:  attribute.String("pool", name),
+	}
+
+	var err error
+	m.duration, err = meter.Float64Histogram("workerpool.task.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Task execution time"),
+		metric.WithExplicitBucketBoundaries(0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30),
+	)
+	handle(err)
+
+	m.failures, err = meter.Int64Counter("workerpool.task.failures",
+		metric.WithUnit("{task}"),
+		metric.WithDescription("Tasks that returned an error or panicked"),
+	)
+	handle(err)
+
+	m.rejected, err = meter.Int64Counter("workerpool.task.rejected",
+		metric.WithUnit("{task}"),
+		metric.WithDescription("Task submissions rejected by the pool"),
+	)
+	handle(err)
+
+	m.scaled, err = meter.Int64Counter("workerpool.workers.scaled",
+		metric.WithUnit("{worker}"),
+		metric.WithDescription("Workers started (up) and stopped (down)"),
+	)
+	handle(err)
+
+	return m
+}
+
+// Observe registers the queue depth and active workers gauges.
+// The functions are called on every collection and must be safe for concurrent use.
+func (m *Metrics) Observe(queueDepth, activeWorkers func() int) {
+	if m == nil {
+		return
+	}
+
+	depth, err := m.meter.Int64ObservableGauge("workerpool.queue.depth",
+		metric.WithUnit("{task}"),
+		metric.WithDescription("Tasks waiting in the queue"),
+	)
+	handle(err)
+
+	active, err := m.meter.Int64ObservableGauge("workerpool.workers.active",
+		metric.WithUnit("{worker}"),
+		metric.WithDescription("Running workers"),
+	)
+	handle(err)
+
+	attrs := metric.WithAttributes(m.pool)
+	m.registration, err = m.meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(depth, int64(queueDepth()), attrs)
+		o.ObserveInt64(active, int64(activeWorkers()), attrs)
+		return nil
+	}, depth, active)
+	handle(err)
+}
+
+// TaskDone records a task that returned err after starting at start.
+func (m *Metrics) TaskDone(ctx context.Context, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+		m.failures.Add(ctx, 1, metric.WithAttributes(m.pool, attribute.String("kind", "error")))
+	}
+
+	m.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(m.pool, attribute.String("status", status)))
+}
+
+// TaskPanicked records a task that panicked after starting at start.
+func (m *Metrics) TaskPanicked(ctx context.Context, start time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.failures.Add(ctx, 1, metric.WithAttributes(m.pool, attribute.String("kind", "panic")))
+	m.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(m.pool, attribute.String("status", "panic")))
+}
+
+// Rejected records a submission the pool turned down for the given reason.
+func (m *Metrics) Rejected(ctx context.Context, reason string) {
+	if m == nil {
+		return
+	}
+
+	m.rejected.Add(ctx, 1, metric.WithAttributes(m.pool, attribute.String("reason", reason)))
+}
+
+// ScaledUp records a started worker.
+func (m *Metrics) ScaledUp(ctx context.Context) {
+	if m == nil {
+		return
+	}
+
+	m.scaled.Add(ctx, 1, metric.WithAttributes(m.pool, attribute.String("direction", "up")))
+}
+
+// ScaledDown records a stopped worker.
+func (m *Metrics) ScaledDown(ctx context.Context) {
+	if m == nil {
+		return
+	}
+
+	m.scaled.Add(ctx, 1, metric.WithAttributes(m.pool, attribute.String("direction", "down")))
+}
+
+// Close unregisters the gauges, so a shut down pool is no longer observed.
+func (m *Metrics) Close() {
+	if m == nil {
+		return
+	}
+
+	m.closeOnce.Do(func() {
+		if m.registration != nil {
+			handle(m.registration.Unregister())
+		}
+	})
+}
+
+// handle reports instrument errors to the global OpenTelemetry error handler.
+func handle(err error) {
+	if err != nil {
+		otel.Handle(err)
+	}
+}
@@ -0,0 +1,172 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// newMetrics returns Metrics for the pool "test" recording into an in-memory reader.
+func newMetrics(t *testing.T) (*Metrics, *sdkmetric.ManualReader) {
+	t.Helper()
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	return New(provider.Meter("test"), "test"), reader
+}
+
+// collect reads every instrument of reader, keyed by name.
+func collect(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Aggregation {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	instruments := map[string]metricdata.Aggregation{}
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			instruments[m.Name] = m.Data
+		}
+	}
+
+	return instruments
+}
+
+// byAttribute returns the value of every data point of an int64 sum or gauge, keyed by the value of key.
+// Every data point must carry the pool name.
+func byAttribute(t *testing.T, data metricdata.Aggregation, key attribute.Key) map[string]int64 {
+	t.Helper()
+
+	var points []metricdata.DataPoint[int64]
+	switch data := data.(type) {
+	case metricdata.Sum[int64]:
+		points = data.DataPoints
+	case metricdata.Gauge[int64]:
+		points = data.DataPoints
+	default:
+		t.Fatalf("aggregation %T, want an int64 sum or gauge", data)
+	}
+
+	values := map[string]int64{}
+	for _, point := range points {
+		if pool, _ := point.Attributes.Value("pool"); pool.AsString() != "test" {
+			t.Errorf("data point %v isn't labelled with the pool name", point.Attributes.ToSlice())
+		}
+		value, _ := point.Attributes.Value(key)
+		values[value.AsString()] = point.Value
+	}
+
+	return values
+}
+
+func TestMetricsRecordsTaskOutcomes(t *testing.T) {
+	metrics, reader := newMetrics(t)
+	ctx := context.Background()
+	start := time.Now().Add(-time.Second)
+
+	metrics.TaskDone(ctx, start, nil)
+	metrics.TaskDone(ctx, start, nil)
+	metrics.TaskDone(ctx, start, errors.New("failed"))
+	metrics.TaskPanicked(ctx, start)
+
+	instruments := collect(t, reader)
+
+	failures := byAttribute(t, instruments["workerpool.task.failures"], "kind")
+	if len(failures) != 2 || failures["error"] != 1 || failures["panic"] != 1 {
+		t.Errorf("failures = %v, want 1 error and 1 panic", failures)
+	}
+
+	duration, ok := instruments["workerpool.task.duration"].(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatalf("duration is %T, want a float64 histogram", instruments["workerpool.task.duration"])
+	}
+
+	counts := map[string]uint64{}
+	for _, point := range duration.DataPoints {
+		status, _ := point.Attributes.Value("status")
+		counts[status.AsString()] = point.Count
+
+		if point.Sum < float64(point.Count) {
+			t.Errorf("%s tasks took %vs in total, want at least a second each", status.AsString(), point.Sum)
+		}
+	}
+	if len(counts) != 3 || counts["ok"] != 2 || counts["error"] != 1 || counts["panic"] != 1 {
+		t.Errorf("durations recorded = %v, want 2 ok, 1 error and 1 panic", counts)
+	}
+}
+
+func TestMetricsRecordsRejectionsAndScaling(t *testing.T) {
+	metrics, reader := newMetrics(t)
+	ctx := context.Background()
+
+	metrics.Rejected(ctx, ReasonQueueFull)
+	metrics.Rejected(ctx, ReasonQueueFull)
+	metrics.Rejected(ctx, ReasonClosed)
+	metrics.ScaledUp(ctx)
+	metrics.ScaledUp(ctx)
+	metrics.ScaledDown(ctx)
+
+	instruments := collect(t, reader)
+
+	rejected := byAttribute(t, instruments["workerpool.task.rejected"], "reason")
+	if len(rejected) != 2 || rejected[ReasonQueueFull] != 2 || rejected[ReasonClosed] != 1 {
+		t.Errorf("rejected = %v, want 2 queue_full and 1 closed", rejected)
+	}
+
+	scaled := byAttribute(t, instruments["workerpool.workers.scaled"], "direction")
+	if len(scaled) != 2 || scaled["up"] != 2 || scaled["down"] != 1 {
+		t.Errorf("scaled = %v, want 2 up and 1 down", scaled)
+	}
+}
+
+func TestObserveReportsGaugesUntilClose(t *testing.T) {
+	metrics, reader := newMetrics(t)
+
+	depth, active := 3, 2
+	metrics.Observe(func() int { return depth }, func() int { return active })
+
+	instruments := collect(t, reader)
+	if got := byAttribute(t, instruments["workerpool.queue.depth"], "pool"); got["test"] != 3 {
+		t.Errorf("queue depth = %v, want 3", got)
+	}
+	if got := byAttribute(t, instruments["workerpool.workers.active"], "pool"); got["test"] != 2 {
+		t.Errorf("active workers = %v, want 2", got)
+	}
+
+	// Every collection calls the functions again
+	depth = 5
+	instruments = collect(t, reader)
+	if got := byAttribute(t, instruments["workerpool.queue.depth"], "pool"); got["test"] != 5 {
+		t.Errorf("queue depth = %v after a change, want 5", got)
+	}
+
+	metrics.Close()
+	metrics.Close()
+
+	instruments = collect(t, reader)
+	if gauge, ok := instruments["workerpool.queue.depth"].(metricdata.Gauge[int64]); ok && len(gauge.DataPoints) != 0 {
+		t.Errorf("queue depth still observed after Close: %v", gauge.DataPoints)
+	}
+}
+
+func TestNilMetricsRecordsNothing(t *testing.T) {
+	var metrics *Metrics
+	ctx := context.Background()
+
+	metrics.Observe(func() int { return 0 }, func() int { return 0 })
+	metrics.TaskDone(ctx, time.Now(), nil)
+	metrics.TaskPanicked(ctx, time.Now())
+	metrics.Rejected(ctx, ReasonClosed)
+	metrics.ScaledUp(ctx)
+	metrics.ScaledDown(ctx)
+	metrics.Close()
+}
@@ -0,0 +1,26 @@
+package workerpool
+
+import (
+	"sync"
+	"time"
+)
+
+// timers recycles the timers of ScheduleTimeout, so scheduling with a timeout doesn't allocate.
+var timers sync.Pool
+
+// acquireTimer returns a timer firing after d.
+func acquireTimer(d time.Duration) *time.Timer {
+	if timer, ok := timers.Get().(*time.Timer); ok {
+		timer.Reset(d)
+		return timer
+	}
+
+	return time.NewTimer(d)
+}
+
+// releaseTimer stops the timer and makes it available for reuse.
+// Since Go 1.23 a stopped timer's channel never delivers a stale value, so no draining is needed.
+func releaseTimer(timer *time.Timer) {
+	timer.Stop()
+	timers.Put(timer)
+}
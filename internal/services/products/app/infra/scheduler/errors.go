@@ -0,0 +1,8 @@
+package scheduler
+
+import "errors"
+
+var (
+	ErrDuplicateJob = errors.New("job already registered")
+	ErrJobNotFound  = errors.New("job not found")
+)
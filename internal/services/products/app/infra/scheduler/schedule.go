@@ -0,0 +1,68 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule decides when a job runs.
+type Schedule interface {
+	// Next returns the first activation strictly after t, or the zero time if there is none.
+	Next(t time.Time) time.Time
+	// String describes the schedule for job listings.
+	String() string
+}
+
+// onceSchedule activates a single time.
+type onceSchedule struct {
+	at time.Time
+}
+
+func (s onceSchedule) Next(t time.Time) time.Time {
+	if s.at.After(t) {
+		return s.at
+	}
+	return time.Time{}
+}
+
+func (s onceSchedule) String() string {
+	return "at " + s.at.Format(time.RFC3339)
+}
+
+// cronSchedule activates according to a cron expression.
+type cronSchedule struct {
+	expr     string
+	schedule cron.Schedule
+}
+
+func (s cronSchedule) Next(t time.Time) time.Time {
+	return s.schedule.Next(t)
+}
+
+func (s cronSchedule) String() string {
+	return "cron " + s.expr
+}
+
+// At returns a schedule that activates once at t.
+func At(t time.Time) Schedule {
+	return onceSchedule{at: t}
+}
+
+// After returns a schedule that activates once, d from now.
+func After(d time.Duration) Schedule {
+	return onceSchedule{at: time.Now().Add(d)}
+}
+
+// Cron parses a standard five-field cron expression ("minute hour day month weekday"),
+// or a descriptor such as "@daily" or "@every 90s". Expressions are evaluated in local time
+// unless prefixed with "CRON_TZ=<zone> ".
+func Cron(expr string) (Schedule, error) {
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+
+	return cronSchedule{expr: expr, schedule: schedule}, nil
+}
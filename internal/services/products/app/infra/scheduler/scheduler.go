@@ -0,0 +1,354 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"pkg/logger"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Job is the work run by the scheduler.
+// The context is cancelled when the scheduler is stopped and its deadline passes.
+type Job func(ctx context.Context) error
+
+// Executor runs dispatched jobs, e.g. a fixed or adaptive worker pool.
+type Executor interface {
+	Schedule(task func()) error
+}
+
+// JobInfo is a snapshot of a registered job.
+type JobInfo struct {
+	Name         string
+	Schedule     string
+	NextRun      time.Time // Zero once a one-off job has fired
+	LastRun      time.Time // Zero until the job first runs
+	LastDuration time.Duration
+	LastErr      error
+	Running      bool
+	Runs         int // Completed runs
+	Skipped      int // Activations skipped because the previous run was still going
+}
+
+type token = struct{}
+
+// entry is a registered job with its bookkeeping.
+type entry struct {
+	name         string
+	job          Job
+	schedule     Schedule
+	next         time.Time
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastErr      error
+	running      bool
+	runs         int
+	skipped      int
+}
+
+/**
+ * Scheduler runs jobs at a given time, after a delay or on a cron schedule.
+ *
+ * A single loop sleeps until the earliest activation and hands due jobs to the executor.
+ * A job is never run concurrently with itself: an activation that comes up while the
+ * previous run is still going is skipped and counted. Missed activations are not caught up.
+ */
+type Scheduler struct {
+	executor Executor
+	log      logger.Zapper
+	clock    Clock
+
+	mutex   sync.Mutex
+	jobs    map[string]*entry
+	wake    chan token // Interrupts the loop's sleep when jobs change
+	running sync.WaitGroup
+
+	ctx       context.Context    // Context handed to jobs
+	cancel    context.CancelFunc // Cancels ctx
+	stop      chan token         // Closed to stop the loop
+	loopDone  chan token         // Closed when the loop has returned
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// Option configures optional behaviour of the scheduler.
+type Option func(*Scheduler)
+
+// WithClock makes the scheduler tell the time and sleep with clock instead of the system clock.
+func WithClock(clock Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = clock
+	}
+}
+
+// New creates a scheduler dispatching jobs onto executor. Call Start to begin dispatching.
+func New(executor Executor, log logger.Zapper, opts ...Option) *Scheduler {
+	s := &Scheduler{
+		executor: executor,
+		log:      log,
+		clock:    systemClock{},
+		jobs:     make(map[string]*entry),
+		wake:     make(chan token, 1),
+		stop:     make(chan token),
+		loopDone: make(chan token),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Add registers a job under a unique name.
+func (s *Scheduler) Add(name string, schedule Schedule, job Job) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateJob, name)
+	}
+
+	s.jobs[name] = &entry{
+		name:     name,
+		job:      job,
+		schedule: schedule,
+		next:     schedule.Next(s.clock.Now()),
+	}
+
+	s.notify()
+	return nil
+}
+
+// RunAt registers a job that runs once at t.
+func (s *Scheduler) RunAt(name string, t time.Time, job Job) error {
+	return s.Add(name, At(t), job)
+}
+
+// RunAfter registers a job that runs once, d from now.
+func (s *Scheduler) RunAfter(name string, d time.Duration, job Job) error {
+	return s.Add(name, At(s.clock.Now().Add(d)), job)
+}
+
+// Cron registers a job that runs according to a cron expression, see Cron.
+func (s *Scheduler) Cron(name, expr string, job Job) error {
+	schedule, err := Cron(expr)
+	if err != nil {
+		return err
+	}
+
+	return s.Add(name, schedule, job)
+}
+
+// Remove unregisters a job. A run in progress is not interrupted.
+func (s *Scheduler) Remove(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.jobs[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+
+	delete(s.jobs, name)
+	s.notify()
+	return nil
+}
+
+// Job returns a snapshot of the job registered under name.
+func (s *Scheduler) Job(name string) (JobInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, ok := s.jobs[name]
+	if !ok {
+		return JobInfo{}, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+
+	return e.info(), nil
+}
+
+// Jobs returns a snapshot of every registered job, sorted by name.
+func (s *Scheduler) Jobs() []JobInfo {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	infos := make([]JobInfo, 0, len(s.jobs))
+	for _, e := range s.jobs {
+		infos = append(infos, e.info())
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// info returns a snapshot of the entry. Must be called with the mutex held.
+func (e *entry) info() JobInfo {
+	return JobInfo{
+		Name:         e.name,
+		Schedule:     e.schedule.String(),
+		NextRun:      e.next,
+		LastRun:      e.lastRun,
+		LastDuration: e.lastDuration,
+		LastErr:      e.lastErr,
+		Running:      e.running,
+		Runs:         e.runs,
+		Skipped:      e.skipped,
+	}
+}
+
+// Start begins dispatching due jobs. Jobs receive a context derived from ctx.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.startOnce.Do(func() {
+		s.ctx, s.cancel = context.WithCancel(ctx)
+		go s.loop()
+	})
+}
+
+// Stop stops dispatching and waits for running jobs to finish.
+// If ctx is done first, the jobs' context is cancelled and ctx.Err() is returned.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+
+	// Keep a later Start from running, then find out whether the loop ever ran
+	s.startOnce.Do(func() {})
+	if s.cancel == nil {
+		return nil
+	}
+
+	finished := make(chan token)
+	go func() {
+		<-s.loopDone
+		s.running.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		return ctx.Err()
+	}
+}
+
+// notify wakes up the loop so it recomputes its next activation.
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- token{}:
+	default:
+	}
+}
+
+// loop sleeps until the earliest activation and dispatches the jobs that are due.
+func (s *Scheduler) loop() {
+	defer close(s.loopDone)
+
+	timer := s.clock.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		due, next := s.due(s.clock.Now())
+		for _, e := range due {
+			s.dispatch(e)
+		}
+
+		wait := time.Hour
+		if !next.IsZero() {
+			wait = next.Sub(s.clock.Now())
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-timer.C():
+		case <-s.wake:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// due marks the jobs that are due at now as running and advances every due job to its
+// next activation. It returns the jobs to dispatch and the earliest upcoming activation.
+func (s *Scheduler) due(now time.Time) ([]*entry, time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var (
+		due  []*entry
+		next time.Time
+	)
+
+	for _, e := range s.jobs {
+		if !e.next.IsZero() && !e.next.After(now) {
+			if e.running {
+				e.skipped++
+			} else {
+				e.running = true
+				due = append(due, e)
+			}
+			e.next = e.schedule.Next(now)
+		}
+
+		if !e.next.IsZero() && (next.IsZero() || e.next.Before(next)) {
+			next = e.next
+		}
+	}
+
+	return due, next
+}
+
+// dispatch hands a due job to the executor.
+func (s *Scheduler) dispatch(e *entry) {
+	s.running.Add(1)
+
+	err := s.executor.Schedule(func() {
+		defer s.running.Done()
+		s.run(e)
+	})
+	if err == nil {
+		return
+	}
+
+	s.running.Done()
+
+	s.mutex.Lock()
+	e.running = false
+	e.lastErr = err
+	s.mutex.Unlock()
+
+	s.log.Error(s.ctx, "failed to dispatch scheduled job", zap.String("job", e.name), zap.Error(err))
+}
+
+// run executes a job and records its outcome. A panic is recorded as the job's error,
+// so the job isn't left marked as running forever.
+func (s *Scheduler) run(e *entry) {
+	start := s.clock.Now()
+
+	s.mutex.Lock()
+	e.lastRun = start
+	s.mutex.Unlock()
+
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+
+		s.mutex.Lock()
+		e.running = false
+		e.lastDuration = s.clock.Now().Sub(start)
+		e.lastErr = err
+		e.runs++
+		s.mutex.Unlock()
+
+		if err != nil {
+			s.log.Error(s.ctx, "scheduled job failed", zap.String("job", e.name), zap.Error(err))
+		}
+	}()
+
+	err = e.job(s.ctx)
+}
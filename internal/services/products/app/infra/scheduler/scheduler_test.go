@@ -0,0 +1,455 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"pkg/logger"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// nopLogger drops the scheduler logs.
+type nopLogger struct {
+	logger.Zapper
+}
+
+func (nopLogger) Error(context.Context, string, ...zap.Field) {}
+
+// manualExecutor keeps dispatched tasks until the test runs them, or rejects them with err.
+type manualExecutor struct {
+	mutex sync.Mutex
+	tasks []func()
+	err   error
+}
+
+func (e *manualExecutor) Schedule(task func()) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.err != nil {
+		return e.err
+	}
+	e.tasks = append(e.tasks, task)
+	return nil
+}
+
+// runAll runs the dispatched tasks and returns how many there were.
+func (e *manualExecutor) runAll() int {
+	e.mutex.Lock()
+	tasks := e.tasks
+	e.tasks = nil
+	e.mutex.Unlock()
+
+	for _, task := range tasks {
+		task()
+	}
+	return len(tasks)
+}
+
+// tick dispatches the jobs due at now, as the loop does once its timer fires.
+func tick(s *Scheduler, now time.Time) time.Time {
+	due, next := s.due(now)
+	for _, e := range due {
+		s.dispatch(e)
+	}
+	return next
+}
+
+func newManualScheduler() (*Scheduler, *manualExecutor) {
+	executor := &manualExecutor{}
+	s := New(executor, nopLogger{})
+	s.ctx = context.Background()
+	return s, executor
+}
+
+func TestCronSchedule(t *testing.T) {
+	schedule, err := Cron("*/15 * * * *")
+	if err != nil {
+		t.Fatalf("Cron: %v", err)
+	}
+
+	from := time.Date(2026, 3, 1, 10, 7, 30, 0, time.Local)
+	want := []time.Time{
+		time.Date(2026, 3, 1, 10, 15, 0, 0, time.Local),
+		time.Date(2026, 3, 1, 10, 30, 0, 0, time.Local),
+		time.Date(2026, 3, 1, 10, 45, 0, 0, time.Local),
+	}
+	for _, next := range want {
+		if from = schedule.Next(from); !from.Equal(next) {
+			t.Fatalf("Next = %s, want %s", from, next)
+		}
+	}
+
+	if _, err := Cron("61 * * * *"); err == nil {
+		t.Error("Cron accepted minute 61")
+	}
+}
+
+func TestOneOffJobRunsOnce(t *testing.T) {
+	s, executor := newManualScheduler()
+	at := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	ran := 0
+	s.RunAt("report", at, func(context.Context) error { ran++; return nil })
+
+	if next := tick(s, at.Add(-time.Second)); !next.Equal(at) {
+		t.Fatalf("next activation = %s, want %s", next, at)
+	}
+	if executor.runAll() != 0 {
+		t.Fatal("job dispatched before its time")
+	}
+
+	if next := tick(s, at); !next.IsZero() {
+		t.Errorf("next activation = %s after the only run, want none", next)
+	}
+	executor.runAll()
+	tick(s, at.Add(time.Hour))
+
+	if n := executor.runAll(); n != 0 || ran != 1 {
+		t.Errorf("job ran %d times, %d more dispatched, want once", ran, n)
+	}
+
+	info, _ := s.Job("report")
+	if info.Runs != 1 || !info.NextRun.IsZero() || info.LastRun.IsZero() {
+		t.Errorf("info = %+v, want one run and no next one", info)
+	}
+}
+
+func TestOverlappingActivationIsSkipped(t *testing.T) {
+	s, executor := newManualScheduler()
+	start := time.Now().Truncate(time.Second)
+
+	schedule, _ := Cron("@every 1m")
+	s.Add("sync", schedule, func(context.Context) error { return nil })
+
+	// First activation dispatched, still running at the second one
+	tick(s, start.Add(time.Minute))
+	tick(s, start.Add(2*time.Minute))
+
+	info, _ := s.Job("sync")
+	if !info.Running || info.Skipped != 1 {
+		t.Fatalf("info = %+v, want running with one skipped activation", info)
+	}
+
+	if n := executor.runAll(); n != 1 {
+		t.Fatalf("%d runs dispatched, want 1", n)
+	}
+
+	tick(s, start.Add(3*time.Minute))
+	if n := executor.runAll(); n != 1 {
+		t.Fatalf("%d runs dispatched once the job finished, want 1", n)
+	}
+
+	info, _ = s.Job("sync")
+	if info.Running || info.Runs != 2 || info.Skipped != 1 {
+		t.Errorf("info = %+v, want 2 runs and 1 skipped", info)
+	}
+}
+
+func TestJobOutcomeIsRecorded(t *testing.T) {
+	s, executor := newManualScheduler()
+	at := time.Now().Add(time.Hour)
+	errJob := errors.New("job failed")
+
+	s.RunAt("failing", at, func(context.Context) error { return errJob })
+	s.RunAt("panicking", at, func(context.Context) error { panic("boom") })
+	tick(s, at)
+	executor.runAll()
+
+	if info, _ := s.Job("failing"); !errors.Is(info.LastErr, errJob) || info.Running {
+		t.Errorf("failing job = %+v, want its error and not running", info)
+	}
+	if info, _ := s.Job("panicking"); info.LastErr == nil || info.Running || info.Runs != 1 {
+		t.Errorf("panicking job = %+v, want the panic as error and not running", info)
+	}
+}
+
+func TestRejectedDispatchIsRecorded(t *testing.T) {
+	s, executor := newManualScheduler()
+	executor.err = errors.New("queue full")
+	at := time.Now().Add(time.Hour)
+
+	s.RunAt("report", at, func(context.Context) error { return nil })
+	tick(s, at)
+
+	info, _ := s.Job("report")
+	if info.Running || !errors.Is(info.LastErr, executor.err) || info.Runs != 0 {
+		t.Errorf("info = %+v, want the dispatch error and no run", info)
+	}
+}
+
+func TestAddAndRemove(t *testing.T) {
+	s, _ := newManualScheduler()
+	job := func(context.Context) error { return nil }
+
+	s.RunAfter("b", time.Hour, job)
+	s.Cron("a", "@daily", job)
+
+	if err := s.RunAfter("a", time.Hour, job); !errors.Is(err, ErrDuplicateJob) {
+		t.Errorf("Add duplicate: err = %v, want ErrDuplicateJob", err)
+	}
+	if err := s.Cron("c", "not a cron", job); err == nil {
+		t.Error("Cron accepted an invalid expression")
+	}
+
+	if jobs := s.Jobs(); len(jobs) != 2 || jobs[0].Name != "a" || jobs[1].Name != "b" {
+		t.Fatalf("Jobs = %+v, want a and b", jobs)
+	}
+
+	if err := s.Remove("a"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := s.Remove("a"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Remove twice: err = %v, want ErrJobNotFound", err)
+	}
+	if _, err := s.Job("a"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Job after Remove: err = %v, want ErrJobNotFound", err)
+	}
+}
+
+// fakeClock is a Clock that only moves when the test advances it.
+// Every Reset of its timer is reported on resets, so the test can wait for the loop to go back to sleep.
+type fakeClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timer  *fakeTimer
+	resets chan time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:    time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local),
+		resets: make(chan time.Duration, 16),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.timer = &fakeTimer{clock: c, c: make(chan time.Time, 1), at: c.now.Add(d), active: true}
+	return c.timer
+}
+
+// advance moves the time forward, firing the timer if it is due.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+	if t := c.timer; t != nil && t.active && !t.at.After(c.now) {
+		t.active = false
+		t.c <- c.now
+	}
+}
+
+// nextReset waits for the loop to reset its timer and returns the duration it was reset to.
+func (c *fakeClock) nextReset(t *testing.T) time.Duration {
+	t.Helper()
+
+	select {
+	case d := <-c.resets:
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("scheduler loop didn't reset its timer")
+		return 0
+	}
+}
+
+type fakeTimer struct {
+	clock  *fakeClock
+	c      chan time.Time
+	at     time.Time
+	active bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mutex.Lock()
+	wasActive := t.active
+	t.at, t.active = t.clock.now.Add(d), true
+	select {
+	case <-t.c: // As with time.Timer, no stale value is delivered after Reset
+	default:
+	}
+	t.clock.mutex.Unlock()
+
+	t.clock.resets <- d
+	return wasActive
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+
+	wasActive := t.active
+	t.active = false
+	return wasActive
+}
+
+func TestLoopSleepsUntilNextActivation(t *testing.T) {
+	clock := newFakeClock()
+	executor := &manualExecutor{}
+	s := New(executor, nopLogger{}, WithClock(clock))
+	job := func(context.Context) error { return nil }
+
+	s.Start(context.Background())
+
+	// Nothing registered: the loop sleeps for its default hour
+	if d := clock.nextReset(t); d != time.Hour {
+		t.Fatalf("timer reset to %s without jobs, want 1h", d)
+	}
+
+	// A new job wakes the loop up, which sleeps until its activation
+	s.RunAfter("report", 10*time.Minute, job)
+	if d := clock.nextReset(t); d != 10*time.Minute {
+		t.Fatalf("timer reset to %s after RunAfter, want 10m", d)
+	}
+
+	// An earlier job shortens the sleep
+	s.Cron("sync", "@every 1m", job)
+	if d := clock.nextReset(t); d != time.Minute {
+		t.Fatalf("timer reset to %s after Cron, want 1m", d)
+	}
+
+	clock.advance(30 * time.Second)
+	select {
+	case d := <-clock.resets:
+		t.Fatalf("loop woke up before the activation, timer reset to %s", d)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// The timer fires: sync is dispatched and the loop sleeps until its next run
+	clock.advance(30 * time.Second)
+	if d := clock.nextReset(t); d != time.Minute {
+		t.Fatalf("timer reset to %s after the first run, want 1m", d)
+	}
+	if n := executor.runAll(); n != 1 {
+		t.Fatalf("%d jobs dispatched at the first activation, want 1", n)
+	}
+
+	// Removing sync leaves report, 9 minutes away
+	s.Remove("sync")
+	if d := clock.nextReset(t); d != 9*time.Minute {
+		t.Fatalf("timer reset to %s after Remove, want 9m", d)
+	}
+
+	clock.advance(9 * time.Minute)
+	if d := clock.nextReset(t); d != time.Hour {
+		t.Fatalf("timer reset to %s once every job ran, want 1h", d)
+	}
+	if n := executor.runAll(); n != 1 {
+		t.Fatalf("%d jobs dispatched for report, want 1", n)
+	}
+	if info, _ := s.Job("report"); info.Runs != 1 || !info.LastRun.Equal(clock.Now()) {
+		t.Errorf("report = %+v, want one run at %s", info, clock.Now())
+	}
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	select {
+	case <-s.loopDone:
+	default:
+		t.Fatal("loop still running after Stop")
+	}
+	if clock.timer.Stop() {
+		t.Error("timer still active after Stop")
+	}
+}
+
+// goExecutor runs every task on its own goroutine.
+type goExecutor struct{}
+
+func (goExecutor) Schedule(task func()) error {
+	go task()
+	return nil
+}
+
+func TestStopWaitsForRunningJobs(t *testing.T) {
+	s := New(goExecutor{}, nopLogger{})
+
+	started, release := make(chan token), make(chan token)
+	s.RunAfter("slow", 10*time.Millisecond, func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+
+	s.Start(context.Background())
+	<-started
+
+	stopped := make(chan error)
+	go func() { stopped <- s.Stop(context.Background()) }()
+
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned while a job was running")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+}
+
+func TestStopCancelsJobsAtDeadline(t *testing.T) {
+	s := New(goExecutor{}, nopLogger{})
+
+	cancelled := make(chan token)
+	s.RunAfter("stuck", time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	s.Start(context.Background())
+
+	for info, _ := s.Job("stuck"); !info.Running; info, _ = s.Job("stuck") {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Stop: err = %v, want DeadlineExceeded", err)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("job context not cancelled by Stop")
+	}
+}
+
+func TestStopBeforeStart(t *testing.T) {
+	s := New(goExecutor{}, nopLogger{})
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	// The scheduler stays stopped
+	ran := make(chan token, 1)
+	s.RunAfter("late", time.Millisecond, func(context.Context) error { ran <- token{}; return nil })
+	s.Start(context.Background())
+
+	select {
+	case <-ran:
+		t.Error("job ran after Stop")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,29 @@
+package inits
+
+import (
+	"fmt"
+	"pkg/helper"
+	"pkg/workerpool/distributed"
+	"products/conf"
+)
+
+// NewDistributedPool shares tasks between the products instances through Consul.
+// Without a "distributed" section the tasks stay within this instance and Consul is never polled,
+// so the section should only be added once handlers are registered with the pool.
+func NewDistributedPool(cfg *conf.Config) (*distributed.Pool, error) {
+	if cfg.Distributed == nil {
+		return distributed.NewPool(distributed.NewLoopback(), &distributed.Config{}), nil
+	}
+
+	transport, err := distributed.NewConsulTransport(nil, fmt.Sprintf("%s/%s", distributed.DefaultConsulPrefix, cfg.Service.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	poolConf := *cfg.Distributed
+	if poolConf.WorkerID == "" {
+		poolConf.WorkerID = fmt.Sprintf("%s-%s", cfg.Service.Name, helper.GetMachineID())
+	}
+
+	return distributed.NewPool(transport, &poolConf), nil
+}
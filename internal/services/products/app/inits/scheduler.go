@@ -0,0 +1,12 @@
+package inits
+
+import (
+	"pkg/logger"
+	"pkg/workerpool"
+	"products/app/infra/scheduler"
+)
+
+// NewScheduler runs scheduled jobs on whichever workerpool.Pool is provided, the adaptive pool by default.
+func NewScheduler(pool workerpool.Pool, log logger.Zapper) *scheduler.Scheduler {
+	return scheduler.New(pool, log)
+}
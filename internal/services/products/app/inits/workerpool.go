@@ -0,0 +1,26 @@
+package inits
+
+import (
+	adaptive "pkg/workerpool/custom/adaptive"
+	"pkg/workerpool/group"
+	"products/conf"
+
+	metricsdk "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func NewWorkerPool(cfg *conf.Config, provider *metricsdk.MeterProvider) *adaptive.Pool {
+	return adaptive.NewPoolFromConfig(cfg.WorkerPool,
+		adaptive.WithMetrics(provider.Meter("products/workerpool"), "products"),
+	)
+}
+
+// NewWorkerGroups declares the groups of the workerGroups section, none unless a feature needs
+// its own pool. Their tasks are drained by RunServers on shutdown.
+func NewWorkerGroups(cfg *conf.Config, provider *metricsdk.MeterProvider) (*group.Registry, error) {
+	registry := group.NewRegistry(group.WithMetrics(provider.Meter("products/workergroups")))
+	if err := registry.DeclareAll(cfg.WorkerGroups); err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
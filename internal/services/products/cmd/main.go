@@ -9,6 +9,7 @@ import (
 	"pkg/logger"
 	"pkg/otel"
 	"pkg/websocket/gobwas"
+	"pkg/workerpool"
 	"products/app/inits"
 	"products/conf"
 	"products/server"
@@ -39,6 +40,10 @@ func main() {
 			gobwas.NewWebSocketHander,
 			gobwas.NewWebSocketServer,
 			grpc.NewGrpcServer,
+			fx.Annotate(inits.NewWorkerPool, fx.As(fx.Self()), fx.As(new(workerpool.Pool))),
+			inits.NewWorkerGroups,
+			inits.NewScheduler,
+			inits.NewDistributedPool,
 		),
 		fx.Invoke(server.RunServers),
 		fx.Invoke(inits.InitMediator),
@@ -15,6 +15,8 @@ import (
 	"pkg/logger"
 	"pkg/otel/conf"
 	"pkg/websocket/gobwas"
+	adaptive "pkg/workerpool/custom/adaptive"
+	"pkg/workerpool/distributed"
 	"products/app/core/models"
 	"runtime"
 	"strings"
@@ -32,15 +34,18 @@ func init() {
  * Config - Centralized configuration for all the service present in application
  */
 type Config struct {
-	Service          *models.Service         `mapstructure:"service" validate:"required"`
-	Echo             *http.EchoConfig        `mapstructure:"echo" validate:"required"`
-	Logger           *logger.LoggerConfig    `mapstructure:"logger" validate:"required"`
-	Sql              *db.SQLConfig           `mapstructure:"sql" validate:"required"`
-	GraphQL          *gql.GraphQLConfig      `mapstructure:"graphql" validate:"required"`
-	Otel             *conf.OtelConfig        `mapstructure:"telemetry" validate:"required"`
-	WSConfig         *gobwas.WebSocketConfig `mapstructure:"websocket" validate:"required"`
-	GrpcConfig       *grpc.GrpcConfig        `mapstructure:"grpc_server" validate:"required"`
-	GrpcClientConfig *grpc.GrpcClientConfig  `mapstructure:"grpc_client" validate:"required"`
+	Service          *models.Service                 `mapstructure:"service" validate:"required"`
+	Echo             *http.EchoConfig                `mapstructure:"echo" validate:"required"`
+	Logger           *logger.LoggerConfig            `mapstructure:"logger" validate:"required"`
+	Sql              *db.SQLConfig                   `mapstructure:"sql" validate:"required"`
+	GraphQL          *gql.GraphQLConfig              `mapstructure:"graphql" validate:"required"`
+	Otel             *conf.OtelConfig                `mapstructure:"telemetry" validate:"required"`
+	WSConfig         *gobwas.WebSocketConfig         `mapstructure:"websocket" validate:"required"`
+	GrpcConfig       *grpc.GrpcConfig                `mapstructure:"grpc_server" validate:"required"`
+	GrpcClientConfig *grpc.GrpcClientConfig          `mapstructure:"grpc_client" validate:"required"`
+	WorkerPool       *adaptive.PoolConfig            `mapstructure:"workerpool" validate:"required"`
+	WorkerGroups     map[string]*adaptive.PoolConfig `mapstructure:"workerGroups"`
+	Distributed      *distributed.Config             `mapstructure:"distributed"`
 }
 
 /**
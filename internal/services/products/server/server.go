@@ -9,6 +9,10 @@ import (
 	"pkg/http/server"
 	"pkg/logger"
 	"pkg/otel/metrics"
+	adaptive "pkg/workerpool/custom/adaptive"
+	"pkg/workerpool/distributed"
+	"pkg/workerpool/group"
+	"products/app/infra/scheduler"
 	"products/app/inits"
 	"products/cgfx/ent/gen"
 	"products/conf"
@@ -26,7 +30,7 @@ import (
 	"go.uber.org/zap"
 )
 
-func RunServers(lc fx.Lifecycle, e *echo.Echo, client *gen.Client, log logger.Zapper, config *conf.Config, gqlsrv *http.Server, provider *metricsdk.MeterProvider, grpcgrpcServer *grpc.GrpcServer, ctx context.Context) {
+func RunServers(lc fx.Lifecycle, e *echo.Echo, client *gen.Client, log logger.Zapper, config *conf.Config, gqlsrv *http.Server, provider *metricsdk.MeterProvider, grpcgrpcServer *grpc.GrpcServer, pool *adaptive.Pool, groups *group.Registry, jobs *scheduler.Scheduler, tasks *distributed.Pool, ctx context.Context) {
 
 	lc.Append(fx.Hook{
 		OnStart: func(_ context.Context) error {
@@ -67,6 +71,16 @@ func RunServers(lc fx.Lifecycle, e *echo.Echo, client *gen.Client, log logger.Za
 				}
 			}()
 
+			/**
+			 * Scheduled Jobs
+			 */
+			jobs.Start(ctx)
+
+			/**
+			 * Distributed Tasks
+			 */
+			tasks.Start(ctx)
+
 			/**
 			 * Service Route
 			 */
@@ -97,6 +111,46 @@ func RunServers(lc fx.Lifecycle, e *echo.Echo, client *gen.Client, log logger.Za
 				log.Info(ctx, "GraphQL server shut down gracefully")
 			}
 
+			/**
+			 * Stop dispatching scheduled jobs before draining the pool they run on.
+			 */
+			if err := jobs.Stop(stopCtx); err != nil {
+				log.Error(ctx, "scheduler stopped before jobs finished", zap.Error(err))
+			} else {
+				log.Info(ctx, "Scheduler stopped gracefully")
+			}
+
+			/**
+			 * Stop pulling shared tasks; unfinished ones are released to the other instances.
+			 */
+			if err := tasks.Shutdown(stopCtx); err != nil {
+				log.Error(ctx, "distributed pool stopped before tasks finished", zap.Error(err))
+			} else {
+				log.Info(ctx, "Distributed pool stopped gracefully")
+			}
+
+			/**
+			 * Drain the worker pool once no more work is coming in from the servers.
+			 */
+			poolCtx := stopCtx
+			if config.WorkerPool.ShutdownTimeout > 0 {
+				var cancel context.CancelFunc
+				poolCtx, cancel = context.WithTimeout(stopCtx, config.WorkerPool.ShutdownTimeout)
+				defer cancel()
+			}
+
+			if dropped, err := pool.Shutdown(poolCtx); err != nil {
+				log.Error(ctx, "worker pool shut down before draining", zap.Int("dropped", dropped), zap.Error(err))
+			} else {
+				log.Info(ctx, "Worker pool shut down gracefully")
+			}
+
+			if dropped, err := groups.Shutdown(poolCtx); err != nil {
+				log.Error(ctx, "worker groups shut down before draining", zap.Int("dropped", dropped), zap.Error(err))
+			} else {
+				log.Info(ctx, "Worker groups shut down gracefully")
+			}
+
 			log.Info(ctx, "All servers shut down gracefully")
 
 			log.Sync()